@@ -26,6 +26,9 @@ type MasterNode struct {
 	
 	cleanupTicker    *time.Ticker
 	healthTicker     *time.Ticker
+	cleanupTasks     []cleanupTask
+	releaseSession   func(session *UploadSession, stored []ChunkAssignment)
+	tasksMutex       sync.Mutex
 	
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -34,6 +37,13 @@ type MasterNode struct {
 	runMutex  sync.RWMutex
 }
 
+// cleanupTask is work run by the cleanup service on every tick, on top of
+// expiring sessions.
+type cleanupTask struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
 type DownloadSession struct {
 	SessionID   string    `json:"session_id"`
 	FileID      string    `json:"file_id"`
@@ -88,8 +98,10 @@ func (m *MasterNode) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to start background services: %w", err)
 	}
 	
-	if err := m.healthChecker.StartHealthChecking(m.ctx); err != nil {
-		return fmt.Errorf("failed to start health checker: %w", err)
+	if m.healthChecker != nil {
+		if err := m.healthChecker.StartHealthChecking(m.ctx); err != nil {
+			return fmt.Errorf("failed to start health checker: %w", err)
+		}
 	}
 	
 	m.running = true
@@ -117,8 +129,10 @@ func (m *MasterNode) Stop(ctx context.Context) error {
 		m.healthTicker.Stop()
 	}
 	
-	if err := m.healthChecker.StopHealthChecking(ctx); err != nil {
-		m.logger.Printf("Error stopping health checker: %v", err)
+	if m.healthChecker != nil {
+		if err := m.healthChecker.StopHealthChecking(ctx); err != nil {
+			m.logger.Printf("Error stopping health checker: %v", err)
+		}
 	}
 	
 	done := make(chan struct{})
@@ -140,6 +154,42 @@ func (m *MasterNode) Stop(ctx context.Context) error {
 	return nil
 }
 
+func (m *MasterNode) Config() *config.MasterConfig {
+	return m.config
+}
+
+// AddCleanupTask registers work for the cleanup service to run every
+// CleanupInterval.
+func (m *MasterNode) AddCleanupTask(name string, run func(ctx context.Context) error) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	m.cleanupTasks = append(m.cleanupTasks, cleanupTask{name: name, run: run})
+}
+
+// OnSessionAbandoned registers release to roll back the chunks stored by
+// upload sessions that time out or expire before they are completed.
+func (m *MasterNode) OnSessionAbandoned(release func(session *UploadSession, stored []ChunkAssignment)) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	m.releaseSession = release
+}
+
+// abandonSession moves session to status and rolls back its chunks.
+func (m *MasterNode) abandonSession(session *UploadSession, status SessionStatus) {
+	stored, err := session.Abandon(status)
+	if err != nil || len(stored) == 0 {
+		return
+	}
+	
+	m.tasksMutex.Lock()
+	release := m.releaseSession
+	m.tasksMutex.Unlock()
+	
+	if release != nil {
+		release(session, stored)
+	}
+}
+
 func (m *MasterNode) IsRunning() bool {
 	m.runMutex.RLock()
 	defer m.runMutex.RUnlock()
@@ -208,14 +258,26 @@ func (m *MasterNode) metricsService() {
 }
 
 func (m *MasterNode) performCleanup() {
-	ctx := context.Background()
+	ctx := m.ctx
 	
-	if err := m.sessionManager.CleanupExpiredSessions(ctx); err != nil {
-		m.logger.Printf("Error cleaning up expired sessions: %v", err)
+	if m.sessionManager != nil {
+		if err := m.sessionManager.CleanupExpiredSessions(ctx); err != nil {
+			m.logger.Printf("Error cleaning up expired sessions: %v", err)
+		}
 	}
 	
 	m.cleanupExpiredInMemorySessions()
 	
+	m.tasksMutex.Lock()
+	tasks := append([]cleanupTask(nil), m.cleanupTasks...)
+	m.tasksMutex.Unlock()
+	
+	for _, task := range tasks {
+		if err := task.run(ctx); err != nil {
+			m.logger.Printf("Error running cleanup task %s: %v", task.name, err)
+		}
+	}
+	
 	m.logger.Println("Cleanup completed")
 }
 
@@ -223,12 +285,18 @@ func (m *MasterNode) cleanupExpiredInMemorySessions() {
 	now := time.Now()
 	
 	m.sessionsMutex.Lock()
-	defer m.sessionsMutex.Unlock()
-	
+	var expired []*UploadSession
 	for sessionID, session := range m.uploadSessions {
-		if now.After(session.ExpiresAt) {
-			delete(m.uploadSessions, sessionID)
+		if !now.After(session.ExpiresAt) {
+			continue
+		}
+		// A commit or direct upload in progress owns the session until
+		// it finishes.
+		if status := session.GetStatus(); status == SessionStatusCommitting || status == SessionStatusStreaming {
+			continue
 		}
+		delete(m.uploadSessions, sessionID)
+		expired = append(expired, session)
 	}
 	
 	for sessionID, session := range m.downloadSessions {
@@ -236,6 +304,13 @@ func (m *MasterNode) cleanupExpiredInMemorySessions() {
 			delete(m.downloadSessions, sessionID)
 		}
 	}
+	m.sessionsMutex.Unlock()
+	
+	// Completed sessions are left alone by Abandon; their chunks belong
+	// to the committed file.
+	for _, session := range expired {
+		m.abandonSession(session, SessionStatusExpired)
+	}
 }
 
 func (m *MasterNode) monitorSessions() {
@@ -254,12 +329,16 @@ func (m *MasterNode) monitorSessions() {
 		
 		if status == SessionStatusActive && time.Since(createdAt) > m.config.SessionTimeout {
 			m.logger.Printf("Session %s timed out, marking as failed", session.SessionID)
-			m.updateSessionStatus(session.SessionID, SessionStatusFailed)
+			m.abandonSession(session, SessionStatusFailed)
 		}
 	}
 }
 
 func (m *MasterNode) collectMetrics() {
+	if m.workerRegistry == nil {
+		return
+	}
+	
 	workers, err := m.workerRegistry.GetHealthyWorkers(context.Background())
 	if err != nil {
 		m.logger.Printf("Error getting healthy workers for metrics: %v", err)
@@ -294,6 +373,32 @@ func (m *MasterNode) GetUploadSession(sessionID string) (*UploadSession, bool) {
 	return session, exists
 }
 
+// GetCompletedSessionByFileID returns the committed upload session holding the
+// chunk map for fileID.
+func (m *MasterNode) GetCompletedSessionByFileID(fileID string) (*UploadSession, bool) {
+	m.sessionsMutex.RLock()
+	defer m.sessionsMutex.RUnlock()
+	
+	for _, session := range m.uploadSessions {
+		if session.FileID == fileID && session.GetStatus() == SessionStatusCompleted {
+			return session, true
+		}
+	}
+	return nil, false
+}
+
+// UploadSessions returns every upload session held in memory.
+func (m *MasterNode) UploadSessions() []*UploadSession {
+	m.sessionsMutex.RLock()
+	defer m.sessionsMutex.RUnlock()
+	
+	sessions := make([]*UploadSession, 0, len(m.uploadSessions))
+	for _, session := range m.uploadSessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
 func (m *MasterNode) AddUploadSession(session *UploadSession) {
 	m.sessionsMutex.Lock()
 	defer m.sessionsMutex.Unlock()
@@ -301,6 +406,18 @@ func (m *MasterNode) AddUploadSession(session *UploadSession) {
 	m.uploadSessions[session.SessionID] = session
 }
 
+// AddNewUploadSession adds session unless its ID is already in use.
+func (m *MasterNode) AddNewUploadSession(session *UploadSession) bool {
+	m.sessionsMutex.Lock()
+	defer m.sessionsMutex.Unlock()
+	
+	if _, exists := m.uploadSessions[session.SessionID]; exists {
+		return false
+	}
+	m.uploadSessions[session.SessionID] = session
+	return true
+}
+
 func (m *MasterNode) RemoveUploadSession(sessionID string) {
 	m.sessionsMutex.Lock()
 	defer m.sessionsMutex.Unlock()
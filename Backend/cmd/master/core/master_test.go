@@ -0,0 +1,47 @@
+package core
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"echofs/pkg/config"
+)
+
+func TestExpiredSessionsReleaseChunks(t *testing.T) {
+	m := NewMasterNode(&config.MasterConfig{}, log.New(io.Discard, "", 0))
+
+	var released []string
+	m.OnSessionAbandoned(func(session *UploadSession, stored []ChunkAssignment) {
+		for _, assignment := range stored {
+			released = append(released, assignment.ChunkID)
+		}
+	})
+
+	expired := newTestSession(1)
+	expired.SessionID = "expired"
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := expired.MarkChunkUploaded(0, ChunkAssignment{ChunkID: "a", PrimaryWorker: "w1"}); err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+
+	completed := newTestSession(1)
+	completed.SessionID = "completed"
+	completed.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := completed.MarkChunkUploaded(0, ChunkAssignment{ChunkID: "b", PrimaryWorker: "w1"}); err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+	completed.SetStatus(SessionStatusCompleted)
+
+	m.AddUploadSession(expired)
+	m.AddUploadSession(completed)
+	m.cleanupExpiredInMemorySessions()
+
+	if len(released) != 1 || released[0] != "a" {
+		t.Fatalf("released %v, want only the uncommitted chunk a", released)
+	}
+	if len(m.UploadSessions()) != 0 {
+		t.Fatalf("expired sessions were not removed")
+	}
+}
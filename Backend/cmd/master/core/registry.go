@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrWorkerNotFound = errors.New("worker not found")
+
+// LiveWorkerRegistry tracks the workers that registered with the master.
+// It is also the master's HealthChecker: a worker that hasn't sent a
+// heartbeat for the health timeout is marked offline until it sends one
+// again.
+type LiveWorkerRegistry struct {
+	mutex   sync.RWMutex
+	workers map[string]*WorkerNode
+	timeout time.Duration
+	logger  *log.Logger
+
+	onOffline func(worker *WorkerNode)
+	stop      context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewLiveWorkerRegistry(timeout time.Duration, logger *log.Logger) *LiveWorkerRegistry {
+	return &LiveWorkerRegistry{
+		workers: make(map[string]*WorkerNode),
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// OnOffline sets a function called with each worker the health checker
+// marks offline.
+func (r *LiveWorkerRegistry) OnOffline(fn func(worker *WorkerNode)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onOffline = fn
+}
+
+// snapshot copies a worker so it can be read without the registry's lock.
+func snapshot(worker *WorkerNode) WorkerNode {
+	return WorkerNode{
+		ID:               worker.ID,
+		Address:          worker.Address,
+		Port:             worker.Port,
+		Status:           worker.Status,
+		LastHeartbeat:    worker.LastHeartbeat,
+		TotalStorage:     worker.TotalStorage,
+		UsedStorage:      worker.UsedStorage,
+		AvailableStorage: worker.AvailableStorage,
+		CPUUsage:         worker.CPUUsage,
+		MemoryUsage:      worker.MemoryUsage,
+		Version:          worker.Version,
+		Capabilities:     append([]string(nil), worker.Capabilities...),
+		Labels:           copyLabels(worker.Labels),
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return copied
+}
+
+// RegisterWorker adds the worker, or replaces it when it registers again,
+// as online with a fresh heartbeat.
+func (r *LiveWorkerRegistry) RegisterWorker(ctx context.Context, worker *WorkerNode) error {
+	node := snapshot(worker)
+	node.Status = WorkerStatusOnline
+	node.LastHeartbeat = time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.workers[node.ID] = &node
+	return nil
+}
+
+func (r *LiveWorkerRegistry) DeregisterWorker(ctx context.Context, workerID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.workers[workerID]; !exists {
+		return ErrWorkerNotFound
+	}
+	delete(r.workers, workerID)
+	return nil
+}
+
+// GetWorker returns a copy of the worker.
+func (r *LiveWorkerRegistry) GetWorker(ctx context.Context, workerID string) (*WorkerNode, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	worker, exists := r.workers[workerID]
+	if !exists {
+		return nil, ErrWorkerNotFound
+	}
+	node := snapshot(worker)
+	return &node, nil
+}
+
+// Workers returns a copy of every registered worker, online or not, in ID
+// order.
+func (r *LiveWorkerRegistry) Workers() []*WorkerNode {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	workers := make([]*WorkerNode, 0, len(r.workers))
+	for _, worker := range r.workers {
+		node := snapshot(worker)
+		workers = append(workers, &node)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers
+}
+
+func (r *LiveWorkerRegistry) GetHealthyWorkers(ctx context.Context) ([]*WorkerNode, error) {
+	var healthy []*WorkerNode
+	for _, worker := range r.Workers() {
+		if worker.Status == WorkerStatusOnline {
+			healthy = append(healthy, worker)
+		}
+	}
+	return healthy, nil
+}
+
+func (r *LiveWorkerRegistry) UpdateWorkerStatus(ctx context.Context, workerID string, status WorkerStatus) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	worker, exists := r.workers[workerID]
+	if !exists {
+		return ErrWorkerNotFound
+	}
+	worker.Status = status
+	return nil
+}
+
+// GetWorkerLoad returns the share of the worker's storage in use, 0 when
+// its capacity is unknown.
+func (r *LiveWorkerRegistry) GetWorkerLoad(ctx context.Context, workerID string) (float64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	worker, exists := r.workers[workerID]
+	if !exists {
+		return 0, ErrWorkerNotFound
+	}
+	if worker.TotalStorage <= 0 {
+		return 0, nil
+	}
+	return float64(worker.UsedStorage) / float64(worker.TotalStorage), nil
+}
+
+// Heartbeat records a heartbeat from the worker with its current storage
+// use and brings it back online. It returns the worker as it was before
+// the heartbeat, so callers can tell that it had been offline.
+func (r *LiveWorkerRegistry) Heartbeat(ctx context.Context, workerID string, availableStorage, usedStorage int64) (*WorkerNode, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	worker, exists := r.workers[workerID]
+	if !exists {
+		return nil, ErrWorkerNotFound
+	}
+	previous := snapshot(worker)
+
+	worker.LastHeartbeat = time.Now()
+	worker.AvailableStorage = availableStorage
+	worker.UsedStorage = usedStorage
+	if worker.TotalStorage < availableStorage+usedStorage {
+		worker.TotalStorage = availableStorage + usedStorage
+	}
+	if worker.Status == WorkerStatusOffline {
+		worker.Status = WorkerStatusOnline
+	}
+	return &previous, nil
+}
+
+// CheckWorkerHealth fails for workers that are unknown, not online or
+// late with their heartbeat.
+func (r *LiveWorkerRegistry) CheckWorkerHealth(ctx context.Context, workerID string) error {
+	worker, err := r.GetWorker(ctx, workerID)
+	if err != nil {
+		return err
+	}
+	if worker.Status != WorkerStatusOnline {
+		return fmt.Errorf("worker %s is not online", workerID)
+	}
+	if time.Since(worker.LastHeartbeat) > r.timeout {
+		return fmt.Errorf("worker %s missed its heartbeats", workerID)
+	}
+	return nil
+}
+
+// StartHealthChecking marks workers offline once their heartbeats are
+// older than the health timeout, checking a few times per timeout.
+func (r *LiveWorkerRegistry) StartHealthChecking(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	r.mutex.Lock()
+	r.stop = cancel
+	r.mutex.Unlock()
+
+	interval := r.timeout / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.expireWorkers(time.Now())
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *LiveWorkerRegistry) StopHealthChecking(ctx context.Context) error {
+	r.mutex.Lock()
+	stop := r.stop
+	r.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+	r.wg.Wait()
+	return nil
+}
+
+func (r *LiveWorkerRegistry) expireWorkers(now time.Time) {
+	var expired []*WorkerNode
+	r.mutex.Lock()
+	for _, worker := range r.workers {
+		if worker.Status == WorkerStatusOnline && now.Sub(worker.LastHeartbeat) > r.timeout {
+			worker.Status = WorkerStatusOffline
+			node := snapshot(worker)
+			expired = append(expired, &node)
+		}
+	}
+	onOffline := r.onOffline
+	r.mutex.Unlock()
+
+	for _, worker := range expired {
+		r.logger.Printf("Worker %s missed its heartbeats since %s, marking offline",
+			worker.ID, worker.LastHeartbeat.Format(time.RFC3339))
+		if onOffline != nil {
+			onOffline(worker)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrSessionCompleted  = errors.New("upload session already completed")
+	ErrSessionCommitting = errors.New("upload session is being completed")
+	ErrSessionAbandoned  = errors.New("upload session was abandoned")
+	ErrSessionStreaming  = errors.New("upload session is being streamed")
+)
+
+// ChunkProgress is the state of one chunk of an upload.
+type ChunkProgress struct {
+	Index      int    `json:"index"`
+	Status     string `json:"status"`
+	Size       int64  `json:"size"`
+	StoredSize int64  `json:"stored_size,omitempty"`
+}
+
+type UploadProgress struct {
+	SessionID      string          `json:"session_id"`
+	FileID         string          `json:"file_id"`
+	ObjectID       string          `json:"object_id,omitempty"`
+	Version        int64           `json:"version,omitempty"`
+	FileName       string          `json:"file_name"`
+	FileSize       int64           `json:"file_size"`
+	ChunkSize      int64           `json:"chunk_size"`
+	TotalChunks    int             `json:"total_chunks"`
+	UploadedChunks []int           `json:"uploaded_chunks"`
+	MissingChunks  []int           `json:"missing_chunks"`
+	Chunks         []ChunkProgress `json:"chunks"`
+	Status         string          `json:"status"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+}
+
+func (s SessionStatus) String() string {
+	switch s {
+	case SessionStatusPending:
+		return "pending"
+	case SessionStatusActive:
+		return "active"
+	case SessionStatusCompleted:
+		return "completed"
+	case SessionStatusFailed:
+		return "failed"
+	case SessionStatusExpired:
+		return "expired"
+	case SessionStatusCommitting:
+		return "committing"
+	case SessionStatusStreaming:
+		return "streaming"
+	default:
+		return "unknown"
+	}
+}
+
+func (s *UploadSession) GetStatus() SessionStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Status
+}
+
+func (s *UploadSession) SetStatus(status SessionStatus) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Status = status
+}
+
+// AcceptsChunks returns ErrSessionCompleted or ErrSessionCommitting once the
+// session's chunk map can no longer change.
+func (s *UploadSession) AcceptsChunks() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.sealedLocked()
+}
+
+func (s *UploadSession) sealedLocked() error {
+	switch s.Status {
+	case SessionStatusCompleted:
+		return ErrSessionCompleted
+	case SessionStatusCommitting:
+		return ErrSessionCommitting
+	case SessionStatusStreaming:
+		return ErrSessionStreaming
+	}
+	return nil
+}
+
+// AddStreamedChunk records a chunk of a direct upload as soon as its store
+// finishes, successfully or not, so the upload's progress can be read while
+// the rest of the file is still arriving.
+func (s *UploadSession) AddStreamedChunk(assignment ChunkAssignment) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	assignment.ReplicaWorkers = append([]string{}, assignment.ReplicaWorkers...)
+	s.ChunkAssignment = append(s.ChunkAssignment, assignment)
+	if assignment.Status == "completed" {
+		s.UploadChunks = append(s.UploadChunks, assignment.ChunkIndex)
+		sort.Ints(s.UploadChunks)
+	}
+}
+
+// FinishStream puts the chunk map of a direct upload in order once every
+// chunk has been stored and records the file's size and checksums.
+func (s *UploadSession) FinishStream(fileSize int64, md5Hash, sha256Hash string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sort.Slice(s.ChunkAssignment, func(i, j int) bool {
+		return s.ChunkAssignment[i].ChunkIndex < s.ChunkAssignment[j].ChunkIndex
+	})
+	s.TotalChunks = len(s.ChunkAssignment)
+	s.FileSize = fileSize
+	s.MD5Hash = md5Hash
+	s.SHA256Hash = sha256Hash
+}
+
+// EndStream completes a direct upload or fails it. The upload rolls back
+// the chunks of a failed session itself, so they are never released again
+// when the session expires.
+func (s *UploadSession) EndStream(committed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Status != SessionStatusStreaming {
+		return
+	}
+	if committed {
+		s.Status = SessionStatusCompleted
+	} else {
+		s.Status = SessionStatusFailed
+		s.released = true
+	}
+}
+
+// BeginCommit seals the session for CompleteUpload, so that only one commit
+// runs at a time and no chunk is replaced while it does. Every successful
+// call must be followed by EndCommit.
+func (s *UploadSession) BeginCommit() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.sealedLocked(); err != nil {
+		return err
+	}
+	s.Status = SessionStatusCommitting
+	return nil
+}
+
+// EndCommit completes the session if the commit succeeded and otherwise
+// lets it accept chunks again.
+func (s *UploadSession) EndCommit(committed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Status != SessionStatusCommitting {
+		return
+	}
+	if committed {
+		s.Status = SessionStatusCompleted
+	} else {
+		s.Status = SessionStatusActive
+	}
+}
+
+// Abandon gives up on a session that was not completed, moving it to status
+// (failed or expired). It returns the chunks stored so far the first time
+// it is called, so that they are rolled back exactly once.
+func (s *UploadSession) Abandon(status SessionStatus) ([]ChunkAssignment, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.sealedLocked(); err != nil {
+		return nil, err
+	}
+	s.Status = status
+	if s.released {
+		return nil, nil
+	}
+	s.released = true
+
+	var stored []ChunkAssignment
+	for _, assignment := range s.ChunkAssignment {
+		if assignment.Status == "completed" {
+			assignment.ReplicaWorkers = append([]string{}, assignment.ReplicaWorkers...)
+			stored = append(stored, assignment)
+		}
+	}
+	return stored, nil
+}
+
+// SetVersion records which version of which file the upload became.
+func (s *UploadSession) SetVersion(objectID string, version int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ObjectID = objectID
+	s.Version = version
+}
+
+func (s *UploadSession) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// ExpectedChunkSize returns the number of bytes the client must send for the
+// given chunk; every chunk is ChunkSize long except possibly the last one.
+func (s *UploadSession) ExpectedChunkSize(index int) int64 {
+	if index == s.TotalChunks-1 {
+		if rem := s.FileSize % s.ChunkSize; rem != 0 {
+			return rem
+		}
+	}
+	return s.ChunkSize
+}
+
+func (s *UploadSession) GetAssignment(index int) (ChunkAssignment, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if index < 0 || index >= len(s.ChunkAssignment) {
+		return ChunkAssignment{}, fmt.Errorf("chunk index %d out of range [0, %d)", index, len(s.ChunkAssignment))
+	}
+	return s.ChunkAssignment[index], nil
+}
+
+// IsChunkUploaded reports whether the chunk has already been stored with the
+// given hash, which lets clients safely resend chunks after a dropped request.
+func (s *UploadSession) IsChunkUploaded(index int, md5Hash string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if index < 0 || index >= len(s.ChunkAssignment) {
+		return false
+	}
+	assignment := s.ChunkAssignment[index]
+	return assignment.Status == "completed" && assignment.MD5Expected == md5Hash
+}
+
+// MarkChunkUploaded records the chunk stored for index: its ID, checksum,
+// encoding and the workers holding it, taken from stored. It returns the
+// assignment it replaced, which the caller releases if it was completed.
+func (s *UploadSession) MarkChunkUploaded(index int, stored ChunkAssignment) (ChunkAssignment, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.sealedLocked(); err != nil {
+		return ChunkAssignment{}, err
+	}
+	if s.released {
+		return ChunkAssignment{}, ErrSessionAbandoned
+	}
+	if index < 0 || index >= len(s.ChunkAssignment) {
+		return ChunkAssignment{}, fmt.Errorf("chunk index %d out of range [0, %d)", index, len(s.ChunkAssignment))
+	}
+	if stored.PrimaryWorker == "" && len(stored.ReplicaWorkers) == 0 {
+		return ChunkAssignment{}, fmt.Errorf("chunk %d has no stored replicas", index)
+	}
+
+	assignment := &s.ChunkAssignment[index]
+	replaced := *assignment
+	replaced.ReplicaWorkers = append([]string{}, assignment.ReplicaWorkers...)
+	assignment.ChunkID = stored.ChunkID
+	assignment.PrimaryWorker = stored.PrimaryWorker
+	assignment.ReplicaWorkers = append([]string{}, stored.ReplicaWorkers...)
+	assignment.MD5Expected = stored.MD5Expected
+	assignment.Compression = stored.Compression
+	assignment.StoredSize = stored.StoredSize
+	assignment.DataShards = stored.DataShards
+	assignment.ParityShards = stored.ParityShards
+	assignment.Status = "completed"
+
+	for _, uploaded := range s.UploadChunks {
+		if uploaded == index {
+			return replaced, nil
+		}
+	}
+	s.UploadChunks = append(s.UploadChunks, index)
+	sort.Ints(s.UploadChunks)
+	return replaced, nil
+}
+
+func (s *UploadSession) MarkChunkFailed(index int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if index >= 0 && index < len(s.ChunkAssignment) && s.ChunkAssignment[index].Status != "completed" {
+		s.ChunkAssignment[index].Status = "failed"
+	}
+}
+
+func (s *UploadSession) MissingChunks() []int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.missingChunksLocked()
+}
+
+func (s *UploadSession) missingChunksLocked() []int {
+	missing := []int{}
+	for i, assignment := range s.ChunkAssignment {
+		if assignment.Status != "completed" {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Assignments returns a copy of the chunk map that is safe to read while
+// other chunks of the session are still being uploaded.
+func (s *UploadSession) Assignments() []ChunkAssignment {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	assignments := make([]ChunkAssignment, len(s.ChunkAssignment))
+	for i, assignment := range s.ChunkAssignment {
+		assignment.ReplicaWorkers = append([]string{}, assignment.ReplicaWorkers...)
+		assignments[i] = assignment
+	}
+	return assignments
+}
+
+func (s *UploadSession) Progress() UploadProgress {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return UploadProgress{
+		SessionID:      s.SessionID,
+		FileID:         s.FileID,
+		ObjectID:       s.ObjectID,
+		Version:        s.Version,
+		FileName:       s.FileName,
+		FileSize:       s.FileSize,
+		ChunkSize:      s.ChunkSize,
+		TotalChunks:    s.TotalChunks,
+		UploadedChunks: append([]int{}, s.UploadChunks...),
+		MissingChunks:  s.missingChunksLocked(),
+		Chunks:         s.chunkProgressLocked(),
+		Status:         s.Status.String(),
+		ExpiresAt:      s.ExpiresAt,
+	}
+}
+
+func (s *UploadSession) chunkProgressLocked() []ChunkProgress {
+	chunks := make([]ChunkProgress, 0, len(s.ChunkAssignment))
+	for _, assignment := range s.ChunkAssignment {
+		chunks = append(chunks, ChunkProgress{
+			Index:      assignment.ChunkIndex,
+			Status:     assignment.Status,
+			Size:       assignment.Size,
+			StoredSize: assignment.StoredSize,
+		})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	return chunks
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestSession(chunks int) *UploadSession {
+	return &UploadSession{
+		SessionID:       "session",
+		FileID:          "file",
+		FileSize:        int64(chunks) * 4,
+		ChunkSize:       4,
+		TotalChunks:     chunks,
+		ChunkAssignment: make([]ChunkAssignment, chunks),
+		Status:          SessionStatusActive,
+		CreatedAt:       time.Now(),
+		ExpiresAt:       time.Now().Add(time.Hour),
+	}
+}
+
+func TestMarkChunkUploadedReturnsReplaced(t *testing.T) {
+	session := newTestSession(2)
+
+	first := ChunkAssignment{ChunkID: "a", PrimaryWorker: "w1", MD5Expected: "md5-a"}
+	replaced, err := session.MarkChunkUploaded(0, first)
+	if err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+	if replaced.Status == "completed" {
+		t.Fatalf("first upload replaced a completed chunk: %+v", replaced)
+	}
+
+	second := ChunkAssignment{ChunkID: "b", PrimaryWorker: "w2", MD5Expected: "md5-b"}
+	replaced, err = session.MarkChunkUploaded(0, second)
+	if err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+	if replaced.Status != "completed" || replaced.ChunkID != "a" || replaced.PrimaryWorker != "w1" {
+		t.Fatalf("replaced = %+v, want completed chunk a on w1", replaced)
+	}
+	if got := session.MissingChunks(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("MissingChunks = %v, want [1]", got)
+	}
+}
+
+func TestCommitSealsSession(t *testing.T) {
+	session := newTestSession(1)
+	stored := ChunkAssignment{ChunkID: "a", PrimaryWorker: "w1", MD5Expected: "md5-a"}
+	if _, err := session.MarkChunkUploaded(0, stored); err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+
+	if err := session.BeginCommit(); err != nil {
+		t.Fatalf("BeginCommit: %v", err)
+	}
+	if err := session.BeginCommit(); err != ErrSessionCommitting {
+		t.Fatalf("second BeginCommit = %v, want ErrSessionCommitting", err)
+	}
+	if _, err := session.MarkChunkUploaded(0, ChunkAssignment{ChunkID: "b", PrimaryWorker: "w2"}); err != ErrSessionCommitting {
+		t.Fatalf("MarkChunkUploaded during commit = %v, want ErrSessionCommitting", err)
+	}
+	if _, err := session.Abandon(SessionStatusFailed); err != ErrSessionCommitting {
+		t.Fatalf("Abandon during commit = %v, want ErrSessionCommitting", err)
+	}
+
+	session.EndCommit(false)
+	if err := session.AcceptsChunks(); err != nil {
+		t.Fatalf("AcceptsChunks after failed commit = %v", err)
+	}
+
+	if err := session.BeginCommit(); err != nil {
+		t.Fatalf("BeginCommit retry: %v", err)
+	}
+	session.EndCommit(true)
+	if got := session.GetStatus(); got != SessionStatusCompleted {
+		t.Fatalf("status = %v, want completed", got)
+	}
+	if _, err := session.MarkChunkUploaded(0, ChunkAssignment{ChunkID: "b", PrimaryWorker: "w2"}); err != ErrSessionCompleted {
+		t.Fatalf("MarkChunkUploaded after commit = %v, want ErrSessionCompleted", err)
+	}
+	if got, _ := session.GetAssignment(0); got.ChunkID != "a" {
+		t.Fatalf("committed chunk was replaced by %q", got.ChunkID)
+	}
+}
+
+func TestAbandonReleasesChunksOnce(t *testing.T) {
+	session := newTestSession(2)
+	stored := ChunkAssignment{ChunkID: "a", PrimaryWorker: "w1", MD5Expected: "md5-a"}
+	if _, err := session.MarkChunkUploaded(1, stored); err != nil {
+		t.Fatalf("MarkChunkUploaded: %v", err)
+	}
+
+	released, err := session.Abandon(SessionStatusFailed)
+	if err != nil {
+		t.Fatalf("Abandon: %v", err)
+	}
+	if len(released) != 1 || released[0].ChunkID != "a" {
+		t.Fatalf("Abandon released %+v, want chunk a", released)
+	}
+
+	released, err = session.Abandon(SessionStatusExpired)
+	if err != nil || len(released) != 0 {
+		t.Fatalf("second Abandon = %+v, %v; want nothing", released, err)
+	}
+	if got := session.GetStatus(); got != SessionStatusExpired {
+		t.Fatalf("status = %v, want expired", got)
+	}
+	if _, err := session.MarkChunkUploaded(0, stored); err != ErrSessionAbandoned {
+		t.Fatalf("MarkChunkUploaded after Abandon = %v, want ErrSessionAbandoned", err)
+	}
+}
+
+func TestStreamedSessionReportsChunkProgress(t *testing.T) {
+	session := &UploadSession{SessionID: "session", FileID: "file", Status: SessionStatusStreaming}
+
+	// Chunks finish out of order.
+	session.AddStreamedChunk(ChunkAssignment{ChunkIndex: 1, ChunkID: "b", PrimaryWorker: "w1", Size: 4, StoredSize: 3, Status: "completed"})
+	session.AddStreamedChunk(ChunkAssignment{ChunkIndex: 0, ChunkID: "a", PrimaryWorker: "w2", Size: 4, StoredSize: 4, Status: "completed"})
+
+	progress := session.Progress()
+	if progress.Status != "streaming" || len(progress.UploadedChunks) != 2 || progress.UploadedChunks[0] != 0 {
+		t.Fatalf("progress = %+v, want chunks 0 and 1 uploaded while streaming", progress)
+	}
+	if len(progress.Chunks) != 2 || progress.Chunks[0].Index != 0 || progress.Chunks[1].StoredSize != 3 {
+		t.Fatalf("chunks = %+v, want chunk 0 and chunk 1 stored in 3 bytes", progress.Chunks)
+	}
+
+	if _, err := session.MarkChunkUploaded(0, ChunkAssignment{ChunkID: "c", PrimaryWorker: "w3"}); err != ErrSessionStreaming {
+		t.Fatalf("MarkChunkUploaded while streaming = %v, want ErrSessionStreaming", err)
+	}
+	if _, err := session.Abandon(SessionStatusFailed); err != ErrSessionStreaming {
+		t.Fatalf("Abandon while streaming = %v, want ErrSessionStreaming", err)
+	}
+
+	session.FinishStream(8, "md5", "sha256")
+	if session.TotalChunks != 2 || session.ChunkAssignment[0].ChunkID != "a" {
+		t.Fatalf("chunk map after FinishStream = %+v, want a then b", session.ChunkAssignment)
+	}
+	session.EndStream(true)
+	session.EndStream(false)
+	if session.GetStatus() != SessionStatusCompleted {
+		t.Fatalf("status = %v, want completed", session.GetStatus())
+	}
+}
+
+func TestFailedStreamIsNotReleasedAgain(t *testing.T) {
+	session := &UploadSession{SessionID: "session", FileID: "file", Status: SessionStatusStreaming}
+	session.AddStreamedChunk(ChunkAssignment{ChunkIndex: 0, ChunkID: "a", PrimaryWorker: "w1", Status: "completed"})
+	session.AddStreamedChunk(ChunkAssignment{ChunkIndex: 1, ChunkID: "b", PrimaryWorker: "w1", Status: "failed"})
+	if missing := session.MissingChunks(); len(missing) != 1 || missing[0] != 1 {
+		t.Fatalf("MissingChunks = %v, want [1]", missing)
+	}
+
+	// The upload rolls back its own chunks when it fails.
+	session.EndStream(false)
+	if session.GetStatus() != SessionStatusFailed {
+		t.Fatalf("status = %v, want failed", session.GetStatus())
+	}
+	if stored, err := session.Abandon(SessionStatusExpired); err != nil || len(stored) != 0 {
+		t.Fatalf("Abandon = %v, %v; want nothing left to release", stored, err)
+	}
+}
@@ -16,6 +16,21 @@ const (
 	WorkerStatusFailed
 )
 
+func (s WorkerStatus) String() string {
+	switch s {
+	case WorkerStatusOnline:
+		return "online"
+	case WorkerStatusOffline:
+		return "offline"
+	case WorkerStatusDraining:
+		return "draining"
+	case WorkerStatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
 type WorkerNode struct {
 	ID               string        `json:"id"`
 	Address          string        `json:"address"`
@@ -29,6 +44,9 @@ type WorkerNode struct {
 	MemoryUsage      float64       `json:"memory_usage"`
 	Version          string        `json:"version"`
 	Capabilities     []string      `json:"capabilities"`
+	// Labels are the key/value pairs the worker registered with, such as
+	// its zone.
+	Labels           map[string]string `json:"labels,omitempty"`
 
 	mutex          sync.Mutex      `json:"-"`
 	ConnectionPool interface{}     `json:"-"` 
@@ -42,23 +60,66 @@ const (
 	SessionStatusCompleted
 	SessionStatusFailed
 	SessionStatusExpired
+	// SessionStatusCommitting is held while CompleteUpload verifies and
+	// commits the session; its chunks cannot change in the meantime.
+	SessionStatusCommitting
+	// SessionStatusStreaming is held while a direct upload stores the
+	// file's chunks as they arrive. Only the upload itself changes the
+	// session until it ends.
+	SessionStatusStreaming
 )
 
 type ChunkAssignment struct {
 	ChunkIndex     int      `json:"chunk_index"`
+	ChunkID        string   `json:"chunk_id,omitempty"`
+	Size           int64    `json:"size"`
 	PrimaryWorker  string   `json:"primary_worker"`
 	ReplicaWorkers []string `json:"replica_workers"`
 	MD5Expected    string   `json:"md5_expected"`
 	Status         string   `json:"status"` 
+	
+	// Compression is the codec the chunk is stored with on its own and
+	// StoredSize its size on the workers; Size is always the original size.
+	Compression string `json:"compression,omitempty"`
+	StoredSize  int64  `json:"stored_size,omitempty"`
+	
+	// DataShards is set for erasure-coded chunks. Their PrimaryWorker and
+	// ReplicaWorkers hold the worker of each shard in shard order, "" for
+	// a missing shard.
+	DataShards   int `json:"data_shards,omitempty"`
+	ParityShards int `json:"parity_shards,omitempty"`
 }
 
 type UploadSession struct {
 	SessionID       string             `json:"session_id"`
+	FileID          string             `json:"file_id"`
 	UserID          string             `json:"user_id"`
 	FileName        string             `json:"file_name"`
+	// Path is the folder the file is uploaded into, "" for the root.
+	Path            string             `json:"path,omitempty"`
 	FileSize        int64              `json:"file_size"`
 	ChunkSize       int64              `json:"chunk_size"`
 	TotalChunks     int                `json:"total_chunks"`
+	// Compressed marks files stored as one compressed stream cut into
+	// chunks, as done before chunks were compressed individually;
+	// Compression names the stream's codec.
+	Compressed      bool               `json:"compressed"`
+	Compression     string             `json:"compression,omitempty"`
+	// StorageMode is "replication" or "erasure", for new chunks of the file.
+	StorageMode     string             `json:"storage_mode,omitempty"`
+	MD5Hash         string             `json:"md5_hash"`
+	SHA256Hash      string             `json:"sha256_hash"`
+	// ObjectID and Version identify the file version the upload became,
+	// once it is completed.
+	ObjectID        string             `json:"object_id,omitempty"`
+	Version         int64              `json:"version,omitempty"`
+	
+	// DataKey encrypts the file's chunks and is only ever kept in memory;
+	// WrappedDataKey is its persisted form, wrapped with master key
+	// EncryptionKeyID. All three are empty for unencrypted files.
+	DataKey         []byte             `json:"-"`
+	EncryptionKeyID string             `json:"encryption_key_id,omitempty"`
+	WrappedDataKey  []byte             `json:"-"`
 	ChunkAssignment []ChunkAssignment  `json:"chunk_assignment"`
 	UploadChunks    []int              `json:"upload_chunks"` 
 	Status          SessionStatus      `json:"status"`
@@ -66,6 +127,7 @@ type UploadSession struct {
 	ExpiresAt       time.Time          `json:"expires_at"`
 
 	mutex     sync.RWMutex          `json:"-"`
+	released  bool
 	ChunkChan chan ChunkComplete    `json:"-"`
 	ErrorChan chan error            `json:"-"`
 }
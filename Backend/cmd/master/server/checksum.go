@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Headers a client can set on a direct upload to have the master check the
+// whole-file digest before the file is committed.
+const (
+	headerExpectedSHA256 = "X-File-SHA256"
+	headerExpectedMD5    = "X-File-MD5"
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// fileDigest computes the SHA-256 and MD5 of a file in one pass. MD5 is kept
+// for clients that still compare against files.md5_hash.
+type fileDigest struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	w      io.Writer
+}
+
+func newFileDigest() *fileDigest {
+	d := &fileDigest{md5: md5.New(), sha256: sha256.New()}
+	d.w = io.MultiWriter(d.md5, d.sha256)
+	return d
+}
+
+func (d *fileDigest) Write(p []byte) (int, error) {
+	return d.w.Write(p)
+}
+
+// Sums returns the hex encoded MD5 and SHA-256 of everything written so far.
+func (d *fileDigest) Sums() (md5Hex, sha256Hex string) {
+	return hex.EncodeToString(d.md5.Sum(nil)), hex.EncodeToString(d.sha256.Sum(nil))
+}
+
+// expectedChecksums holds the digests a client claims the file has. Empty
+// fields are not checked.
+type expectedChecksums struct {
+	MD5    string
+	SHA256 string
+}
+
+func newExpectedChecksums(md5Hex, sha256Hex string) (expectedChecksums, error) {
+	expected := expectedChecksums{
+		MD5:    strings.ToLower(strings.TrimSpace(md5Hex)),
+		SHA256: strings.ToLower(strings.TrimSpace(sha256Hex)),
+	}
+	if expected.MD5 != "" && !isHexDigest(expected.MD5, md5.Size) {
+		return expected, fmt.Errorf("invalid MD5 checksum %q", md5Hex)
+	}
+	if expected.SHA256 != "" && !isHexDigest(expected.SHA256, sha256.Size) {
+		return expected, fmt.Errorf("invalid SHA-256 checksum %q", sha256Hex)
+	}
+	return expected, nil
+}
+
+// Verify compares the computed digests with the expected ones.
+func (e expectedChecksums) Verify(md5Hex, sha256Hex string) error {
+	if e.SHA256 != "" && e.SHA256 != sha256Hex {
+		return fmt.Errorf("%w: expected SHA-256 %s, got %s", errChecksumMismatch, e.SHA256, sha256Hex)
+	}
+	if e.MD5 != "" && e.MD5 != md5Hex {
+		return fmt.Errorf("%w: expected MD5 %s, got %s", errChecksumMismatch, e.MD5, md5Hex)
+	}
+	return nil
+}
+
+func isHexDigest(s string, size int) bool {
+	decoded, err := hex.DecodeString(s)
+	return err == nil && len(decoded) == size
+}
+
+// setIntegrityHeaders advertises the stored digests as a strong ETag and an
+// RFC 3230 Digest header.
+func setIntegrityHeaders(w http.ResponseWriter, md5Hex, sha256Hex string) {
+	if sha256Hex != "" {
+		w.Header().Set("ETag", `"`+sha256Hex+`"`)
+	}
+
+	var digests []string
+	if sum, err := hex.DecodeString(sha256Hex); err == nil && len(sum) == sha256.Size {
+		digests = append(digests, "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	}
+	if sum, err := hex.DecodeString(md5Hex); err == nil && len(sum) == md5.Size {
+		digests = append(digests, "md5="+base64.StdEncoding.EncodeToString(sum))
+	}
+	if len(digests) > 0 {
+		w.Header().Set("Digest", strings.Join(digests, ","))
+	}
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyingReader hashes a stream while it is read and checks the result at
+// EOF. The last byte is held back until the digest has been verified, so a
+// corrupted file is never delivered in full: the client sees a short body
+// instead of silently accepting bad data.
+type verifyingReader struct {
+	r        io.Reader
+	digest   *fileDigest
+	expected expectedChecksums
+
+	buf        []byte
+	start, end int
+	verified   bool
+	err        error
+}
+
+func newVerifyingReader(r io.Reader, expected expectedChecksums) *verifyingReader {
+	return &verifyingReader{
+		r:        r,
+		digest:   newFileDigest(),
+		expected: expected,
+		buf:      make([]byte, 32*1024+1),
+	}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		holdBack := 1
+		if v.verified {
+			holdBack = 0
+		}
+		if v.end-v.start > holdBack {
+			n := copy(p, v.buf[v.start:v.end-holdBack])
+			v.start += n
+			return n, nil
+		}
+		if v.verified {
+			return 0, io.EOF
+		}
+		if v.err != nil {
+			return 0, v.err
+		}
+
+		// Keep the held back byte at the front and refill behind it.
+		v.end = copy(v.buf, v.buf[v.start:v.end])
+		v.start = 0
+
+		n, err := v.r.Read(v.buf[v.end:])
+		v.digest.Write(v.buf[v.end : v.end+n])
+		v.end += n
+
+		switch {
+		case err == io.EOF:
+			if verr := v.expected.Verify(v.digest.Sums()); verr != nil {
+				v.err = verr
+			} else {
+				v.verified = true
+			}
+		case err != nil:
+			v.err = err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func sums(data []byte) (md5Hex, sha256Hex string) {
+	m, s := md5.Sum(data), sha256.Sum256(data)
+	return hex.EncodeToString(m[:]), hex.EncodeToString(s[:])
+}
+
+func TestVerifyingReader(t *testing.T) {
+	data := make([]byte, 100*1024)
+	rand.New(rand.NewSource(9)).Read(data)
+	md5Hex, sha256Hex := sums(data)
+	otherMD5, otherSHA256 := sums([]byte("something else"))
+
+	tests := []struct {
+		name     string
+		expected expectedChecksums
+		wantErr  bool
+	}{
+		{name: "nothing expected", expected: expectedChecksums{}},
+		{name: "both match", expected: expectedChecksums{MD5: md5Hex, SHA256: sha256Hex}},
+		{name: "SHA-256 mismatch", expected: expectedChecksums{SHA256: otherSHA256}, wantErr: true},
+		{name: "MD5 mismatch", expected: expectedChecksums{MD5: otherMD5, SHA256: sha256Hex}, wantErr: true},
+	}
+
+	readers := map[string]func() io.Reader{
+		"large reads": func() io.Reader { return bytes.NewReader(data) },
+		"byte reads":  func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) },
+		"data at EOF": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(data)) },
+	}
+
+	for _, tt := range tests {
+		for readerName, newReader := range readers {
+			t.Run(tt.name+"/"+readerName, func(t *testing.T) {
+				got, err := io.ReadAll(newVerifyingReader(newReader(), tt.expected))
+				if !tt.wantErr {
+					if err != nil || !bytes.Equal(got, data) {
+						t.Fatalf("read %d of %d bytes, error %v; want the whole file", len(got), len(data), err)
+					}
+					return
+				}
+				if !errors.Is(err, errChecksumMismatch) {
+					t.Fatalf("error = %v, want a checksum mismatch", err)
+				}
+				// The last byte is withheld, so a client never gets the
+				// whole of a corrupted file.
+				if !bytes.Equal(got, data[:len(data)-1]) {
+					t.Fatalf("read %d bytes before the mismatch, want %d", len(got), len(data)-1)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyingReaderEmptyFile(t *testing.T) {
+	md5Hex, sha256Hex := sums(nil)
+	if got, err := io.ReadAll(newVerifyingReader(bytes.NewReader(nil), expectedChecksums{MD5: md5Hex, SHA256: sha256Hex})); err != nil || len(got) != 0 {
+		t.Fatalf("empty file: read %d bytes, error %v", len(got), err)
+	}
+
+	_, otherSHA256 := sums([]byte("x"))
+	if _, err := io.ReadAll(newVerifyingReader(bytes.NewReader(nil), expectedChecksums{SHA256: otherSHA256})); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("empty file with a wrong digest: error = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestVerifyingReaderPassesReadErrors(t *testing.T) {
+	failure := errors.New("worker went away")
+	r := io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(failure))
+
+	got, err := io.ReadAll(newVerifyingReader(r, expectedChecksums{}))
+	if !errors.Is(err, failure) {
+		t.Fatalf("error = %v, want %v", err, failure)
+	}
+	if string(got) != "partia" {
+		t.Fatalf("read %q before the error, want everything but the held back byte", got)
+	}
+}
+
+func TestNewExpectedChecksums(t *testing.T) {
+	md5Hex, sha256Hex := sums([]byte("data"))
+
+	expected, err := newExpectedChecksums(" "+strings.ToUpper(md5Hex)+" ", strings.ToUpper(sha256Hex))
+	if err != nil {
+		t.Fatalf("newExpectedChecksums: %v", err)
+	}
+	if expected.MD5 != md5Hex || expected.SHA256 != sha256Hex {
+		t.Errorf("digests not normalized: %+v", expected)
+	}
+	if err := expected.Verify(md5Hex, sha256Hex); err != nil {
+		t.Errorf("Verify of matching digests: %v", err)
+	}
+	otherMD5, otherSHA256 := sums([]byte("other"))
+	if err := expected.Verify(md5Hex, otherSHA256); !errors.Is(err, errChecksumMismatch) {
+		t.Errorf("Verify of a different SHA-256 = %v, want a checksum mismatch", err)
+	}
+	if err := expected.Verify(otherMD5, sha256Hex); !errors.Is(err, errChecksumMismatch) {
+		t.Errorf("Verify of a different MD5 = %v, want a checksum mismatch", err)
+	}
+
+	for _, tt := range []struct{ md5, sha256 string }{
+		{md5: "abc"},
+		{md5: sha256Hex},
+		{sha256: md5Hex},
+		{sha256: "zz" + sha256Hex[2:]},
+	} {
+		if _, err := newExpectedChecksums(tt.md5, tt.sha256); err == nil {
+			t.Errorf("newExpectedChecksums(%q, %q) accepted an invalid digest", tt.md5, tt.sha256)
+		}
+	}
+}
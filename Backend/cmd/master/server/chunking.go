@@ -0,0 +1,47 @@
+package main
+
+import (
+	fileops "echofs/pkg/fileops/Chunker"
+	"echofs/pkg/fileops/Compressor"
+)
+
+// chunkerForUpload picks the chunker for an upload. A mode requested by the
+// client wins over the configured policy. The returned size is the nominal
+// chunk size recorded with the file: the fixed size, or the average size for
+// content-defined chunks.
+func (s *Server) chunkerForUpload(requested string) (fileops.StreamChunker, string, int64, error) {
+	mode, chunkSize := fileops.ChunkingFixed, 1024*1024
+	minSize, avgSize, maxSize := 256*1024, 1024*1024, 4*1024*1024
+	if cfg := s.masterNode.Config(); cfg != nil {
+		if cfg.ChunkingMode != "" {
+			mode = cfg.ChunkingMode
+		}
+		chunkSize = cfg.ChunkSize
+		minSize, avgSize, maxSize = cfg.CDCMinChunkSize, cfg.CDCAvgChunkSize, cfg.CDCMaxChunkSize
+	}
+	if requested != "" {
+		mode = requested
+	}
+
+	chunker, err := fileops.NewStreamChunker(mode, chunkSize, minSize, avgSize, maxSize)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if mode == fileops.ChunkingCDC {
+		return chunker, mode, int64(avgSize), nil
+	}
+	return chunker, fileops.ChunkingFixed, int64(chunkSize), nil
+}
+
+// codecForUpload picks the compression codec for an upload, preferring the
+// one requested by the client over the configured default.
+func (s *Server) codecForUpload(requested string) (compressor.Codec, error) {
+	name := compressor.CodecGzip
+	if cfg := s.masterNode.Config(); cfg != nil && cfg.CompressionCodec != "" {
+		name = cfg.CompressionCodec
+	}
+	if requested != "" {
+		name = requested
+	}
+	return compressor.GetCodec(name)
+}
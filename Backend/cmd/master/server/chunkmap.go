@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+	"echofs/pkg/database"
+)
+
+const (
+	compressionNone = "none"
+	// compressionStreamSuffix follows the codec name on chunks cut from a
+	// single compressed stream of the whole file, e.g. "gzip-stream"; they
+	// can only be decoded in order.
+	compressionStreamSuffix = "-stream"
+)
+
+// chunkRefs converts a session's chunk map into the rows persisted alongside
+// the file, recording where each chunk starts in the original and in the
+// stored bytes.
+func chunkRefs(session *core.UploadSession) []metadata.ChunkRef {
+	streamCompression := ""
+	if session.Compressed {
+		streamCompression = session.Compression + compressionStreamSuffix
+		if session.Compression == "" {
+			streamCompression = "gzip" + compressionStreamSuffix
+		}
+	}
+
+	assignments := session.Assignments()
+	refs := make([]metadata.ChunkRef, 0, len(assignments))
+	var offset, storedOffset int64
+	for _, assignment := range assignments {
+		_, chunkID, _ := chunkLocation(session.FileID, assignment)
+
+		compression := assignment.Compression
+		if streamCompression != "" {
+			compression = streamCompression
+		} else if compression == "" {
+			compression = compressionNone
+		}
+		storedSize := assignment.StoredSize
+		if storedSize == 0 {
+			storedSize = assignment.Size
+		}
+
+		refs = append(refs, metadata.ChunkRef{
+			ChunkID:      chunkID,
+			Index:        assignment.ChunkIndex,
+			Size:         assignment.Size,
+			Offset:       offset,
+			StoredSize:   storedSize,
+			StoredOffset: storedOffset,
+			Checksum:     assignment.MD5Expected,
+			Compression:  compression,
+			DataShards:   assignment.DataShards,
+			ParityShards: assignment.ParityShards,
+			Workers:      append([]string{assignment.PrimaryWorker}, assignment.ReplicaWorkers...),
+			Version:      1,
+		})
+		offset += assignment.Size
+		storedOffset += storedSize
+	}
+	return refs
+}
+
+// sessionFromMetadata rebuilds a completed session from the persisted file
+// and chunk rows so downloads keep working after the in-memory session has
+// expired or the master restarted.
+func sessionFromMetadata(file *metadata.FileMetadata, chunks []metadata.ChunkRef) *core.UploadSession {
+	session := &core.UploadSession{
+		SessionID:       file.FileID,
+		FileID:          file.FileID,
+		UserID:          file.OwnerID,
+		FileName:        file.OriginalName,
+		FileSize:        file.Size,
+		ChunkSize:       int64(file.ChunkSize),
+		TotalChunks:     file.TotalChunks,
+		MD5Hash:         file.MD5Hash,
+		SHA256Hash:      file.SHA256Hash,
+		EncryptionKeyID: file.EncryptionKeyID,
+		WrappedDataKey:  file.WrappedDataKey,
+		Status:          core.SessionStatusCompleted,
+		CreatedAt:       file.CreatedAt,
+		ExpiresAt:       time.Now().Add(time.Hour),
+	}
+
+	for _, chunk := range chunks {
+		assignment := core.ChunkAssignment{
+			ChunkIndex:     chunk.Index,
+			ChunkID:        chunk.ChunkID,
+			Size:           chunk.Size,
+			ReplicaWorkers: []string{},
+			MD5Expected:    chunk.Checksum,
+			Status:         "completed",
+			Compression:    chunk.Compression,
+			StoredSize:     chunk.StoredSize,
+			DataShards:     chunk.DataShards,
+			ParityShards:   chunk.ParityShards,
+		}
+		if codec, ok := strings.CutSuffix(chunk.Compression, compressionStreamSuffix); ok {
+			session.Compressed = true
+			session.Compression = codec
+			assignment.Compression = compressionNone
+		}
+		if len(chunk.Workers) > 0 {
+			assignment.PrimaryWorker = chunk.Workers[0]
+			assignment.ReplicaWorkers = chunk.Workers[1:]
+		}
+		session.ChunkAssignment = append(session.ChunkAssignment, assignment)
+		session.UploadChunks = append(session.UploadChunks, chunk.Index)
+	}
+
+	return session
+}
+
+// lookupChunkMap finds the chunk map of a committed file. The metadata store
+// is authoritative once the file is committed, since shard repair updates
+// worker lists there; the in-memory session is only used without a store or
+// for files the store does not know.
+func (s *Server) lookupChunkMap(ctx context.Context, fileID string) (*core.UploadSession, error) {
+	if s.fileRepo == nil {
+		return s.completedSession(fileID), nil
+	}
+
+	file, err := s.fileRepo.GetFileByID(ctx, fileID)
+	if err == database.ErrUserNotFound {
+		return s.completedSession(fileID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := s.fileRepo.GetChunks(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return s.completedSession(fileID), nil
+	}
+
+	session := sessionFromMetadata(file, chunks)
+	if err := s.unwrapFileKey(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// completedSession returns the in-memory session that committed fileID, or
+// nil once it has expired.
+func (s *Server) completedSession(fileID string) *core.UploadSession {
+	if session, exists := s.masterNode.GetCompletedSessionByFileID(fileID); exists {
+		return session
+	}
+	return nil
+}
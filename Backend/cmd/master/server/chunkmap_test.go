@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+)
+
+func TestChunkRefsOffsets(t *testing.T) {
+	session := &core.UploadSession{
+		FileID: "file",
+		ChunkAssignment: []core.ChunkAssignment{
+			{ChunkIndex: 0, ChunkID: "sha256-a", Size: 100, StoredSize: 40, Compression: "zstd", PrimaryWorker: "w1"},
+			// Stored uncompressed, so its stored size is its size.
+			{ChunkIndex: 1, ChunkID: "sha256-b", Size: 50, PrimaryWorker: "w2", ReplicaWorkers: []string{"w3"}},
+			{ChunkIndex: 2, ChunkID: "sha256-c", Size: 70, StoredSize: 30, Compression: "zstd", PrimaryWorker: "w1"},
+		},
+	}
+
+	refs := chunkRefs(session)
+	want := []struct {
+		offset, storedSize, storedOffset int64
+		compression                      string
+	}{
+		{offset: 0, storedSize: 40, storedOffset: 0, compression: "zstd"},
+		{offset: 100, storedSize: 50, storedOffset: 40, compression: compressionNone},
+		{offset: 150, storedSize: 30, storedOffset: 90, compression: "zstd"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("chunkRefs returned %d chunks, want %d", len(refs), len(want))
+	}
+	for i, ref := range refs {
+		w := want[i]
+		if ref.Offset != w.offset || ref.StoredSize != w.storedSize || ref.StoredOffset != w.storedOffset || ref.Compression != w.compression {
+			t.Errorf("chunk %d: offset %d, stored %d at %d, %s; want offset %d, stored %d at %d, %s",
+				i, ref.Offset, ref.StoredSize, ref.StoredOffset, ref.Compression,
+				w.offset, w.storedSize, w.storedOffset, w.compression)
+		}
+	}
+	if got := refs[1].Workers; len(got) != 2 || got[0] != "w2" || got[1] != "w3" {
+		t.Errorf("chunk 1 workers = %v, want [w2 w3]", got)
+	}
+}
+
+func TestChunkRefsStreamCompression(t *testing.T) {
+	session := &core.UploadSession{
+		FileID:     "file",
+		Compressed: true,
+		ChunkAssignment: []core.ChunkAssignment{
+			{ChunkIndex: 0, Size: 10},
+			{ChunkIndex: 1, Size: 10},
+		},
+	}
+
+	for _, ref := range chunkRefs(session) {
+		if ref.Compression != "gzip"+compressionStreamSuffix {
+			t.Errorf("chunk %d compression = %q, want gzip%s", ref.Index, ref.Compression, compressionStreamSuffix)
+		}
+	}
+
+	// Reading the map back recovers the whole-file codec.
+	file := &metadata.FileMetadata{FileID: "file"}
+	restored := sessionFromMetadata(file, chunkRefs(session))
+	if !restored.Compressed || restored.Compression != "gzip" {
+		t.Errorf("restored session compressed %v with %q, want gzip", restored.Compressed, restored.Compression)
+	}
+	for _, assignment := range restored.ChunkAssignment {
+		if assignment.Compression != compressionNone {
+			t.Errorf("chunk %d compression = %q, want %q", assignment.ChunkIndex, assignment.Compression, compressionNone)
+		}
+	}
+}
+
+func TestCoveringChunks(t *testing.T) {
+	// Chunks of 100, 50 and 70 bytes, as content-defined chunking cuts them.
+	offsets, ok := chunkOffsets([]core.ChunkAssignment{{Size: 100}, {Size: 50}, {Size: 70}})
+	if !ok {
+		t.Fatal("chunkOffsets rejected chunks with sizes")
+	}
+
+	tests := []struct {
+		name          string
+		start, length int64
+		first, last   int
+		ok            bool
+	}{
+		{name: "whole file", start: 0, length: 220, first: 0, last: 2, ok: true},
+		{name: "inside the first chunk", start: 10, length: 20, first: 0, last: 0, ok: true},
+		{name: "ends on a boundary", start: 0, length: 100, first: 0, last: 0, ok: true},
+		{name: "starts on a boundary", start: 100, length: 1, first: 1, last: 1, ok: true},
+		{name: "spans a boundary", start: 99, length: 2, first: 0, last: 1, ok: true},
+		{name: "last byte", start: 219, length: 1, first: 2, last: 2, ok: true},
+		{name: "past the end", start: 220, length: 1, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last, ok := coveringChunks(offsets, tt.start, tt.length)
+			if ok != tt.ok || (ok && (first != tt.first || last != tt.last)) {
+				t.Errorf("coveringChunks(%d, %d) = %d, %d, %v; want %d, %d, %v",
+					tt.start, tt.length, first, last, ok, tt.first, tt.last, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := chunkOffsets([]core.ChunkAssignment{{Size: 100}, {}}); ok {
+		t.Error("chunkOffsets accepted a chunk without a size")
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+	"echofs/internal/replication"
+	"echofs/pkg/fileops/Compressor"
+)
+
+// Content-addressed chunks are stored on the workers under a shared file ID
+// so that every file referencing a chunk finds it at the same key.
+const (
+	chunkNamespace     = "chunks"
+	contentChunkPrefix = "sha256-"
+)
+
+// contentChunkID derives a chunk's ID from its SHA-256, so identical chunks
+// of different files and users share one stored copy.
+func contentChunkID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return contentChunkPrefix + hex.EncodeToString(sum[:])
+}
+
+func isContentChunkID(chunkID string) bool {
+	return strings.HasPrefix(chunkID, contentChunkPrefix) || isKeyedChunkID(chunkID)
+}
+
+// chunkLocation returns the file ID, chunk ID and index a chunk is stored
+// under on the workers. Chunks written before content addressing live under
+// their file's ID, which their recorded chunk ID starts with.
+func chunkLocation(fileID string, assignment core.ChunkAssignment) (string, string, int) {
+	if isContentChunkID(assignment.ChunkID) {
+		return chunkNamespace, assignment.ChunkID, 0
+	}
+	if i := strings.LastIndex(assignment.ChunkID, "_chunk_"); i > 0 {
+		return assignment.ChunkID[:i], assignment.ChunkID, assignment.ChunkIndex
+	}
+	return fileID, fmt.Sprintf("%s_chunk_%d", fileID, assignment.ChunkIndex), assignment.ChunkIndex
+}
+
+// storedChunk describes a chunk written by storeChunk. For erasure-coded
+// chunks Workers lists the worker of each shard.
+type storedChunk struct {
+	ChunkID      string
+	Workers      []string
+	Compression  string
+	StoredSize   int64
+	DataShards   int
+	ParityShards int
+	Deduped      bool
+}
+
+// assignment describes the stored chunk as chunk index of a file.
+func (c storedChunk) assignment(index int, size int64, md5Hash string) core.ChunkAssignment {
+	assignment := core.ChunkAssignment{
+		ChunkIndex:     index,
+		ChunkID:        c.ChunkID,
+		Size:           size,
+		ReplicaWorkers: []string{},
+		MD5Expected:    md5Hash,
+		Status:         "completed",
+		Compression:    c.Compression,
+		StoredSize:     c.StoredSize,
+		DataShards:     c.DataShards,
+		ParityShards:   c.ParityShards,
+	}
+	if len(c.Workers) > 0 {
+		assignment.PrimaryWorker = c.Workers[0]
+		assignment.ReplicaWorkers = c.Workers[1:]
+	}
+	return assignment
+}
+
+// storeChunk stores data as a content-addressed chunk compressed with codec
+// and, for encrypted files, sealed with dataKey. The result is replicated,
+// or split into shards when erasure is set. It returns the chunk's ID and
+// the workers holding it. If an identical chunk is already stored on enough
+// registered workers no bytes are sent and Deduped is set; the chunk keeps
+// the encoding and layout it was first stored with. Whenever a chunk ID is
+// returned, also on error, a reference has been taken on it that must be
+// handed to a file or given back with rollbackChunks.
+func (s *Server) storeChunk(ctx context.Context, data []byte, md5Hash string, codec compressor.Codec, dataKey []byte, erasure *replication.ReedSolomon) (storedChunk, error) {
+	chunk := storedChunk{ChunkID: chunkIDFor(dataKey, data)}
+
+	// The ID covers the original bytes so that the same content is shared
+	// whatever it was compressed with; the workers check the stored bytes.
+	encoded, compression := encodeChunk(codec, data)
+	sealed, err := sealChunk(dataKey, chunk.ChunkID, encoded)
+	if err != nil {
+		return storedChunk{}, err
+	}
+	chunk.Compression = compression
+	chunk.StoredSize = int64(len(sealed))
+	if erasure != nil {
+		chunk.DataShards = erasure.DataShards()
+		chunk.ParityShards = erasure.ParityShards()
+	}
+
+	if s.fileRepo != nil {
+		acquireCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		existing, err := s.fileRepo.AcquireChunk(acquireCtx, metadata.ChunkRef{
+			ChunkID:      chunk.ChunkID,
+			Size:         int64(len(data)),
+			Checksum:     md5Hash,
+			Compression:  compression,
+			StoredSize:   chunk.StoredSize,
+			DataShards:   chunk.DataShards,
+			ParityShards: chunk.ParityShards,
+		})
+		cancel()
+		if err != nil {
+			return storedChunk{}, fmt.Errorf("failed to reference chunk %s: %w", chunk.ChunkID, err)
+		}
+		if existing != nil && s.chunkAvailable(*existing) {
+			chunk.Workers = existing.Workers
+			chunk.Compression = existing.Compression
+			chunk.StoredSize = existing.StoredSize
+			chunk.DataShards = existing.DataShards
+			chunk.ParityShards = existing.ParityShards
+			chunk.Deduped = true
+			return chunk, nil
+		}
+		if existing != nil && existing.Compression != compression {
+			// Rewrite the chunk with the encoding it is recorded with.
+			if encoded, err = encodeChunkWith(existing.Compression, data); err != nil {
+				return chunk, err
+			}
+			if sealed, err = sealChunk(dataKey, chunk.ChunkID, encoded); err != nil {
+				return chunk, err
+			}
+			chunk.Compression = existing.Compression
+			chunk.StoredSize = int64(len(sealed))
+		}
+		if existing != nil && existing.DataShards != chunk.DataShards {
+			// Likewise keep the recorded layout.
+			erasure = nil
+			if existing.DataShards > 0 {
+				if erasure, err = erasureCode(existing.DataShards, existing.ParityShards); err != nil {
+					return chunk, err
+				}
+			}
+			chunk.DataShards = existing.DataShards
+			chunk.ParityShards = existing.ParityShards
+		}
+	}
+
+	if erasure != nil {
+		stored, err := s.storeChunkShards(ctx, chunk.ChunkID, sealed, erasure)
+		chunk.Workers = stored
+		if err != nil {
+			return chunk, err
+		}
+		if err := s.recordChunkWorkers(ctx, chunk.ChunkID, stored); err != nil {
+			return chunk, err
+		}
+		if slices.Contains(stored, "") {
+			s.queueShardRepair(chunk.assignment(0, int64(len(data)), md5Hash))
+		}
+		return chunk, nil
+	}
+
+	storedMD5 := md5Hash
+	if chunk.Compression != compressionNone || dataKey != nil {
+		hash := md5.Sum(sealed)
+		storedMD5 = hex.EncodeToString(hash[:])
+	}
+
+	placement := s.placeChunk(chunk.ChunkID)
+	stored, err := s.storeChunkReplicas(ctx, chunk.ChunkID, sealed, storedMD5, placement)
+	chunk.Workers = stored
+	if err != nil {
+		return chunk, err
+	}
+
+	return chunk, s.recordChunkWorkers(ctx, chunk.ChunkID, stored)
+}
+
+func (s *Server) recordChunkWorkers(ctx context.Context, chunkID string, workerIDs []string) error {
+	if s.fileRepo == nil {
+		return nil
+	}
+
+	updateCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.fileRepo.UpdateChunkWorkers(updateCtx, chunkID, workerIDs); err != nil {
+		return fmt.Errorf("failed to record workers of chunk %s: %w", chunkID, err)
+	}
+	return nil
+}
+
+// encodeChunk compresses a chunk on its own so it can be decoded without the
+// chunks before it. Chunks that don't shrink are stored as they are.
+func encodeChunk(codec compressor.Codec, data []byte) ([]byte, string) {
+	if codec == nil || codec.Name() == compressor.CodecNone {
+		return data, compressionNone
+	}
+	encoded, err := compressor.Encode(codec, data)
+	if err != nil || !compressor.Shrinks(len(data), len(encoded)) {
+		return data, compressionNone
+	}
+	return encoded, codec.Name()
+}
+
+// encodeChunkWith compresses a chunk with the named codec whether or not it
+// shrinks, for rewriting chunks whose encoding is already recorded.
+func encodeChunkWith(compression string, data []byte) ([]byte, error) {
+	if compression == "" || compression == compressionNone {
+		return data, nil
+	}
+	codec, err := compressor.GetCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	return compressor.Encode(codec, data)
+}
+
+// decodeChunk reverses the per-chunk compression of a stored chunk.
+func decodeChunk(compression string, data []byte) ([]byte, error) {
+	if compression == "" || compression == compressionNone {
+		return data, nil
+	}
+	codec, err := compressor.GetCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	return compressor.Decode(codec, data)
+}
+
+// chunkAvailable reports whether enough of a chunk's recorded workers are
+// registered for it to be reused instead of stored again. Erasure-coded
+// chunks need their data shard count; missing shards are rebuilt by repair.
+func (s *Server) chunkAvailable(chunk metadata.ChunkRef) bool {
+	if len(chunk.Workers) == 0 {
+		return false
+	}
+
+	available := 0
+	for _, workerID := range chunk.Workers {
+		if _, exists := s.workerRegistry.GetWorker(workerID); exists {
+			available++
+		}
+	}
+	if chunk.DataShards > 0 {
+		return available >= chunk.DataShards
+	}
+	return available >= s.minWriteAcks()
+}
+
+// rollbackChunks gives back the references an unfinished upload holds on its
+// chunks. A chunk is only deleted from the workers once nothing else refers
+// to it; chunks without reference tracking are deleted right away.
+func (s *Server) rollbackChunks(fileID string, assignments []core.ChunkAssignment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var release []string
+	stored := make(map[string][]core.ChunkAssignment)
+	var unreferenced []core.ChunkAssignment
+	for _, assignment := range assignments {
+		if !isContentChunkID(assignment.ChunkID) || s.fileRepo == nil {
+			unreferenced = append(unreferenced, assignment)
+			continue
+		}
+		release = append(release, assignment.ChunkID)
+		stored[assignment.ChunkID] = append(stored[assignment.ChunkID], assignment)
+	}
+
+	if len(release) > 0 {
+		orphaned, err := s.fileRepo.ReleaseChunks(ctx, release)
+		if err != nil {
+			s.logger.Printf("Rollback: failed to release %d chunk references of file %s: %v", len(release), fileID, err)
+		}
+		// The upload's own view of where the chunk went covers writes
+		// that failed before the chunk row was updated.
+		for _, chunk := range orphaned {
+			unreferenced = append(unreferenced, chunkRefAssignment(chunk))
+			unreferenced = append(unreferenced, stored[chunk.ChunkID]...)
+		}
+	}
+
+	s.deleteChunkReplicas(ctx, fileID, unreferenced)
+	s.logger.Printf("Rolled back %d chunks of file %s", len(assignments), fileID)
+}
+
+// chunkLockBatch is the number of chunks whose locks are held at once while
+// their copies are deleted; every lock takes a slot in Postgres' shared
+// lock table.
+const chunkLockBatch = 100
+
+// deleteChunkReplicas deletes every replica or shard of the given chunks
+// from the workers. A chunk may be listed more than once. Chunks tracked in
+// the metadata store are locked against AcquireChunk while their copies are
+// deleted, and kept if an upload acquired them again after they were
+// released, since it writes to the same place.
+func (s *Server) deleteChunkReplicas(ctx context.Context, fileID string, assignments []core.ChunkAssignment) {
+	if s.fileRepo == nil {
+		s.removeChunkReplicas(ctx, fileID, assignments)
+		return
+	}
+
+	for len(assignments) > 0 {
+		batch := assignments[:min(chunkLockBatch, len(assignments))]
+		assignments = assignments[len(batch):]
+
+		var tracked []string
+		for _, assignment := range batch {
+			if isContentChunkID(assignment.ChunkID) {
+				tracked = append(tracked, assignment.ChunkID)
+			}
+		}
+		if len(tracked) == 0 {
+			s.removeChunkReplicas(ctx, fileID, batch)
+			continue
+		}
+
+		err := s.fileRepo.LockChunks(ctx, tracked, func(referenced map[string]bool) error {
+			var unreferenced []core.ChunkAssignment
+			for _, assignment := range batch {
+				if !referenced[assignment.ChunkID] {
+					unreferenced = append(unreferenced, assignment)
+				}
+			}
+			s.removeChunkReplicas(ctx, fileID, unreferenced)
+			return nil
+		})
+		if err != nil {
+			// Garbage collection removes what is left behind.
+			s.logger.Printf("Failed to lock %d chunks for deletion, left behind: %v", len(tracked), err)
+		}
+	}
+}
+
+// removeChunkReplicas does the deleting for deleteChunkReplicas.
+func (s *Server) removeChunkReplicas(ctx context.Context, fileID string, assignments []core.ChunkAssignment) {
+	deleted := make(map[string]bool)
+	for _, assignment := range assignments {
+		if isErasureCoded(assignment) {
+			s.deleteChunkShards(ctx, assignment)
+			continue
+		}
+		storeFileID, chunkID, chunkIndex := chunkLocation(fileID, assignment)
+
+		for _, workerID := range assignmentWorkers(assignment) {
+			if deleted[chunkID+"/"+workerID] {
+				continue
+			}
+			deleted[chunkID+"/"+workerID] = true
+
+			workerClient, exists := s.workerRegistry.GetWorker(workerID)
+			if !exists {
+				s.logger.Printf("Worker %s not found, chunk %s left behind", workerID, chunkID)
+				continue
+			}
+			if _, err := workerClient.DeleteChunk(ctx, storeFileID, chunkID, chunkIndex); err != nil {
+				s.logger.Printf("Failed to delete chunk %s from worker %s: %v", chunkID, workerID, err)
+			}
+		}
+	}
+}
+
+func assignmentWorkers(assignment core.ChunkAssignment) []string {
+	workerIDs := make([]string, 0, 1+len(assignment.ReplicaWorkers))
+	if assignment.PrimaryWorker != "" {
+		workerIDs = append(workerIDs, assignment.PrimaryWorker)
+	}
+	for _, workerID := range assignment.ReplicaWorkers {
+		if workerID != "" {
+			workerIDs = append(workerIDs, workerID)
+		}
+	}
+	return workerIDs
+}
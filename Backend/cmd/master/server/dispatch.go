@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// chunkDispatch runs the chunk stores of a single upload concurrently, with
+// at most limit chunks in flight. The first failure cancels the remaining
+// stores.
+type chunkDispatch struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func newChunkDispatch(ctx context.Context, limit int) *chunkDispatch {
+	if limit <= 0 {
+		limit = 1
+	}
+	dispatchCtx, cancel := context.WithCancel(ctx)
+	return &chunkDispatch{
+		parent: ctx,
+		ctx:    dispatchCtx,
+		cancel: cancel,
+		slots:  make(chan struct{}, limit),
+	}
+}
+
+// Go waits for a free slot and runs fn in the background. It returns the
+// upload's error without running fn once the dispatch has failed.
+func (d *chunkDispatch) Go(fn func(ctx context.Context) error) error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-d.ctx.Done():
+		return d.Err()
+	}
+	if d.ctx.Err() != nil {
+		// A slot was free but the dispatch had already failed.
+		<-d.slots
+		return d.Err()
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() { <-d.slots }()
+
+		if err := fn(d.ctx); err != nil {
+			d.fail(err)
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until every started store has finished and returns the first
+// error, if any.
+func (d *chunkDispatch) Wait() error {
+	d.wg.Wait()
+	// Read the outcome before cancelling, which would otherwise make a
+	// successful upload look cancelled.
+	err := d.Err()
+	d.cancel()
+	return err
+}
+
+// Err returns the first store error, or the parent context's error if the
+// upload was cancelled.
+func (d *chunkDispatch) Err() error {
+	d.mu.Lock()
+	err := d.err
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return d.parent.Err()
+}
+
+func (d *chunkDispatch) fail(err error) {
+	d.mu.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// acquire takes a slot from a server-wide limiter, giving up when ctx is
+// cancelled.
+func acquire(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func release(slots chan struct{}) {
+	<-slots
+}
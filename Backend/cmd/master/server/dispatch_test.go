@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChunkDispatchSuccess(t *testing.T) {
+	d := newChunkDispatch(context.Background(), 3)
+
+	var stored, inFlight, maxInFlight atomic.Int32
+	for i := 0; i < 20; i++ {
+		err := d.Go(func(ctx context.Context) error {
+			n := inFlight.Add(1)
+			for {
+				max := maxInFlight.Load()
+				if n <= max || maxInFlight.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			inFlight.Add(-1)
+			stored.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Go: %v", err)
+		}
+	}
+
+	if err := d.Wait(); err != nil {
+		t.Fatalf("Wait after successful stores = %v, want nil", err)
+	}
+	if got := stored.Load(); got != 20 {
+		t.Fatalf("stored %d chunks, want 20", got)
+	}
+	if got := maxInFlight.Load(); got > 3 {
+		t.Fatalf("%d stores ran at once, limit is 3", got)
+	}
+}
+
+func TestChunkDispatchFirstErrorCancels(t *testing.T) {
+	d := newChunkDispatch(context.Background(), 2)
+	errStore := errors.New("store failed")
+
+	if err := d.Go(func(ctx context.Context) error { return errStore }); err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+	cancelled := make(chan error, 1)
+	if err := d.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return ctx.Err()
+	}); err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+
+	if err := d.Wait(); err != errStore {
+		t.Fatalf("Wait = %v, want the first store error", err)
+	}
+	if err := <-cancelled; err != context.Canceled {
+		t.Fatalf("remaining store saw %v, want context.Canceled", err)
+	}
+
+	ran := false
+	if err := d.Go(func(ctx context.Context) error { ran = true; return nil }); err != errStore {
+		t.Fatalf("Go after failure = %v, want the store error", err)
+	}
+	if ran {
+		t.Fatal("Go ran a store after the dispatch failed")
+	}
+}
+
+func TestChunkDispatchParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newChunkDispatch(ctx, 1)
+
+	if err := d.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}); err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+	cancel()
+
+	if err := d.Wait(); err != context.Canceled {
+		t.Fatalf("Wait after the upload was cancelled = %v, want context.Canceled", err)
+	}
+}
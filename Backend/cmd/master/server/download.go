@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"echofs/cmd/master/core"
+	grpcClient "echofs/internal/grpc"
+	"echofs/pkg/fileops/Compressor"
+)
+
+// fetchChunk reads one chunk from the first worker that returns data matching
+// the recorded checksum, trying the primary worker before the replicas.
+// Erasure-coded chunks are rebuilt from their shards instead. Chunks are
+// returned decrypted with dataKey, if set, and decompressed.
+func (s *Server) fetchChunk(ctx context.Context, fileID string, assignment core.ChunkAssignment, dataKey []byte) ([]byte, error) {
+	storeFileID, chunkID, chunkIndex := chunkLocation(fileID, assignment)
+	if isErasureCoded(assignment) {
+		return s.fetchErasureCoded(ctx, assignment, func(stored []byte) ([]byte, error) {
+			return openStoredChunk(assignment, chunkID, dataKey, stored)
+		})
+	}
+	workerIDs := assignmentWorkers(assignment)
+
+	var lastErr error
+	for _, workerID := range workerIDs {
+		workerClient, exists := s.workerRegistry.GetWorker(workerID)
+		if !exists {
+			lastErr = fmt.Errorf("worker %s not available", workerID)
+			continue
+		}
+
+		retrieveCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		stored, err := retrieveStoredChunk(retrieveCtx, workerClient, storeFileID, chunkID, chunkIndex, assignment.StoredSize)
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("worker %s: %w", workerID, err)
+			continue
+		}
+
+		data, err := openStoredChunk(assignment, chunkID, dataKey, stored)
+		if err != nil {
+			s.logger.Printf("Bad chunk %s on worker %s: %v", chunkID, workerID, err)
+			lastErr = fmt.Errorf("worker %s: %w", workerID, err)
+			continue
+		}
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("failed to retrieve chunk %s from any replica: %w", chunkID, lastErr)
+}
+
+// retrieveStoredChunk reads a chunk as stored from a worker, streaming it
+// when it is too large for a single message.
+func retrieveStoredChunk(ctx context.Context, workerClient *grpcClient.WorkerClient, fileID, chunkID string, chunkIndex int, storedSize int64) ([]byte, error) {
+	if storedSize > grpcClient.StreamChunkThreshold {
+		var stored bytes.Buffer
+		stored.Grow(int(storedSize))
+		if _, err := workerClient.RetrieveChunkStream(ctx, fileID, chunkID, chunkIndex, &stored); err != nil {
+			return nil, err
+		}
+		return stored.Bytes(), nil
+	}
+
+	resp, err := workerClient.RetrieveChunk(ctx, fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.GetSuccess() {
+		return nil, errors.New(resp.GetMessage())
+	}
+	return resp.GetChunkData(), nil
+}
+
+// openStoredChunk turns the bytes stored for a chunk back into its original
+// data, decrypting and decompressing them, and checks the result against
+// the chunk's ID or recorded checksum.
+func openStoredChunk(assignment core.ChunkAssignment, chunkID string, dataKey, stored []byte) ([]byte, error) {
+	data, err := openChunk(dataKey, chunkID, stored)
+	if err != nil {
+		return nil, err
+	}
+	data, err = decodeChunk(assignment.Compression, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode chunk %s: %w", chunkID, err)
+	}
+
+	if isContentChunkID(chunkID) {
+		if chunkIDFor(dataKey, data) != chunkID {
+			return nil, fmt.Errorf("%w for chunk %s", errChecksumMismatch, chunkID)
+		}
+	} else if assignment.MD5Expected != "" {
+		hash := md5.Sum(data)
+		if !strings.EqualFold(hex.EncodeToString(hash[:]), assignment.MD5Expected) {
+			return nil, fmt.Errorf("%w for chunk %s", errChecksumMismatch, chunkID)
+		}
+	}
+	return data, nil
+}
+
+// openChunkStream returns a reader over the original file contents.
+func (s *Server) openChunkStream(ctx context.Context, session *core.UploadSession) (io.ReadCloser, error) {
+	stream, err := s.streamAssignments(ctx, session.FileID, session.Assignments(), session.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.Compressed {
+		return stream, nil
+	}
+
+	codec, err := compressor.GetCodec(session.Compression)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	decoder, err := codec.NewReader(stream)
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to open %s stream: %w", codec.Name(), err)
+	}
+	return &decodedStream{ReadCloser: decoder, pipe: stream}, nil
+}
+
+// openRangeStream returns a reader over length bytes of the original file
+// starting at start. Only the chunks covering the range are fetched and
+// decoded, except for files compressed as one stream, which have to be
+// decoded from the beginning.
+func (s *Server) openRangeStream(ctx context.Context, session *core.UploadSession, start, length int64) (io.ReadCloser, error) {
+	assignments := session.Assignments()
+	offsets, ok := chunkOffsets(assignments)
+	if session.Compressed || !ok {
+		stream, err := s.openChunkStream(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, stream, start); err != nil {
+			stream.Close()
+			return nil, fmt.Errorf("failed to seek to offset %d: %w", start, err)
+		}
+		return &limitedStream{Reader: io.LimitReader(stream, length), Closer: stream}, nil
+	}
+
+	first, last, ok := coveringChunks(offsets, start, length)
+	if !ok {
+		return nil, fmt.Errorf("range %d-%d is outside the chunk map", start, start+length-1)
+	}
+
+	stream, err := s.streamAssignments(ctx, session.FileID, assignments[first:last+1], session.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, stream, start-offsets[first]); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to seek to offset %d: %w", start, err)
+	}
+	return &limitedStream{Reader: io.LimitReader(stream, length), Closer: stream}, nil
+}
+
+// chunkOffsets returns the start offset of every chunk plus the total size
+// as the last element. It reports false if a chunk has no recorded size.
+func chunkOffsets(assignments []core.ChunkAssignment) ([]int64, bool) {
+	offsets := make([]int64, len(assignments)+1)
+	for i, assignment := range assignments {
+		if assignment.Size <= 0 {
+			return nil, false
+		}
+		offsets[i+1] = offsets[i] + assignment.Size
+	}
+	return offsets, true
+}
+
+// coveringChunks returns the first and last chunk holding bytes of the range
+// of length bytes at start, given the offsets from chunkOffsets. Chunks may
+// differ in size (content-defined chunking), so they are found by offset
+// rather than by dividing by the chunk size.
+func coveringChunks(offsets []int64, start, length int64) (first, last int, ok bool) {
+	chunks := len(offsets) - 1
+	end := start + length
+	first = sort.Search(chunks, func(i int) bool { return offsets[i+1] > start })
+	last = sort.Search(chunks, func(i int) bool { return offsets[i+1] >= end })
+	if last >= chunks {
+		last = chunks - 1
+	}
+	return first, last, first <= last
+}
+
+// streamAssignments concatenates the given chunks into a single stream. The
+// first chunk is fetched before returning so that unavailable data can still
+// be reported with a proper status code; later chunks are fetched while the
+// caller consumes the stream.
+func (s *Server) streamAssignments(ctx context.Context, fileID string, assignments []core.ChunkAssignment, dataKey []byte) (*io.PipeReader, error) {
+	pr, pw := io.Pipe()
+	if len(assignments) == 0 {
+		pw.Close()
+		return pr, nil
+	}
+
+	first, err := s.fetchChunk(ctx, fileID, assignments[0], dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if _, err := pw.Write(first); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for _, assignment := range assignments[1:] {
+			data, err := s.fetchChunk(ctx, fileID, assignment, dataKey)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(data); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	return pr, nil
+}
+
+// digestStoredFile reads a file back from its chunks and returns its MD5 and
+// SHA-256.
+func (s *Server) digestStoredFile(ctx context.Context, session *core.UploadSession) (md5Hex, sha256Hex string, err error) {
+	stream, err := s.openChunkStream(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+	defer stream.Close()
+
+	digest := newFileDigest()
+	n, err := io.Copy(digest, stream)
+	if err != nil {
+		return "", "", err
+	}
+	if n != session.FileSize {
+		return "", "", fmt.Errorf("stored file is %d bytes, expected %d", n, session.FileSize)
+	}
+
+	md5Hex, sha256Hex = digest.Sums()
+	return md5Hex, sha256Hex, nil
+}
+
+// serveChunkedFile writes the file described by session to w, honouring
+// single and multiple byte ranges.
+func (s *Server) serveChunkedFile(w http.ResponseWriter, r *http.Request, session *core.UploadSession) error {
+	size := session.FileSize
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(session.FileName)))
+	setIntegrityHeaders(w, session.MD5Hash, session.SHA256Hash)
+
+	if etag := w.Header().Get("ETag"); etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Disposition")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && r.Header.Get("If-Range") != "" && r.Header.Get("If-Range") != w.Header().Get("ETag") {
+		// The client's partial copy is stale; send the whole file instead.
+		rangeHeader = ""
+	}
+
+	var ranges []byteRange
+	if rangeHeader != "" {
+		var err error
+		ranges, err = parseRange(rangeHeader, size)
+		if err != nil && err != errInvalidRange {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			s.sendErrorResponse(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		// A malformed Range header is ignored and the whole file is sent,
+		// as RFC 7233 requires.
+	}
+
+	if len(ranges) == 0 {
+		stream, err := s.openChunkStream(r.Context(), session)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		// Whole-file downloads are checked against the digest recorded at
+		// upload time. Ranges rely on the per-chunk checksums instead.
+		var body io.Reader = stream
+		if session.SHA256Hash != "" || session.MD5Hash != "" {
+			body = newVerifyingReader(stream, expectedChecksums{MD5: session.MD5Hash, SHA256: session.SHA256Hash})
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		_, err = io.Copy(w, body)
+		return err
+	}
+
+	if len(ranges) == 1 {
+		br := ranges[0]
+		stream, err := s.openRangeStream(r.Context(), session, br.start, br.length)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Range", br.contentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(br.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, err = io.Copy(w, stream)
+		return err
+	}
+
+	// Open the first part up front so a missing chunk can still be
+	// reported before the 206 status is written.
+	firstStream, err := s.openRangeStream(r.Context(), session, ranges[0].start, ranges[0].length)
+	if err != nil {
+		return err
+	}
+
+	mw := multipart.NewWriter(w)
+	defer mw.Close()
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+
+	for i, br := range ranges {
+		stream := firstStream
+		if i > 0 {
+			stream, err = s.openRangeStream(r.Context(), session, br.start, br.length)
+			if err != nil {
+				return err
+			}
+		}
+
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {br.contentRange(size)},
+		})
+		if err == nil {
+			_, err = io.Copy(part, stream)
+		}
+		stream.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type limitedStream struct {
+	io.Reader
+	io.Closer
+}
+
+type decodedStream struct {
+	io.ReadCloser
+	pipe *io.PipeReader
+}
+
+func (d *decodedStream) Close() error {
+	d.ReadCloser.Close()
+	return d.pipe.Close()
+}
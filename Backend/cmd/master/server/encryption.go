@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/pkg/auth"
+	"echofs/pkg/config"
+	"echofs/pkg/encryption"
+)
+
+// Chunks of encrypted files are named by a MAC under the file's data key
+// rather than by their plain SHA-256, which would reveal whether a stored
+// chunk matches known content. Identical chunks are still shared within a
+// file.
+const keyedChunkPrefix = "hmac-sha256-"
+
+// newKMS opens the configured keyring, or returns nil when encryption is
+// disabled.
+func newKMS(cfg *config.MasterConfig) (encryption.KMS, error) {
+	if cfg == nil || !cfg.EncryptionEnabled {
+		return nil, nil
+	}
+	return encryption.NewLocalKeyring(cfg.EncryptionKeyringPath)
+}
+
+// newFileKey gives a new upload its data key. It leaves the session
+// unencrypted when encryption is disabled.
+func (s *Server) newFileKey(ctx context.Context, session *core.UploadSession) error {
+	if s.kms == nil {
+		return nil
+	}
+
+	dataKey, wrapped, err := encryption.NewDataKey(ctx, s.kms)
+	if err != nil {
+		return err
+	}
+	session.DataKey = dataKey
+	session.EncryptionKeyID = wrapped.KeyID
+	session.WrappedDataKey = wrapped.Ciphertext
+	return nil
+}
+
+// unwrapFileKey recovers the data key of a session rebuilt from the
+// metadata store.
+func (s *Server) unwrapFileKey(ctx context.Context, session *core.UploadSession) error {
+	if session.EncryptionKeyID == "" || session.DataKey != nil {
+		return nil
+	}
+	if s.kms == nil {
+		return fmt.Errorf("file %s is encrypted but no keyring is configured", session.FileID)
+	}
+
+	dataKey, err := s.kms.UnwrapKey(ctx, encryption.WrappedKey{KeyID: session.EncryptionKeyID, Ciphertext: session.WrappedDataKey})
+	if err != nil {
+		return fmt.Errorf("failed to unwrap data key of file %s: %w", session.FileID, err)
+	}
+	session.DataKey = dataKey
+	return nil
+}
+
+// chunkIDFor names a chunk by its plain content, keyed by the file's data key
+// when the file is encrypted.
+func chunkIDFor(dataKey, data []byte) string {
+	if dataKey == nil {
+		return contentChunkID(data)
+	}
+	// Derive a separate MAC key so the AES key is only used for AES.
+	idKey := hmac.New(sha256.New, dataKey)
+	idKey.Write([]byte("echofs chunk id"))
+	mac := hmac.New(sha256.New, idKey.Sum(nil))
+	mac.Write(data)
+	return keyedChunkPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func isKeyedChunkID(chunkID string) bool {
+	return strings.HasPrefix(chunkID, keyedChunkPrefix)
+}
+
+// sealChunk encrypts the stored form of a chunk, binding it to its ID.
+func sealChunk(dataKey []byte, chunkID string, data []byte) ([]byte, error) {
+	if dataKey == nil {
+		return data, nil
+	}
+	return encryption.EncryptChunk(dataKey, []byte(chunkID), data)
+}
+
+// openChunk decrypts a chunk read from a worker. A chunk that fails
+// authentication is reported as a checksum mismatch, like any other
+// corrupted replica.
+func openChunk(dataKey []byte, chunkID string, data []byte) ([]byte, error) {
+	if dataKey == nil {
+		return data, nil
+	}
+	plaintext, err := encryption.DecryptChunk(dataKey, []byte(chunkID), data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %s: %v", errChecksumMismatch, chunkID, err)
+	}
+	return plaintext, nil
+}
+
+// RotateEncryptionKeys switches to a new master key and re-wraps the data
+// keys of existing files with it. Chunks are not touched: their data keys
+// stay the same.
+func (s *Server) RotateEncryptionKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if claims.Role != "admin" {
+		s.sendErrorResponse(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	rotator, ok := s.kms.(encryption.Rotator)
+	if !ok {
+		s.sendErrorResponse(w, "Encryption key rotation not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	keyID, err := rotator.Rotate(ctx)
+	if err != nil {
+		s.logger.Printf("Failed to rotate master key: %v", err)
+		s.sendErrorResponse(w, "Failed to rotate master key", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Printf("Rotated master key, new key %s", keyID)
+
+	rewrapped, failed := 0, 0
+	if s.fileRepo != nil {
+		files, err := s.fileRepo.ListWrappedKeys(ctx, keyID)
+		if err != nil {
+			s.logger.Printf("Failed to list data keys to re-wrap: %v", err)
+			s.sendErrorResponse(w, "Rotated master key but failed to re-wrap data keys", http.StatusInternalServerError)
+			return
+		}
+
+		for _, file := range files {
+			wrapped, changed, err := encryption.Rewrap(ctx, s.kms, encryption.WrappedKey{KeyID: file.EncryptionKeyID, Ciphertext: file.WrappedDataKey})
+			if err == nil && changed {
+				_, err = s.fileRepo.UpdateWrappedKey(ctx, file.FileID, file.EncryptionKeyID, wrapped.KeyID, wrapped.Ciphertext)
+			}
+			if err != nil {
+				s.logger.Printf("Failed to re-wrap data key of file %s: %v", file.FileID, err)
+				failed++
+				continue
+			}
+			rewrapped++
+		}
+	}
+
+	s.sendSuccessResponse(w, "Master key rotated", map[string]interface{}{
+		"key_id":    keyID,
+		"rewrapped": rewrapped,
+		"failed":    failed,
+	})
+}
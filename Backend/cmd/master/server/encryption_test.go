@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"echofs/cmd/master/core"
+)
+
+func TestChunkIDForPlainFiles(t *testing.T) {
+	data := []byte("chunk contents")
+	sum := sha256.Sum256(data)
+
+	if got, want := chunkIDFor(nil, data), contentChunkPrefix+hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("chunkIDFor(nil) = %s, want %s", got, want)
+	}
+}
+
+func TestChunkIDForEncryptedFiles(t *testing.T) {
+	data := []byte("chunk contents")
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+
+	id := chunkIDFor(key, data)
+	if !strings.HasPrefix(id, keyedChunkPrefix) || len(id) != len(keyedChunkPrefix)+2*sha256.Size {
+		t.Fatalf("chunkIDFor(key) = %s, want %s and a hex HMAC", id, keyedChunkPrefix)
+	}
+	if chunkIDFor(key, data) != id {
+		t.Error("chunkIDFor is not deterministic, so chunks of a file can't be shared")
+	}
+	if chunkIDFor(key, []byte("other contents")) == id {
+		t.Error("different contents got the same chunk ID")
+	}
+	// An encrypted chunk's ID must not reveal its content to anyone
+	// without the file's key.
+	if chunkIDFor(otherKey, data) == id {
+		t.Error("files with different keys share a chunk ID")
+	}
+	if strings.TrimPrefix(id, keyedChunkPrefix) == strings.TrimPrefix(chunkIDFor(nil, data), contentChunkPrefix) {
+		t.Error("keyed chunk ID is the plain SHA-256 of the content")
+	}
+}
+
+func TestIsContentChunkID(t *testing.T) {
+	tests := []struct {
+		chunkID string
+		want    bool
+	}{
+		{chunkID: chunkIDFor(nil, []byte("x")), want: true},
+		{chunkID: chunkIDFor(bytes.Repeat([]byte{1}, 32), []byte("x")), want: true},
+		{chunkID: "file_chunk_3", want: false},
+		{chunkID: "", want: false},
+		{chunkID: "file-sha256-abc", want: false},
+	}
+	for _, tt := range tests {
+		if got := isContentChunkID(tt.chunkID); got != tt.want {
+			t.Errorf("isContentChunkID(%q) = %v, want %v", tt.chunkID, got, tt.want)
+		}
+	}
+}
+
+func TestChunkLocation(t *testing.T) {
+	keyed := chunkIDFor(bytes.Repeat([]byte{1}, 32), []byte("x"))
+
+	tests := []struct {
+		name       string
+		assignment core.ChunkAssignment
+		fileID     string
+		chunkID    string
+		index      int
+	}{
+		{name: "content chunk", assignment: core.ChunkAssignment{ChunkID: "sha256-ab", ChunkIndex: 4}, fileID: chunkNamespace, chunkID: "sha256-ab", index: 0},
+		{name: "keyed chunk", assignment: core.ChunkAssignment{ChunkID: keyed, ChunkIndex: 4}, fileID: chunkNamespace, chunkID: keyed, index: 0},
+		{name: "per-file chunk", assignment: core.ChunkAssignment{ChunkID: "old_chunk_4", ChunkIndex: 4}, fileID: "old", chunkID: "old_chunk_4", index: 4},
+		{name: "unnamed chunk", assignment: core.ChunkAssignment{ChunkIndex: 2}, fileID: "file", chunkID: "file_chunk_2", index: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileID, chunkID, index := chunkLocation("file", tt.assignment)
+			if fileID != tt.fileID || chunkID != tt.chunkID || index != tt.index {
+				t.Errorf("chunkLocation = %s, %s, %d; want %s, %s, %d", fileID, chunkID, index, tt.fileID, tt.chunkID, tt.index)
+			}
+		})
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+	"echofs/internal/replication"
+	"echofs/pkg/config"
+	"echofs/pkg/database"
+)
+
+// shardRepairInterval is how often all erasure-coded chunks are checked for
+// shards lost with a worker; shards found missing on reads are queued for
+// repair right away.
+const shardRepairInterval = 10 * time.Minute
+
+// erasureCodes caches the codes by shard counts. Chunks keep the counts they
+// were written with, so older chunks can need another code than the one
+// configured now.
+var erasureCodes sync.Map
+
+func erasureCode(dataShards, parityShards int) (*replication.ReedSolomon, error) {
+	key := [2]int{dataShards, parityShards}
+	if rs, ok := erasureCodes.Load(key); ok {
+		return rs.(*replication.ReedSolomon), nil
+	}
+	rs, err := replication.NewReedSolomon(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	erasureCodes.Store(key, rs)
+	return rs, nil
+}
+
+func newErasureConfig(cfg *config.MasterConfig) replication.ErasureConfig {
+	if cfg == nil {
+		return replication.ErasureConfig{DataShards: 6, ParityShards: 3}
+	}
+	return replication.ErasureConfig{
+		DataShards:   cfg.ErasureDataShards,
+		ParityShards: cfg.ErasureParityShards,
+		Threshold:    cfg.ErasureCodingThreshold,
+	}
+}
+
+// storageModeFor picks replication or erasure coding for a new file. size
+// is -1 when it isn't known up front.
+func (s *Server) storageModeFor(requested string, size int64) (string, error) {
+	return s.erasure.SelectStorageMode(requested, size)
+}
+
+// uploadSizeHint returns the size a direct upload's storage mode is picked
+// by, since the file's real size is only known once the whole body has been
+// read. A size the client declares wins and is returned as declared, to be
+// checked against the file; declared is -1 otherwise. Without one the
+// request length stands in for the file, an overestimate by the multipart
+// framing, and a chunked request (contentLength -1) has no size.
+func uploadSizeHint(value string, contentLength int64) (hint, declared int64, err error) {
+	if value == "" {
+		if contentLength < 0 {
+			return -1, -1, nil
+		}
+		return contentLength, -1, nil
+	}
+	declared, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || declared < 0 {
+		return 0, 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return declared, declared, nil
+}
+
+// erasureFor returns the code new chunks of session are written with, or nil
+// if they are replicated.
+func (s *Server) erasureFor(session *core.UploadSession) (*replication.ReedSolomon, error) {
+	if session.StorageMode != replication.StorageModeErasure {
+		return nil, nil
+	}
+	return erasureCode(s.erasure.DataShards, s.erasure.ParityShards)
+}
+
+// shardWorkers returns the worker of every shard of an erasure-coded chunk
+// in shard order, "" where a shard is missing.
+func shardWorkers(assignment core.ChunkAssignment, totalShards int) []string {
+	workerIDs := make([]string, totalShards)
+	for i, workerID := range append([]string{assignment.PrimaryWorker}, assignment.ReplicaWorkers...) {
+		if i < totalShards {
+			workerIDs[i] = workerID
+		}
+	}
+	return workerIDs
+}
+
+// chunkRefAssignment converts a chunk row into the assignment used to read,
+// repair or delete it.
+func chunkRefAssignment(chunk metadata.ChunkRef) core.ChunkAssignment {
+	assignment := core.ChunkAssignment{
+		ChunkID:        chunk.ChunkID,
+		Size:           chunk.Size,
+		ReplicaWorkers: []string{},
+		MD5Expected:    chunk.Checksum,
+		Compression:    chunk.Compression,
+		StoredSize:     chunk.StoredSize,
+		DataShards:     chunk.DataShards,
+		ParityShards:   chunk.ParityShards,
+	}
+	if len(chunk.Workers) > 0 {
+		assignment.PrimaryWorker = chunk.Workers[0]
+		assignment.ReplicaWorkers = chunk.Workers[1:]
+	}
+	return assignment
+}
+
+// storeChunkShards splits the stored form of a chunk into shards and writes
+// shard i to the i-th worker on the ring, wrapping around when there are
+// fewer workers than shards. Failed shards are retried on the next workers.
+// It returns the worker of each shard, "" for shards that could not be
+// stored, and fails when too few were stored to survive another loss; the
+// stored shards are still returned so the caller can roll them back.
+func (s *Server) storeChunkShards(ctx context.Context, chunkID string, data []byte, rs *replication.ReedSolomon) ([]string, error) {
+	s.refreshRing()
+	ring := s.ring.Lookup(chunkID, len(s.ring.Workers()))
+	if len(ring) == 0 {
+		return nil, fmt.Errorf("no workers available for chunk %s", chunkID)
+	}
+
+	shards, err := rs.Split(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split chunk %s into shards: %w", chunkID, err)
+	}
+	workerIDs := make([]string, len(shards))
+	errs := make([]error, len(shards))
+
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workerID := ring[i%len(ring)]
+			if errs[i] = s.storeShard(ctx, workerID, chunkID, i, shards[i]); errs[i] == nil {
+				workerIDs[i] = workerID
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var lastErr error
+	for i := range shards {
+		if errs[i] == nil {
+			continue
+		}
+		lastErr = errs[i]
+		s.logger.Printf("Failed to store shard %d of chunk %s on worker %s: %v", i, chunkID, ring[i%len(ring)], errs[i])
+		for offset := 1; offset < len(ring) && ctx.Err() == nil; offset++ {
+			workerID := ring[(i+offset)%len(ring)]
+			if err := s.storeShard(ctx, workerID, chunkID, i, shards[i]); err != nil {
+				lastErr = err
+				continue
+			}
+			workerIDs[i] = workerID
+			break
+		}
+	}
+
+	stored := 0
+	for _, workerID := range workerIDs {
+		if workerID != "" {
+			stored++
+		}
+	}
+	if required := replication.MinShardAcks(rs.DataShards(), rs.ParityShards()); stored < required {
+		return workerIDs, fmt.Errorf("chunk %s stored %d of %d shards, %d required: %v",
+			chunkID, stored, len(shards), required, lastErr)
+	}
+
+	return workerIDs, nil
+}
+
+func (s *Server) storeShard(ctx context.Context, workerID, chunkID string, shardIndex int, shard []byte) error {
+	hash := md5.Sum(shard)
+	return s.storeChunkOnWorker(ctx, workerID, chunkNamespace, chunkID, shardIndex, shard, hex.EncodeToString(hash[:]))
+}
+
+// fetchShards reads the shards of an erasure-coded chunk in parallel. Shards
+// whose worker is missing or failed are left nil.
+func (s *Server) fetchShards(ctx context.Context, chunkID string, workerIDs []string, indices []int, shards [][]byte) error {
+	var (
+		mu      sync.Mutex
+		lastErr error
+		wg      sync.WaitGroup
+	)
+	for _, i := range indices {
+		workerID := workerIDs[i]
+		if workerID == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, workerID string) {
+			defer wg.Done()
+			shard, err := s.fetchShard(ctx, workerID, chunkID, i)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			shards[i] = shard
+		}(i, workerID)
+	}
+	wg.Wait()
+	return lastErr
+}
+
+func (s *Server) fetchShard(ctx context.Context, workerID, chunkID string, shardIndex int) ([]byte, error) {
+	workerClient, exists := s.workerRegistry.GetWorker(workerID)
+	if !exists {
+		return nil, fmt.Errorf("worker %s not available", workerID)
+	}
+
+	retrieveCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := workerClient.RetrieveChunk(retrieveCtx, chunkNamespace, chunkID, shardIndex)
+	if err != nil {
+		return nil, fmt.Errorf("worker %s: %w", workerID, err)
+	}
+	if !resp.GetSuccess() {
+		return nil, fmt.Errorf("worker %s: %s", workerID, resp.GetMessage())
+	}
+	return resp.GetChunkData(), nil
+}
+
+// fetchErasureCoded rebuilds an erasure-coded chunk from the first shards
+// that can be read, data shards first since they need no decoding, and
+// turns it back into the original data with open. If the result doesn't
+// check out, every shard is read and each one is left out in turn to find
+// the corrupt one. Missing or corrupt shards are queued for repair.
+func (s *Server) fetchErasureCoded(ctx context.Context, assignment core.ChunkAssignment, open func([]byte) ([]byte, error)) ([]byte, error) {
+	rs, err := erasureCode(assignment.DataShards, assignment.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	chunkID := assignment.ChunkID
+	workerIDs := shardWorkers(assignment, rs.TotalShards())
+	shards := make([][]byte, rs.TotalShards())
+
+	count := func() int {
+		n := 0
+		for _, shard := range shards {
+			if shard != nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Read only as many shards as still needed, moving on to the next
+	// ones when some fail.
+	var lastErr error
+	next := 0
+	for count() < rs.DataShards() && next < len(shards) {
+		var batch []int
+		for next < len(shards) && len(batch) < rs.DataShards()-count() {
+			batch = append(batch, next)
+			next++
+		}
+		if err := s.fetchShards(ctx, chunkID, workerIDs, batch, shards); err != nil {
+			lastErr = err
+		}
+	}
+	if count() < rs.DataShards() {
+		s.queueShardRepair(assignment)
+		return nil, fmt.Errorf("%w: chunk %s: %v", replication.ErrTooFewShards, chunkID, lastErr)
+	}
+
+	rebuild := func(shards [][]byte) ([]byte, error) {
+		shards = append([][]byte(nil), shards...)
+		if err := rs.Reconstruct(shards); err != nil {
+			return nil, err
+		}
+		stored, err := rs.Join(shards, int(assignment.StoredSize))
+		if err != nil {
+			return nil, err
+		}
+		return open(stored)
+	}
+
+	data, err := rebuild(shards)
+	if err == nil {
+		if lastErr != nil || slices.Contains(workerIDs, "") {
+			s.queueShardRepair(assignment)
+		}
+		return data, nil
+	}
+	s.logger.Printf("Chunk %s does not check out from %d shards, reading the rest: %v", chunkID, count(), err)
+
+	var rest []int
+	for ; next < len(shards); next++ {
+		rest = append(rest, next)
+	}
+	s.fetchShards(ctx, chunkID, workerIDs, rest, shards)
+	if count() <= rs.DataShards() {
+		s.queueShardRepair(assignment)
+		return nil, fmt.Errorf("chunk %s has no spare shard to find the corrupt one: %w", chunkID, err)
+	}
+
+	for i := range shards {
+		if shards[i] == nil {
+			continue
+		}
+		without := append([][]byte(nil), shards...)
+		without[i] = nil
+		if data, err := rebuild(without); err == nil {
+			s.logger.Printf("Shard %d of chunk %s on worker %s is corrupt", i, chunkID, workerIDs[i])
+			s.queueShardRepair(assignment, i)
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: chunk %s could not be rebuilt from its shards", errChecksumMismatch, chunkID)
+}
+
+// deleteChunkShards deletes every shard of an erasure-coded chunk.
+func (s *Server) deleteChunkShards(ctx context.Context, assignment core.ChunkAssignment) {
+	totalShards := assignment.DataShards + assignment.ParityShards
+	for i, workerID := range shardWorkers(assignment, totalShards) {
+		if workerID == "" {
+			continue
+		}
+		workerClient, exists := s.workerRegistry.GetWorker(workerID)
+		if !exists {
+			s.logger.Printf("Worker %s not found, shard %d of chunk %s left behind", workerID, i, assignment.ChunkID)
+			continue
+		}
+		if _, err := workerClient.DeleteChunk(ctx, chunkNamespace, assignment.ChunkID, i); err != nil {
+			s.logger.Printf("Failed to delete shard %d of chunk %s from worker %s: %v", i, assignment.ChunkID, workerID, err)
+		}
+	}
+}
+
+// shardRepair asks for the missing shards of a chunk to be rebuilt, plus the
+// listed shards that were found corrupt.
+type shardRepair struct {
+	chunk   core.ChunkAssignment
+	corrupt []int
+}
+
+// queueShardRepair schedules a chunk for repair without blocking the read
+// that noticed the loss; if the queue is full the periodic sweep catches it.
+func (s *Server) queueShardRepair(chunk core.ChunkAssignment, corrupt ...int) {
+	select {
+	case s.shardRepairs <- shardRepair{chunk: chunk, corrupt: corrupt}:
+	default:
+	}
+}
+
+// shardRepairService rebuilds lost shards in the background, both those
+// reported by reads and those found by the periodic sweep.
+func (s *Server) shardRepairService() {
+	ticker := time.NewTicker(shardRepairInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case repair := <-s.shardRepairs:
+			s.repairChunk(repair)
+		case <-ticker.C:
+			s.sweepErasureCodedChunks()
+		}
+	}
+}
+
+// sweepErasureCodedChunks queues every erasure-coded chunk with a shard on a
+// worker that is no longer registered.
+func (s *Server) sweepErasureCodedChunks() {
+	if s.fileRepo == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	chunks, err := s.fileRepo.ListErasureCodedChunks(ctx)
+	cancel()
+	if err != nil {
+		s.logger.Printf("Failed to list erasure-coded chunks: %v", err)
+		return
+	}
+
+	for _, chunk := range chunks {
+		assignment := chunkRefAssignment(chunk)
+		for _, workerID := range shardWorkers(assignment, chunk.DataShards+chunk.ParityShards) {
+			if _, exists := s.workerRegistry.GetWorker(workerID); !exists {
+				s.repairChunk(shardRepair{chunk: assignment})
+				break
+			}
+		}
+	}
+}
+
+// repairChunk rebuilds the shards of a chunk that are missing, unreadable or
+// corrupt, stores them on workers that don't hold a shard of the chunk yet
+// where possible, and records the new locations. The shards are rebuilt
+// from the stored bytes, so no data key is needed.
+func (s *Server) repairChunk(repair shardRepair) {
+	chunk := repair.chunk
+	rs, err := erasureCode(chunk.DataShards, chunk.ParityShards)
+	if err != nil {
+		s.logger.Printf("Cannot repair chunk %s: %v", chunk.ChunkID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	workerIDs := shardWorkers(chunk, rs.TotalShards())
+	if s.fileRepo != nil {
+		// Another repair may have moved shards since the chunk was
+		// queued, or the chunk may be gone.
+		current, err := s.fileRepo.GetChunk(ctx, chunk.ChunkID)
+		if err == database.ErrUserNotFound {
+			return
+		}
+		if err != nil {
+			s.logger.Printf("Cannot repair chunk %s: %v", chunk.ChunkID, err)
+			return
+		}
+		workerIDs = shardWorkers(chunkRefAssignment(*current), rs.TotalShards())
+	}
+
+	all := make([]int, rs.TotalShards())
+	for i := range all {
+		all[i] = i
+	}
+	shards := make([][]byte, rs.TotalShards())
+	s.fetchShards(ctx, chunk.ChunkID, workerIDs, all, shards)
+	for _, i := range repair.corrupt {
+		if i >= 0 && i < len(shards) {
+			shards[i] = nil
+		}
+	}
+
+	var missing []int
+	holding := make(map[string]int)
+	for i, shard := range shards {
+		if shard == nil {
+			missing = append(missing, i)
+		} else {
+			holding[workerIDs[i]]++
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if err := rs.Reconstruct(shards); err != nil {
+		s.logger.Printf("Cannot repair chunk %s: %v", chunk.ChunkID, err)
+		return
+	}
+
+	s.refreshRing()
+	candidates := s.ring.Lookup(chunk.ChunkID, len(s.ring.Workers()))
+
+	repaired := 0
+	for _, i := range missing {
+		workerIDs[i] = ""
+		// Spread the rebuilt shards over the workers holding the
+		// fewest shards of the chunk.
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return holding[candidates[a]] < holding[candidates[b]]
+		})
+		for _, workerID := range candidates {
+			if err := s.storeShard(ctx, workerID, chunk.ChunkID, i, shards[i]); err != nil {
+				s.logger.Printf("Failed to store rebuilt shard %d of chunk %s on worker %s: %v", i, chunk.ChunkID, workerID, err)
+				continue
+			}
+			workerIDs[i] = workerID
+			holding[workerID]++
+			repaired++
+			break
+		}
+	}
+
+	if repaired > 0 && s.fileRepo != nil {
+		if err := s.fileRepo.UpdateChunkWorkers(ctx, chunk.ChunkID, workerIDs); err != nil {
+			s.logger.Printf("Failed to record repaired shards of chunk %s: %v", chunk.ChunkID, err)
+			return
+		}
+	}
+	s.logger.Printf("Repaired %d of %d missing shards of chunk %s", repaired, len(missing), chunk.ChunkID)
+}
+
+// isErasureCoded reports whether a chunk is stored as shards.
+func isErasureCoded(assignment core.ChunkAssignment) bool {
+	return assignment.DataShards > 0
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"echofs/internal/metadata"
+	"echofs/pkg/auth"
+	"echofs/pkg/database"
+
+	"github.com/gorilla/mux"
+)
+
+type FolderRequest struct {
+	Path string `json:"path"`
+}
+
+// MoveRequest renames or moves a file or folder: Path is its new full path,
+// or Name its new name in the folder it is already in.
+type MoveRequest struct {
+	Path string `json:"path,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// cleanFolderPath normalizes a folder path to "/a/b", or "" for the root.
+func cleanFolderPath(path string) (string, error) {
+	names, err := metadata.SplitPath(path)
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return metadata.JoinPath(names...), nil
+}
+
+// joinFolderPath is the path of name in the folder at dir, as returned by
+// cleanFolderPath.
+func joinFolderPath(dir, name string) string {
+	return dir + "/" + name
+}
+
+func folderInfo(folder *metadata.Folder) map[string]interface{} {
+	return map[string]interface{}{
+		"folder_id": folder.FolderID,
+		"name":      folder.Name,
+		"path":      folder.Path,
+		"parent_id": folder.ParentID,
+		"created":   folder.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func fileEntryInfo(file *metadata.FileMetadata, path string) map[string]interface{} {
+	return map[string]interface{}{
+		"file_id":    file.ObjectID,
+		"version_id": file.FileID,
+		"version":    file.Version,
+		"name":       file.OriginalName,
+		"path":       path,
+		"folder_id":  file.FolderID,
+		"size":       file.Size,
+		"uploaded":   file.CreatedAt.Format(time.RFC3339),
+		"status":     file.Status,
+		"chunks":     file.TotalChunks,
+	}
+}
+
+// moveTarget works out the folder and name a MoveRequest points at. current
+// returns the names of the folder the entry is in, for renames in place.
+func moveTarget(req MoveRequest, current func() ([]string, error)) ([]string, string, error) {
+	if req.Path != "" {
+		if req.Name != "" {
+			return nil, "", metadata.ErrInvalidPath
+		}
+		return metadata.SplitDir(req.Path)
+	}
+
+	if err := metadata.ValidateName(req.Name); err != nil {
+		return nil, "", err
+	}
+	dir, err := current()
+	if err != nil {
+		return nil, "", err
+	}
+	return dir, req.Name, nil
+}
+
+// sendMoveError reports a failed move or rename of a "File" or "Folder".
+func (s *Server) sendMoveError(w http.ResponseWriter, err error, what string) {
+	switch err {
+	case metadata.ErrInvalidPath:
+		s.sendErrorResponse(w, "Invalid path", http.StatusBadRequest)
+	case database.ErrUserNotFound:
+		s.sendErrorResponse(w, what+" not found or access denied", http.StatusNotFound)
+	case database.ErrNameConflict:
+		s.sendErrorResponse(w, "Path conflicts with an existing file or folder", http.StatusConflict)
+	case database.ErrInvalidMove:
+		s.sendErrorResponse(w, "A folder cannot be moved into itself", http.StatusConflict)
+	default:
+		s.logger.Printf("Failed to move %s: %v", strings.ToLower(what), err)
+		s.sendErrorResponse(w, "Failed to move "+strings.ToLower(what), http.StatusInternalServerError)
+	}
+}
+
+// CreateFolder creates a folder, along with any missing parent folders.
+func (s *Server) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	names, err := metadata.SplitPath(req.Path)
+	if err != nil || len(names) == 0 {
+		s.sendErrorResponse(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Folders not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	folder, err := s.fileRepo.CreateFolder(ctx, claims.UserID, names)
+	if err == database.ErrNameConflict {
+		s.sendErrorResponse(w, "Path conflicts with an existing file or folder", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to create folder %s: %v", req.Path, err)
+		s.sendErrorResponse(w, "Failed to create folder", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendSuccessResponse(w, "Folder created successfully", folderInfo(folder))
+}
+
+// ListFolder lists the subfolders and files of one folder, given by ?path=
+// and the root by default.
+func (s *Server) ListFolder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := cleanFolderPath(r.URL.Query().Get("path"))
+	if err != nil {
+		s.sendErrorResponse(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	names, _ := metadata.SplitPath(dir)
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Folders not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	folderID, err := s.fileRepo.ResolveFolder(ctx, claims.UserID, names, false)
+	if err == database.ErrUserNotFound {
+		s.sendErrorResponse(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to resolve folder %s: %v", dir, err)
+		s.sendErrorResponse(w, "Failed to list folder", http.StatusInternalServerError)
+		return
+	}
+
+	folders, files, err := s.fileRepo.ListFolder(ctx, claims.UserID, folderID)
+	if err != nil {
+		s.logger.Printf("Failed to list folder %s: %v", dir, err)
+		s.sendErrorResponse(w, "Failed to list folder", http.StatusInternalServerError)
+		return
+	}
+
+	folderList := make([]map[string]interface{}, 0, len(folders))
+	for _, folder := range folders {
+		folder.Path = joinFolderPath(dir, folder.Name)
+		folderList = append(folderList, folderInfo(folder))
+	}
+	fileList := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		fileList = append(fileList, fileEntryInfo(file, joinFolderPath(dir, file.OriginalName)))
+	}
+
+	path := dir
+	if path == "" {
+		path = "/"
+	}
+	s.sendSuccessResponse(w, "Folder listed successfully", map[string]interface{}{
+		"folder_id": folderID,
+		"path":      path,
+		"folders":   folderList,
+		"files":     fileList,
+	})
+}
+
+// MoveFolder renames a folder or moves it, with everything in it, to
+// another path. Only metadata changes.
+func (s *Server) MoveFolder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	folderID := mux.Vars(r)["folderId"]
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Folders not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	dir, name, err := moveTarget(req, func() ([]string, error) {
+		names, err := s.fileRepo.FolderPath(ctx, folderID, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return names[:len(names)-1], nil
+	})
+	if err != nil {
+		s.sendMoveError(w, err, "Folder")
+		return
+	}
+
+	folder, err := s.fileRepo.MoveFolder(ctx, folderID, claims.UserID, dir, name)
+	if err != nil {
+		s.sendMoveError(w, err, "Folder")
+		return
+	}
+
+	s.logger.Printf("Moved folder %s to %s", folderID, folder.Path)
+	s.sendSuccessResponse(w, "Folder moved successfully", folderInfo(folder))
+}
+
+// DeleteFolder deletes an empty folder, or with ?recursive=true a folder
+// after moving every file in it to the trash.
+func (s *Server) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	folderID := mux.Vars(r)["folderId"]
+	recursive := r.URL.Query().Get("recursive") == "true"
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Folders not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := s.fileRepo.DeleteFolder(ctx, folderID, claims.UserID, recursive)
+	switch err {
+	case nil:
+	case database.ErrUserNotFound:
+		s.sendErrorResponse(w, "Folder not found or access denied", http.StatusNotFound)
+		return
+	case database.ErrFolderNotEmpty:
+		s.sendErrorResponse(w, "Folder is not empty", http.StatusConflict)
+		return
+	default:
+		s.logger.Printf("Failed to delete folder %s: %v", folderID, err)
+		s.sendErrorResponse(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Printf("Deleted folder %s", folderID)
+	s.sendSuccessResponse(w, "Folder deleted successfully", nil)
+}
+
+// MoveFile renames a file or moves it to another folder. All versions move
+// together and no chunk is touched.
+func (s *Server) MoveFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fileID := mux.Vars(r)["fileId"]
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Folders not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	dir, name, err := moveTarget(req, func() ([]string, error) {
+		file, err := s.fileRepo.GetFileVersion(ctx, fileID, claims.UserID, 0)
+		if err != nil || file.FolderID == "" {
+			return nil, err
+		}
+		return s.fileRepo.FolderPath(ctx, file.FolderID, claims.UserID)
+	})
+	if err != nil {
+		s.sendMoveError(w, err, "File")
+		return
+	}
+
+	file, err := s.fileRepo.MoveFile(ctx, fileID, claims.UserID, dir, name)
+	if err != nil {
+		s.sendMoveError(w, err, "File")
+		return
+	}
+
+	path := metadata.JoinPath(append(append([]string{}, dir...), name)...)
+	s.logger.Printf("Moved file %s to %s", file.ObjectID, path)
+	s.sendSuccessResponse(w, "File moved successfully", fileEntryInfo(file, path))
+}
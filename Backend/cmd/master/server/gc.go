@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/pkg/auth"
+)
+
+const (
+	// gcPageSize is how many chunks are asked of a worker at a time.
+	gcPageSize = 1000
+	// gcReportLimit caps the chunks listed in a report; the counts cover
+	// all of them.
+	gcReportLimit = 1000
+
+	defaultGCInterval    = 24 * time.Hour
+	defaultGCGracePeriod = 48 * time.Hour
+)
+
+var errGCRunning = errors.New("garbage collection already running")
+
+// gcChunk is a chunk found on a worker that nothing refers to.
+type gcChunk struct {
+	WorkerID   string    `json:"worker_id"`
+	FileID     string    `json:"file_id"`
+	ChunkID    string    `json:"chunk_id"`
+	ChunkIndex int       `json:"chunk_index"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// gcReport describes a garbage collection run. In a dry run nothing is
+// deleted and Deleted stays 0.
+type gcReport struct {
+	DryRun         bool      `json:"dry_run"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	GracePeriod    string    `json:"grace_period"`
+	WorkersScanned int       `json:"workers_scanned"`
+	ChunksScanned  int       `json:"chunks_scanned"`
+	StaleChunkRows int       `json:"stale_chunk_rows"`
+	Orphaned       int       `json:"orphaned"`
+	OrphanedBytes  int64     `json:"orphaned_bytes"`
+	InGracePeriod  int       `json:"in_grace_period"`
+	Deleted        int       `json:"deleted"`
+	Chunks         []gcChunk `json:"chunks"`
+	Errors         []string  `json:"errors,omitempty"`
+}
+
+func (r *gcReport) errorf(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (s *Server) gcSettings() (time.Duration, time.Duration, bool) {
+	if cfg := s.masterNode.Config(); cfg != nil {
+		return cfg.GCInterval, cfg.GCGracePeriod, cfg.GCDryRun
+	}
+	return defaultGCInterval, defaultGCGracePeriod, false
+}
+
+// garbageCollectionService runs the chunk GC every GCInterval.
+func (s *Server) garbageCollectionService() {
+	interval, _, dryRun := s.gcSettings()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		report, err := s.collectGarbage(ctx, dryRun)
+		cancel()
+		if err != nil {
+			s.logger.Printf("Garbage collection failed: %v", err)
+			continue
+		}
+		s.logger.Printf("Garbage collection: %d chunks scanned on %d workers, %d orphaned (%d bytes), %d deleted, %d errors",
+			report.ChunksScanned, report.WorkersScanned, report.Orphaned, report.OrphanedBytes, report.Deleted, len(report.Errors))
+	}
+}
+
+// gcVerdict is what a GC run does with a chunk found on a worker.
+type gcVerdict int
+
+const (
+	gcKeep gcVerdict = iota
+	gcInGracePeriod
+	gcOrphaned
+)
+
+// gcRefs is what refers to chunks during a GC run, apart from the rows of
+// the metadata store, which are looked up page by page.
+type gcRefs struct {
+	// liveFiles and liveChunks are held by upload sessions in memory.
+	liveFiles  map[string]bool
+	liveChunks map[string]bool
+	// stale chunk rows are deleted by this run, so they don't count.
+	stale map[string]bool
+	// cutoff is the end of the grace period: chunks written after it are
+	// kept.
+	cutoff time.Time
+}
+
+// held reports whether an upload session holds chunk, which rules it out
+// before the metadata store is asked about it.
+func (r gcRefs) held(chunk gcChunk) bool {
+	return r.liveFiles[chunk.FileID] || r.liveChunks[chunk.ChunkID]
+}
+
+// classify decides chunk's fate given which of the page's chunk rows and
+// files exist. A chunk is kept while an upload session holds it, while its
+// row exists and isn't stale, or while its file exists for chunks stored
+// under their file's ID.
+func (r gcRefs) classify(chunk gcChunk, existingChunks, existingFiles map[string]bool) gcVerdict {
+	if r.held(chunk) {
+		return gcKeep
+	}
+	if (existingChunks[chunk.ChunkID] && !r.stale[chunk.ChunkID]) || existingFiles[chunk.FileID] {
+		return gcKeep
+	}
+	if chunk.ModifiedAt.After(r.cutoff) {
+		return gcInGracePeriod
+	}
+	return gcOrphaned
+}
+
+// liveUploads returns the files and chunks held by upload sessions still in
+// memory, which the metadata store may not know about yet.
+func (s *Server) liveUploads() (map[string]bool, map[string]bool) {
+	files := make(map[string]bool)
+	chunks := make(map[string]bool)
+	for _, session := range s.masterNode.UploadSessions() {
+		files[session.FileID] = true
+		for _, assignment := range session.Assignments() {
+			if assignment.ChunkID != "" {
+				chunks[assignment.ChunkID] = true
+			}
+		}
+	}
+	return files, chunks
+}
+
+// collectGarbage removes chunks nothing refers to. Chunk rows that only
+// unfinished uploads ever referenced are deleted first, then every worker's
+// inventory is compared with the metadata store: a chunk is kept while its
+// row exists, while its file exists for chunks stored under their file's
+// ID, or while an upload session holds it. Chunks younger than the grace
+// period are always kept. Workers sharing one store, such as an S3 bucket,
+// all list the same chunks, so only one of them is scanned. With dryRun
+// nothing is deleted and the report lists what would have been.
+func (s *Server) collectGarbage(ctx context.Context, dryRun bool) (*gcReport, error) {
+	if s.fileRepo == nil {
+		return nil, errors.New("garbage collection requires the metadata store")
+	}
+	if !s.gcRunning.TryLock() {
+		return nil, errGCRunning
+	}
+	defer s.gcRunning.Unlock()
+
+	_, grace, _ := s.gcSettings()
+	report := &gcReport{
+		DryRun:      dryRun,
+		StartedAt:   time.Now(),
+		GracePeriod: grace.String(),
+		Chunks:      []gcChunk{},
+	}
+	refs := gcRefs{
+		stale:  make(map[string]bool),
+		cutoff: report.StartedAt.Add(-grace),
+	}
+	refs.liveFiles, refs.liveChunks = s.liveUploads()
+
+	live := make([]string, 0, len(refs.liveChunks))
+	for chunkID := range refs.liveChunks {
+		live = append(live, chunkID)
+	}
+
+	// Stale rows are treated as gone in a dry run too, so the report shows
+	// the chunks deleting them would free.
+	if dryRun {
+		rows, err := s.fileRepo.ListStaleChunks(ctx, refs.cutoff, live)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list stale chunks: %w", err)
+		}
+		for _, chunk := range rows {
+			refs.stale[chunk.ChunkID] = true
+		}
+		report.StaleChunkRows = len(rows)
+	} else {
+		rows, err := s.fileRepo.DeleteStaleChunks(ctx, refs.cutoff, live)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete stale chunks: %w", err)
+		}
+		var unreferenced []core.ChunkAssignment
+		for _, chunk := range rows {
+			unreferenced = append(unreferenced, chunkRefAssignment(chunk))
+		}
+		s.deleteChunkReplicas(ctx, "", unreferenced)
+		report.StaleChunkRows = len(rows)
+	}
+
+	sharedScanned := false
+	for workerID, workerClient := range s.workerRegistry.GetAllWorkers() {
+		pageToken := ""
+		for {
+			resp, err := workerClient.ListChunks(ctx, pageToken, gcPageSize)
+			if err == nil && !resp.Success {
+				err = errors.New(resp.Message)
+			}
+			if err != nil {
+				report.errorf("worker %s: %v", workerID, err)
+				break
+			}
+			if resp.GetSharedStorage() && sharedScanned {
+				break
+			}
+			if pageToken == "" {
+				report.WorkersScanned++
+			}
+
+			var candidates []gcChunk
+			var chunkIDs, fileIDs []string
+			for _, stored := range resp.Chunks {
+				report.ChunksScanned++
+				chunk := gcChunk{
+					WorkerID:   workerID,
+					FileID:     stored.FileId,
+					ChunkID:    stored.ChunkId,
+					ChunkIndex: int(stored.ChunkIndex),
+					Size:       stored.Size,
+					ModifiedAt: time.Unix(stored.ModifiedAt, 0),
+				}
+				if refs.held(chunk) {
+					continue
+				}
+				candidates = append(candidates, chunk)
+				chunkIDs = append(chunkIDs, chunk.ChunkID)
+				if chunk.FileID != chunkNamespace {
+					fileIDs = append(fileIDs, chunk.FileID)
+				}
+			}
+
+			existingChunks, err := s.fileRepo.ExistingChunks(ctx, chunkIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up chunks: %w", err)
+			}
+			existingFiles, err := s.fileRepo.ExistingFiles(ctx, fileIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up files: %w", err)
+			}
+
+			for _, chunk := range candidates {
+				switch refs.classify(chunk, existingChunks, existingFiles) {
+				case gcKeep:
+					continue
+				case gcInGracePeriod:
+					report.InGracePeriod++
+					continue
+				}
+
+				report.Orphaned++
+				report.OrphanedBytes += chunk.Size
+				if len(report.Chunks) < gcReportLimit {
+					report.Chunks = append(report.Chunks, chunk)
+				}
+				if dryRun {
+					continue
+				}
+
+				resp, err := workerClient.DeleteChunk(ctx, chunk.FileID, chunk.ChunkID, chunk.ChunkIndex)
+				if err == nil && !resp.Success {
+					err = errors.New(resp.Message)
+				}
+				if err != nil {
+					report.errorf("worker %s: chunk %s: %v", workerID, chunk.ChunkID, err)
+					continue
+				}
+				report.Deleted++
+			}
+
+			if resp.NextPageToken == "" {
+				// Only a complete listing covers the shared store; if
+				// listing it fails the next worker sharing it tries again.
+				if resp.GetSharedStorage() {
+					sharedScanned = true
+				}
+				break
+			}
+			pageToken = resp.NextPageToken
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	s.gcMutex.Lock()
+	s.lastGC = report
+	s.gcMutex.Unlock()
+	return report, nil
+}
+
+// RunGarbageCollection runs the chunk GC now and returns its report; with
+// ?dry_run=true nothing is deleted. Admin only.
+func (s *Server) RunGarbageCollection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if claims.Role != "admin" {
+		s.sendErrorResponse(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Metadata store not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	report, err := s.collectGarbage(ctx, dryRun)
+	if err == errGCRunning {
+		s.sendErrorResponse(w, "Garbage collection already running", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Garbage collection failed: %v", err)
+		s.sendErrorResponse(w, "Garbage collection failed", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Garbage collection completed"
+	if dryRun {
+		message = "Garbage collection dry run completed"
+	}
+	s.sendSuccessResponse(w, message, report)
+}
+
+// GetGarbageCollectionReport returns the report of the latest GC run.
+// Admin only.
+func (s *Server) GetGarbageCollectionReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if claims.Role != "admin" {
+		s.sendErrorResponse(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	s.gcMutex.Lock()
+	report := s.lastGC
+	s.gcMutex.Unlock()
+
+	if report == nil {
+		s.sendErrorResponse(w, "Garbage collection has not run yet", http.StatusNotFound)
+		return
+	}
+	s.sendSuccessResponse(w, "Garbage collection report", report)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCClassify(t *testing.T) {
+	now := time.Now()
+	refs := gcRefs{
+		liveFiles:  map[string]bool{"uploading": true},
+		liveChunks: map[string]bool{"held": true},
+		stale:      map[string]bool{"stale": true},
+		cutoff:     now.Add(-time.Hour),
+	}
+	existingChunks := map[string]bool{"referenced": true, "stale": true}
+	existingFiles := map[string]bool{"file": true}
+	old, recent := now.Add(-2*time.Hour), now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		chunk gcChunk
+		want  gcVerdict
+	}{
+		{name: "referenced row", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "referenced", ModifiedAt: old}, want: gcKeep},
+		{name: "chunk of an existing file", chunk: gcChunk{FileID: "file", ChunkID: "file_0", ModifiedAt: old}, want: gcKeep},
+		{name: "chunk held by a session", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "held", ModifiedAt: old}, want: gcKeep},
+		{name: "file of a session", chunk: gcChunk{FileID: "uploading", ChunkID: "uploading_0", ModifiedAt: old}, want: gcKeep},
+		{name: "stale row", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "stale", ModifiedAt: old}, want: gcOrphaned},
+		{name: "no row", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "gone", ModifiedAt: old}, want: gcOrphaned},
+		{name: "deleted file", chunk: gcChunk{FileID: "deleted", ChunkID: "deleted_0", ModifiedAt: old}, want: gcOrphaned},
+		{name: "unreferenced but recent", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "gone", ModifiedAt: recent}, want: gcInGracePeriod},
+		{name: "stale row but recent", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "stale", ModifiedAt: recent}, want: gcInGracePeriod},
+		{name: "held and recent", chunk: gcChunk{FileID: chunkNamespace, ChunkID: "held", ModifiedAt: recent}, want: gcKeep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refs.classify(tt.chunk, existingChunks, existingFiles); got != tt.want {
+				t.Errorf("classify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCHeldSkipsLookup(t *testing.T) {
+	refs := gcRefs{
+		liveFiles:  map[string]bool{"uploading": true},
+		liveChunks: map[string]bool{"held": true},
+	}
+	for _, chunk := range []gcChunk{{FileID: "uploading", ChunkID: "a"}, {FileID: "other", ChunkID: "held"}} {
+		if !refs.held(chunk) {
+			t.Errorf("held(%+v) = false, want true", chunk)
+		}
+	}
+	if refs.held(gcChunk{FileID: "other", ChunkID: "a"}) {
+		t.Error("held reports a chunk no session holds")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"echofs/cmd/master/core"
@@ -19,6 +20,10 @@ func main() {
 	
 	httpServer := NewServer(masterNode, logger)
 	
+	if err := masterNode.Start(context.Background()); err != nil {
+		logger.Fatalf("Failed to start master node: %v", err)
+	}
+	
 	logger.Printf("Starting EchoFS Master Node...")
 	if err := httpServer.Start(cfg.Port); err != nil {
 		logger.Fatalf("Server failed to start: %v", err)
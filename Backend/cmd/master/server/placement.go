@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"echofs/cmd/master/core"
+	grpcClient "echofs/internal/grpc"
+	"echofs/internal/metadata"
+	"echofs/pkg/config"
+	pb "echofs/proto/v1"
+)
+
+// minWriteAcks is the number of replicas that must acknowledge a chunk for
+// the write to count. Placements with fewer workers than this fail instead
+// of silently storing fewer copies.
+func (s *Server) minWriteAcks() int {
+	if cfg := s.masterNode.Config(); cfg != nil && cfg.MinWriteAcks > 0 {
+		return cfg.MinWriteAcks
+	}
+	return 1
+}
+
+// sortedWorkerIDs returns the registered workers in a stable order so that
+// placement does not depend on map iteration.
+func (s *Server) sortedWorkerIDs() []string {
+	workers := s.workerRegistry.GetAllWorkers()
+	workerIDs := make([]string, 0, len(workers))
+	for workerID := range workers {
+		workerIDs = append(workerIDs, workerID)
+	}
+	sort.Strings(workerIDs)
+	return workerIDs
+}
+
+// newPlacementRing builds the consistent-hash ring chunks are placed with.
+func newPlacementRing(cfg *config.MasterConfig) *metadata.HashRing {
+	vnodes, replicas := metadata.DefaultVirtualNodes, 1
+	if cfg != nil {
+		vnodes, replicas = cfg.VirtualNodesPerWorker, cfg.ReplicationFactor
+	}
+	return metadata.NewHashRing(vnodes, replicas)
+}
+
+// refreshRing brings the ring in line with the worker registry. Workers are
+// weighted by the capacity they report, relative to the average reported
+// capacity; workers that report none get the average weight. Weights only
+// change the ring when they change a worker's virtual node count, so
+// placement stays stable between calls. Workers whose heartbeats report no
+// space left are kept off the ring until they have room again.
+func (s *Server) refreshRing() {
+	registered := s.workerRegistry.GetAllWorkers()
+	nodes := make(map[string]*core.WorkerNode, len(registered))
+	capacity := make(map[string]int64, len(registered))
+	var reported, total int64
+	for _, worker := range s.workers.Workers() {
+		if _, exists := registered[worker.ID]; !exists {
+			continue
+		}
+		nodes[worker.ID] = worker
+		if worker.TotalStorage > 0 && worker.AvailableStorage <= 0 {
+			delete(registered, worker.ID)
+			continue
+		}
+		if worker.TotalStorage > 0 {
+			capacity[worker.ID] = worker.TotalStorage
+			reported++
+			total += worker.TotalStorage
+		}
+	}
+	for _, workerID := range s.ring.Workers() {
+		if _, exists := registered[workerID]; !exists {
+			s.ring.RemoveWorker(workerID)
+			s.logger.Printf("Removed worker %s from placement ring", workerID)
+		}
+	}
+
+	var baseline int64
+	if reported > 0 {
+		baseline = total / reported
+	}
+	inRing := make(map[string]bool)
+	for _, workerID := range s.ring.Workers() {
+		inRing[workerID] = true
+	}
+	for workerID := range registered {
+		node, tracked := nodes[workerID]
+		if !tracked {
+			node = &core.WorkerNode{ID: workerID, Status: core.WorkerStatusOnline}
+		}
+		s.ring.AddWorker(node, metadata.CapacityWeight(capacity[workerID], baseline))
+		if !inRing[workerID] {
+			s.logger.Printf("Added worker %s to placement ring", workerID)
+		}
+	}
+}
+
+// placeChunk picks the distinct workers for a chunk from the hash ring,
+// primary first. Adding or removing a worker only changes the placement of
+// the chunks on the arcs it gains or loses.
+func (s *Server) placeChunk(chunkID string) []string {
+	s.refreshRing()
+	placement, err := s.ring.RebalanceChunk(context.Background(), chunkID)
+	if err != nil {
+		return nil
+	}
+	return placement
+}
+
+// storeChunkReplicas writes the chunk to every worker in placement and returns
+// the workers that acknowledged it. Replicas that fail are retried on other
+// registered workers. It fails when fewer than the configured minimum number
+// of replicas stored the chunk; the workers that did store it are still
+// returned so the caller can roll them back.
+func (s *Server) storeChunkReplicas(ctx context.Context, chunkID string, data []byte, md5Hash string, placement []string) ([]string, error) {
+	required := s.minWriteAcks()
+	if len(placement) < required {
+		return nil, fmt.Errorf("chunk %s placed on %d workers, %d acknowledgements required", chunkID, len(placement), required)
+	}
+
+	stored := make([]string, 0, len(placement))
+	tried := make(map[string]bool, len(placement))
+
+	var lastErr error
+	store := func(workerID string) {
+		tried[workerID] = true
+		if err := s.storeChunkOnWorker(ctx, workerID, chunkNamespace, chunkID, 0, data, md5Hash); err != nil {
+			lastErr = err
+			s.logger.Printf("Failed to store chunk %s on worker %s via gRPC: %v", chunkID, workerID, err)
+			return
+		}
+		stored = append(stored, workerID)
+	}
+
+	// Write the initial placement in parallel; alternates are only needed
+	// for the replicas that failed.
+	errs := make([]error, len(placement))
+	var wg sync.WaitGroup
+	for i, workerID := range placement {
+		tried[workerID] = true
+		wg.Add(1)
+		go func(i int, workerID string) {
+			defer wg.Done()
+			errs[i] = s.storeChunkOnWorker(ctx, workerID, chunkNamespace, chunkID, 0, data, md5Hash)
+		}(i, workerID)
+	}
+	wg.Wait()
+
+	for i, workerID := range placement {
+		if errs[i] != nil {
+			lastErr = errs[i]
+			s.logger.Printf("Failed to store chunk %s on worker %s via gRPC: %v", chunkID, workerID, errs[i])
+			continue
+		}
+		stored = append(stored, workerID)
+	}
+
+	// Replace failed replicas with the next workers on the ring, which is
+	// where the chunk would move if the failed workers left.
+	if len(stored) < len(placement) {
+		for _, workerID := range s.ring.Lookup(chunkID, len(s.ring.Workers())) {
+			if len(stored) >= len(placement) || ctx.Err() != nil {
+				break
+			}
+			if tried[workerID] {
+				continue
+			}
+			s.logger.Printf("Retrying chunk %s on alternate worker %s", chunkID, workerID)
+			store(workerID)
+		}
+	}
+
+	if len(stored) < required {
+		return stored, fmt.Errorf("chunk %s stored on %d of %d workers, %d acknowledgements required: %v",
+			chunkID, len(stored), len(placement), required, lastErr)
+	}
+
+	return stored, nil
+}
+
+func (s *Server) storeChunkOnWorker(ctx context.Context, workerID, fileID, chunkID string, chunkIndex int, data []byte, md5Hash string) error {
+	workerClient, exists := s.workerRegistry.GetWorker(workerID)
+	if !exists {
+		return fmt.Errorf("worker %s not found in registry", workerID)
+	}
+
+	if err := acquire(ctx, s.rpcSlots); err != nil {
+		return err
+	}
+	defer release(s.rpcSlots)
+
+	storeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var resp *pb.StoreChunkResponse
+	var err error
+	if len(data) > grpcClient.StreamChunkThreshold {
+		resp, err = workerClient.StoreChunkStream(storeCtx, fileID, chunkID, chunkIndex, bytes.NewReader(data), int64(len(data)))
+	} else {
+		resp, err = workerClient.StoreChunk(storeCtx, fileID, chunkID, chunkIndex, data, md5Hash)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.GetSuccess() {
+		return fmt.Errorf("%s", resp.GetMessage())
+	}
+
+	s.logger.Printf("✅ Stored chunk %s on worker %s via gRPC: %s", chunkID, workerID, resp.GetMessage())
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRanges caps the number of ranges in one request. Every range is served
+// from its own chunk reads, so each one costs worker round trips.
+const maxRanges = 16
+
+var (
+	errInvalidRange  = errors.New("invalid range")
+	errNoOverlap     = errors.New("requested range does not overlap the file")
+	errTooManyRanges = errors.New("too many ranges requested")
+)
+
+// byteRange is one satisfiable range from a Range header, already clamped to
+// the size of the file.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// parseRange parses a "bytes=" Range header as described in RFC 7233.
+// Ranges that start beyond the end of the file are dropped; if none remain
+// errNoOverlap is returned. Overlapping and adjacent ranges are coalesced,
+// and errTooManyRanges is returned for more than maxRanges ranges or ranges
+// that add up to more than the file. A malformed header yields
+// errInvalidRange, which callers answer with the whole file.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	noOverlap := false
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		startStr, endStr, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, errInvalidRange
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+		var br byteRange
+		if startStr == "" {
+			// Suffix range: the last N bytes of the file.
+			if endStr == "" {
+				return nil, errInvalidRange
+			}
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			br.start = size - n
+			br.length = n
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			end := size - 1
+			if endStr != "" {
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			br.start = start
+			br.length = end - start + 1
+		}
+
+		if br.length > 0 {
+			ranges = append(ranges, br)
+		}
+	}
+
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, errNoOverlap
+		}
+		return nil, errInvalidRange
+	}
+
+	if len(ranges) > maxRanges {
+		return nil, errTooManyRanges
+	}
+	var total int64
+	for _, br := range ranges {
+		total += br.length
+	}
+	if total > size {
+		return nil, errTooManyRanges
+	}
+	return coalesceRanges(ranges), nil
+}
+
+// coalesceRanges sorts ranges by offset and merges the ones that overlap or
+// touch, so no byte is read from the workers twice.
+func coalesceRanges(ranges []byteRange) []byteRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	merged := ranges[:1]
+	for _, br := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if br.start > last.start+last.length {
+			merged = append(merged, br)
+			continue
+		}
+		if end := br.start + br.length; end > last.start+last.length {
+			last.length = end - last.start
+		}
+	}
+	return merged
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 1000
+
+	tests := []struct {
+		name   string
+		header string
+		want   []byteRange
+		err    error
+	}{
+		{name: "single", header: "bytes=0-99", want: []byteRange{{0, 100}}},
+		{name: "open ended", header: "bytes=900-", want: []byteRange{{900, 100}}},
+		{name: "suffix", header: "bytes=-10", want: []byteRange{{990, 10}}},
+		{name: "suffix larger than file", header: "bytes=-5000", want: []byteRange{{0, size}}},
+		{name: "end clamped", header: "bytes=950-5000", want: []byteRange{{950, 50}}},
+		{name: "multiple sorted", header: "bytes=500-599, 0-9", want: []byteRange{{0, 10}, {500, 100}}},
+		{name: "overlapping coalesced", header: "bytes=0-99,50-149", want: []byteRange{{0, 150}}},
+		{name: "adjacent coalesced", header: "bytes=0-99,100-199", want: []byteRange{{0, 200}}},
+		{name: "contained coalesced", header: "bytes=0-499,10-19", want: []byteRange{{0, 500}}},
+		{name: "unsatisfiable dropped", header: "bytes=0-9,2000-3000", want: []byteRange{{0, 10}}},
+		{name: "no overlap", header: "bytes=1000-", err: errNoOverlap},
+		{name: "zero suffix", header: "bytes=-0", err: errNoOverlap},
+		{name: "wrong unit", header: "items=0-9", err: errInvalidRange},
+		{name: "missing dash", header: "bytes=10", err: errInvalidRange},
+		{name: "reversed", header: "bytes=20-10", err: errInvalidRange},
+		{name: "not a number", header: "bytes=a-b", err: errInvalidRange},
+		{name: "empty", header: "bytes=", err: errInvalidRange},
+		{name: "repeated whole file", header: "bytes=0-,0-", err: errTooManyRanges},
+		{name: "more than the file", header: "bytes=0-599,400-999", err: errTooManyRanges},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, size)
+			if err != tt.err {
+				t.Fatalf("parseRange(%q) error = %v, want %v", tt.header, err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseRange(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRangeLimitsCount(t *testing.T) {
+	specs := make([]string, maxRanges+1)
+	for i := range specs {
+		specs[i] = "0-0"
+	}
+	if _, err := parseRange("bytes="+strings.Join(specs, ","), 1<<20); err != errTooManyRanges {
+		t.Fatalf("parseRange with %d ranges error = %v, want errTooManyRanges", len(specs), err)
+	}
+
+	specs = specs[:maxRanges]
+	got, err := parseRange("bytes="+strings.Join(specs, ","), 1<<20)
+	if err != nil {
+		t.Fatalf("parseRange with %d ranges: %v", len(specs), err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("identical ranges were not coalesced: %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"echofs/pkg/auth"
+)
+
+func TestUploadFileRejectsMalformedMultipart(t *testing.T) {
+	s := &Server{logger: log.New(io.Discard, "", 0), uploadSlots: make(chan struct{}, 1)}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "no file",
+			body: "--b\r\nContent-Disposition: form-data; name=\"codec\"\r\n\r\nlz4\r\n--b--\r\n",
+			want: "No file provided",
+		},
+		{
+			name: "truncated",
+			body: "--b\r\nContent-Disposition: form-data; name=\"codec\"\r\n\r\nlz4\r\n--b",
+			want: "Failed to parse multipart form: ",
+		},
+		{
+			name: "malformed part header",
+			body: "--b\r\nContent-Disposition form-data\r\n\r\nlz4\r\n--b--\r\n",
+			want: "Failed to parse multipart form: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "multipart/form-data; boundary=b")
+			r = r.WithContext(context.WithValue(r.Context(), auth.UserContextKey, &auth.Claims{UserID: "user"}))
+			w := httptest.NewRecorder()
+
+			s.UploadFile(w, r)
+
+			var resp APIResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if w.Code != http.StatusBadRequest || !strings.HasPrefix(resp.Message, tt.want) {
+				t.Fatalf("UploadFile = %d %q, want 400 %q", w.Code, resp.Message, tt.want)
+			}
+			if tt.want != "No file provided" && len(resp.Message) == len(tt.want) {
+				t.Errorf("error message %q doesn't give the cause", resp.Message)
+			}
+		})
+	}
+}
+
+func TestUploadSizeHint(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		contentLength int64
+		hint          int64
+		declared      int64
+		err           bool
+	}{
+		{name: "declared size", value: "1000", contentLength: 1300, hint: 1000, declared: 1000},
+		{name: "declared size of a chunked request", value: "1000", contentLength: -1, hint: 1000, declared: 1000},
+		{name: "empty file declared", value: "0", contentLength: 300, hint: 0, declared: 0},
+		{name: "request length", contentLength: 1300, hint: 1300, declared: -1},
+		{name: "chunked request", contentLength: -1, hint: -1, declared: -1},
+		{name: "negative size", value: "-5", err: true},
+		{name: "not a number", value: "1kb", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint, declared, err := uploadSizeHint(tt.value, tt.contentLength)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("uploadSizeHint(%q) = %d, want an error", tt.value, hint)
+				}
+				return
+			}
+			if err != nil || hint != tt.hint || declared != tt.declared {
+				t.Fatalf("uploadSizeHint(%q, %d) = %d, %d, %v; want %d, %d", tt.value, tt.contentLength, hint, declared, err, tt.hint, tt.declared)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+	"echofs/pkg/auth"
+	"echofs/pkg/database"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultTrashRetention applies when the master runs without a config.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+func (s *Server) trashRetention() time.Duration {
+	if cfg := s.masterNode.Config(); cfg != nil && cfg.TrashRetention > 0 {
+		return cfg.TrashRetention
+	}
+	return defaultTrashRetention
+}
+
+// purgeTrash permanently deletes files that have been in the trash longer
+// than the retention period. It runs as a master cleanup task.
+func (s *Server) purgeTrash(ctx context.Context) error {
+	if s.fileRepo == nil {
+		return nil
+	}
+
+	orphaned, err := s.fileRepo.PurgeTrash(ctx, time.Now().Add(-s.trashRetention()))
+	if err != nil {
+		return err
+	}
+	s.deleteOrphanedChunks(ctx, orphaned)
+	if len(orphaned) > 0 {
+		s.logger.Printf("Purged trash, %d chunks no longer referenced", len(orphaned))
+	}
+	return nil
+}
+
+// deleteOrphanedChunks removes chunks that lost their last reference from
+// the workers.
+func (s *Server) deleteOrphanedChunks(ctx context.Context, orphaned []metadata.ChunkRef) {
+	var unreferenced []core.ChunkAssignment
+	for _, chunk := range orphaned {
+		unreferenced = append(unreferenced, chunkRefAssignment(chunk))
+	}
+	s.deleteChunkReplicas(ctx, "", unreferenced)
+}
+
+func (s *Server) trashEntryInfo(file *metadata.FileMetadata) map[string]interface{} {
+	info := fileEntryInfo(file, joinFolderPath(file.DeletedPath, file.OriginalName))
+	delete(info, "folder_id")
+	if file.DeletedAt != nil {
+		info["deleted_at"] = file.DeletedAt.Format(time.RFC3339)
+		info["expires_at"] = file.DeletedAt.Add(s.trashRetention()).Format(time.RFC3339)
+	}
+	return info
+}
+
+// ListTrash lists the files in the user's trash, most recently deleted
+// first, with the path each was deleted from.
+func (s *Server) ListTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Trash not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	files, err := s.fileRepo.ListTrash(ctx, claims.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to list trash of user %s: %v", claims.UserID, err)
+		s.sendErrorResponse(w, "Failed to list trash", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, s.trashEntryInfo(file))
+	}
+
+	s.sendSuccessResponse(w, "Trash listed successfully", entries)
+}
+
+// RestoreFromTrash takes a file out of the trash, back to the path it was
+// deleted from or to the path given in the request body.
+func (s *Server) RestoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fileID := mux.Vars(r)["fileId"]
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var dir []string
+	var name string
+	if req.Path != "" {
+		var err error
+		if dir, name, err = metadata.SplitDir(req.Path); err != nil {
+			s.sendErrorResponse(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Trash not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	file, err := s.fileRepo.RestoreFromTrash(ctx, fileID, claims.UserID, dir, name)
+	switch err {
+	case nil:
+	case database.ErrUserNotFound:
+		s.sendErrorResponse(w, "File not found in trash", http.StatusNotFound)
+		return
+	case database.ErrNameConflict:
+		s.sendErrorResponse(w, "Path conflicts with an existing file or folder", http.StatusConflict)
+		return
+	default:
+		s.logger.Printf("Failed to restore file %s from trash: %v", fileID, err)
+		s.sendErrorResponse(w, "Failed to restore file", http.StatusInternalServerError)
+		return
+	}
+
+	var names []string
+	if file.FolderID != "" {
+		if names, err = s.fileRepo.FolderPath(ctx, file.FolderID, claims.UserID); err != nil {
+			s.logger.Printf("Failed to resolve folder of restored file %s: %v", file.ObjectID, err)
+		}
+	}
+	path := metadata.JoinPath(append(names, file.OriginalName)...)
+
+	s.logger.Printf("Restored file %s from trash to %s", file.ObjectID, path)
+	s.sendSuccessResponse(w, "File restored successfully", fileEntryInfo(file, path))
+}
+
+// EmptyTrash permanently deletes everything in the user's trash.
+func (s *Server) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "Trash not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	orphaned, err := s.fileRepo.EmptyTrash(ctx, claims.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to empty trash of user %s: %v", claims.UserID, err)
+		s.sendErrorResponse(w, "Failed to empty trash", http.StatusInternalServerError)
+		return
+	}
+
+	deleteCtx, deleteCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	s.deleteOrphanedChunks(deleteCtx, orphaned)
+	deleteCancel()
+
+	s.logger.Printf("Emptied trash of user %s, %d chunks no longer referenced", claims.UserID, len(orphaned))
+	s.sendSuccessResponse(w, "Trash emptied successfully", nil)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+	"echofs/pkg/auth"
+	"echofs/pkg/database"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// VersionRetentionRequest sets a user's version limit. A null or missing
+// max_versions clears it back to the server default.
+type VersionRetentionRequest struct {
+	MaxVersions *int `json:"max_versions"`
+}
+
+// commitFile stores a finished upload's metadata and chunk map in the
+// session's folder, creating it if needed. An upload to a path the owner
+// already has becomes that file's next version; older versions beyond the
+// owner's retention limit are pruned afterwards.
+func (s *Server) commitFile(ctx context.Context, session *core.UploadSession, file *metadata.FileMetadata) error {
+	if s.fileRepo == nil {
+		session.SetVersion(session.FileID, 1)
+		return nil
+	}
+
+	if session.Path != "" {
+		names, err := metadata.SplitPath(session.Path)
+		if err != nil {
+			return err
+		}
+		if file.FolderID, err = s.fileRepo.ResolveFolder(ctx, file.OwnerID, names, true); err != nil {
+			return err
+		}
+	}
+
+	if err := s.fileRepo.CreateFileWithChunks(ctx, file, chunkRefs(session)); err != nil {
+		return err
+	}
+	session.SetVersion(file.ObjectID, file.Version)
+
+	if file.Version > 1 {
+		s.pruneVersions(file.OwnerID, file.ObjectID)
+	}
+	return nil
+}
+
+// userRetention is the version limit userID set, or nil if they haven't.
+func (s *Server) userRetention(ctx context.Context, userID string) (*int, error) {
+	if s.userRepo == nil {
+		return nil, nil
+	}
+	return s.userRepo.GetVersionRetention(ctx, userID)
+}
+
+// defaultRetention is the version limit of users who haven't set their own.
+func (s *Server) defaultRetention() int {
+	if cfg := s.masterNode.Config(); cfg != nil {
+		return cfg.VersionRetention
+	}
+	return 0
+}
+
+// effectiveRetention is how many versions of each file are kept for a user
+// whose own limit is own; 0 keeps all of them.
+func effectiveRetention(own *int, fallback int) int {
+	if own != nil {
+		return *own
+	}
+	return fallback
+}
+
+// retentionInfo is how a user's version limit is described to clients.
+func retentionInfo(own *int, fallback int) map[string]interface{} {
+	return map[string]interface{}{
+		"max_versions": own,
+		"default":      fallback,
+		"effective":    effectiveRetention(own, fallback),
+	}
+}
+
+// pruneVersions deletes the versions of an object its owner no longer
+// keeps, along with chunks nothing else refers to.
+func (s *Server) pruneVersions(ownerID, objectID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	own, err := s.userRetention(ctx, ownerID)
+	if err != nil {
+		s.logger.Printf("Failed to read version retention of user %s, not pruning file %s: %v", ownerID, objectID, err)
+		return
+	}
+	keep := effectiveRetention(own, s.defaultRetention())
+	if keep <= 0 {
+		return
+	}
+
+	orphaned, err := s.fileRepo.PruneVersions(ctx, objectID, keep)
+	if err != nil {
+		s.logger.Printf("Failed to prune old versions of file %s: %v", objectID, err)
+		return
+	}
+
+	var unreferenced []core.ChunkAssignment
+	for _, chunk := range orphaned {
+		unreferenced = append(unreferenced, chunkRefAssignment(chunk))
+	}
+	s.deleteChunkReplicas(ctx, objectID, unreferenced)
+}
+
+// fileVersionInfo is how a version is described to clients.
+func fileVersionInfo(file *metadata.FileMetadata) map[string]interface{} {
+	return map[string]interface{}{
+		"file_id":     file.ObjectID,
+		"version_id":  file.FileID,
+		"version":     file.Version,
+		"current":     file.IsCurrent,
+		"name":        file.OriginalName,
+		"size":        file.Size,
+		"sha256_hash": file.SHA256Hash,
+		"uploaded":    file.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListFileVersions lists every kept version of a file, newest first.
+func (s *Server) ListFileVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fileID := mux.Vars(r)["fileId"]
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "File versioning not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	versions, err := s.fileRepo.ListVersions(ctx, fileID, claims.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to list versions of file %s: %v", fileID, err)
+		s.sendErrorResponse(w, "Failed to list file versions", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		s.sendErrorResponse(w, "File not found or access denied", http.StatusNotFound)
+		return
+	}
+
+	versionList := make([]map[string]interface{}, 0, len(versions))
+	for _, version := range versions {
+		versionList = append(versionList, fileVersionInfo(version))
+	}
+	s.sendSuccessResponse(w, "File versions listed successfully", versionList)
+}
+
+// RestoreFileVersion makes an older version of a file current again. The
+// restored copy is added as the newest version, so no history is lost.
+func (s *Server) RestoreFileVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	fileID := vars["fileId"]
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	version, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil || version <= 0 {
+		s.sendErrorResponse(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	if s.fileRepo == nil {
+		s.sendErrorResponse(w, "File versioning not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	source, err := s.fileRepo.GetFileVersion(ctx, fileID, claims.UserID, version)
+	if err == database.ErrUserNotFound {
+		s.sendErrorResponse(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to load version %d of file %s: %v", version, fileID, err)
+		s.sendErrorResponse(w, "Failed to load file version", http.StatusInternalServerError)
+		return
+	}
+	if source.IsCurrent {
+		s.sendErrorResponse(w, "Version is already current", http.StatusConflict)
+		return
+	}
+
+	restored, err := s.fileRepo.RestoreVersion(ctx, fileID, claims.UserID, version, uuid.New().String())
+	if err != nil {
+		s.logger.Printf("Failed to restore version %d of file %s: %v", version, fileID, err)
+		s.sendErrorResponse(w, "Failed to restore file version", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Printf("Restored version %d of file %s as version %d", version, restored.ObjectID, restored.Version)
+
+	s.pruneVersions(claims.UserID, restored.ObjectID)
+	s.sendSuccessResponse(w, "File version restored", fileVersionInfo(restored))
+}
+
+// GetVersionRetention reports the version limit the user set, null if they
+// haven't, along with the server default and the limit in effect.
+func (s *Server) GetVersionRetention(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	own, err := s.userRetention(ctx, claims.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to read version retention of user %s: %v", claims.UserID, err)
+		s.sendErrorResponse(w, "Failed to read version retention", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendSuccessResponse(w, "Version retention", retentionInfo(own, s.defaultRetention()))
+}
+
+// SetVersionRetention sets how many versions of each file the user keeps,
+// and prunes existing files down to it the next time they change. 0 keeps
+// all versions; null falls back to the server default.
+func (s *Server) SetVersionRetention(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req VersionRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MaxVersions != nil && *req.MaxVersions < 0 {
+		s.sendErrorResponse(w, "max_versions cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	if s.userRepo == nil {
+		s.sendErrorResponse(w, "File versioning not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.userRepo.SetVersionRetention(ctx, claims.UserID, req.MaxVersions); err != nil {
+		s.logger.Printf("Failed to set version retention of user %s: %v", claims.UserID, err)
+		s.sendErrorResponse(w, "Failed to set version retention", http.StatusInternalServerError)
+		return
+	}
+
+	s.sendSuccessResponse(w, "Version retention updated", retentionInfo(req.MaxVersions, s.defaultRetention()))
+}
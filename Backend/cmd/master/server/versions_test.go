@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestEffectiveRetention(t *testing.T) {
+	zero, two := 0, 2
+	tests := []struct {
+		name     string
+		own      *int
+		fallback int
+		want     int
+	}{
+		{name: "unset uses the default", own: nil, fallback: 5, want: 5},
+		{name: "unset with no default keeps all", own: nil, fallback: 0, want: 0},
+		{name: "explicit 0 keeps all", own: &zero, fallback: 5, want: 0},
+		{name: "own limit", own: &two, fallback: 5, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveRetention(tt.own, tt.fallback); got != tt.want {
+				t.Errorf("effectiveRetention = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionInfoReportsOwnLimit(t *testing.T) {
+	zero := 0
+	info := retentionInfo(&zero, 5)
+	if own, ok := info["max_versions"].(*int); !ok || own == nil || *own != 0 {
+		t.Errorf("max_versions = %v, want the user's own 0", info["max_versions"])
+	}
+	if info["default"] != 5 || info["effective"] != 0 {
+		t.Errorf("default = %v, effective = %v; want 5 and 0", info["default"], info["effective"])
+	}
+
+	info = retentionInfo(nil, 5)
+	if own := info["max_versions"].(*int); own != nil {
+		t.Errorf("max_versions = %d for a user without a limit, want null", *own)
+	}
+	if info["effective"] != 5 {
+		t.Errorf("effective = %v, want the default 5", info["effective"])
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"echofs/cmd/master/core"
+	grpcClient "echofs/internal/grpc"
+	"echofs/pkg/auth"
+	"echofs/pkg/config"
+	pb "echofs/proto/v1"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// defaultWorkerHealthTimeout and defaultHeartbeatInterval apply when
+	// the master runs without a config.
+	defaultWorkerHealthTimeout = 90 * time.Second
+	defaultHeartbeatInterval   = 30 * time.Second
+)
+
+func (s *Server) heartbeatInterval() time.Duration {
+	if cfg := s.masterNode.Config(); cfg != nil && cfg.HeartbeatInterval > 0 {
+		return cfg.HeartbeatInterval
+	}
+	return defaultHeartbeatInterval
+}
+
+// newWorkerTracker builds the registry of the workers that registered with
+// the master. A worker that misses its heartbeats loses its connection and
+// with it its place on the placement ring until it heartbeats again.
+func newWorkerTracker(cfg *config.MasterConfig, workerRegistry *grpcClient.WorkerRegistry, logger *log.Logger) *core.LiveWorkerRegistry {
+	timeout := defaultWorkerHealthTimeout
+	if cfg != nil && cfg.WorkerHealthTimeout > 0 {
+		timeout = cfg.WorkerHealthTimeout
+	}
+
+	workers := core.NewLiveWorkerRegistry(timeout, logger)
+	workers.OnOffline(func(worker *core.WorkerNode) {
+		workerRegistry.RemoveWorker(worker.ID)
+	})
+	return workers
+}
+
+// registerWorker connects to the worker and records it as online. A worker
+// registering again, after a restart or a new address, replaces its old
+// entry.
+func (s *Server) registerWorker(ctx context.Context, node *core.WorkerNode) error {
+	if node.ID == "" {
+		return errors.New("worker ID is required")
+	}
+	if err := s.workerRegistry.RegisterWorker(node.ID, node.Address); err != nil {
+		return err
+	}
+	if err := s.workers.RegisterWorker(ctx, node); err != nil {
+		return err
+	}
+	s.logger.Printf("Worker %s registered at %s with labels %v", node.ID, node.Address, node.Labels)
+	return nil
+}
+
+// recordHeartbeat records a heartbeat of a registered worker. A worker
+// coming back online is connected to again. It fails with
+// core.ErrWorkerNotFound for workers that have to register first.
+func (s *Server) recordHeartbeat(ctx context.Context, workerID string, availableSpace, usedSpace int64) error {
+	previous, err := s.workers.Heartbeat(ctx, workerID, availableSpace, usedSpace)
+	if err != nil {
+		return err
+	}
+	if previous.Status == core.WorkerStatusOffline {
+		s.logger.Printf("Worker %s is back online", workerID)
+	}
+	// The connection is dropped when the worker goes offline, possibly
+	// after this heartbeat already arrived, so check for it every time.
+	if _, exists := s.workerRegistry.GetWorker(workerID); !exists {
+		if err := s.workerRegistry.RegisterWorker(workerID, previous.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workerDialAddress is where the master reaches a registering worker. A
+// worker that doesn't know its own address is reached at the address it
+// registered from, on its gRPC port.
+func workerDialAddress(ctx context.Context, address string, grpcPort int32) (string, int, error) {
+	if address == "" {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return "", 0, errors.New("worker address is required")
+		}
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid worker address %s: %v", p.Addr, err)
+		}
+		address = host
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		if grpcPort <= 0 {
+			return "", 0, fmt.Errorf("worker address %s has no port", address)
+		}
+		address = net.JoinHostPort(address, strconv.Itoa(int(grpcPort)))
+	}
+
+	_, portStr, _ := net.SplitHostPort(address)
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid worker address %s", address)
+	}
+	return address, port, nil
+}
+
+// masterService serves MasterService, which the workers register and
+// heartbeat through, next to the HTTP API.
+type masterService struct {
+	pb.UnimplementedMasterServiceServer
+	s *Server
+}
+
+func (m *masterService) RegisterWorker(ctx context.Context, req *pb.RegisterWorkerRequest) (*pb.RegisterWorkerResponse, error) {
+	address, port, err := workerDialAddress(ctx, req.GetAddress(), req.GetGrpcPort())
+	if err != nil {
+		return &pb.RegisterWorkerResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to register worker: %v", err),
+		}, nil
+	}
+
+	node := &core.WorkerNode{
+		ID:               req.GetWorkerId(),
+		Address:          address,
+		Port:             port,
+		TotalStorage:     req.GetTotalSpace(),
+		AvailableStorage: req.GetAvailableSpace(),
+		Labels:           req.GetLabels(),
+	}
+	if err := m.s.registerWorker(ctx, node); err != nil {
+		return &pb.RegisterWorkerResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to register worker: %v", err),
+		}, nil
+	}
+
+	return &pb.RegisterWorkerResponse{
+		Success:                  true,
+		Message:                  "Worker registered successfully",
+		AssignedId:               node.ID,
+		HeartbeatIntervalSeconds: int32(m.s.heartbeatInterval() / time.Second),
+	}, nil
+}
+
+func (m *masterService) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	err := m.s.recordHeartbeat(ctx, req.GetWorkerId(), req.GetAvailableSpace(), req.GetUsedSpace())
+	if errors.Is(err, core.ErrWorkerNotFound) {
+		return &pb.HeartbeatResponse{
+			Success:    false,
+			Message:    "Worker is not registered",
+			Reregister: true,
+		}, nil
+	}
+	if err != nil {
+		return &pb.HeartbeatResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to record heartbeat: %v", err),
+		}, nil
+	}
+
+	return &pb.HeartbeatResponse{
+		Success: true,
+		Message: "Heartbeat recorded",
+	}, nil
+}
+
+type WorkerRegistrationRequest struct {
+	WorkerID       string            `json:"worker_id"`
+	Address        string            `json:"address"`
+	TotalSpace     int64             `json:"total_space"`
+	AvailableSpace int64             `json:"available_space"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+type WorkerHeartbeatRequest struct {
+	AvailableSpace int64 `json:"available_space"`
+	UsedSpace      int64 `json:"used_space"`
+}
+
+// RegisterWorker registers a worker by hand, for workers that can't reach
+// MasterService. The address must include the port. Admin only.
+func (s *Server) RegisterWorker(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if claims.Role != "admin" {
+		s.sendErrorResponse(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req WorkerRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Address == "" {
+		s.sendErrorResponse(w, "Worker address is required", http.StatusBadRequest)
+		return
+	}
+	address, port, err := workerDialAddress(r.Context(), req.Address, 0)
+	if err != nil {
+		s.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	node := &core.WorkerNode{
+		ID:               req.WorkerID,
+		Address:          address,
+		Port:             port,
+		TotalStorage:     req.TotalSpace,
+		AvailableStorage: req.AvailableSpace,
+		Labels:           req.Labels,
+	}
+	if err := s.registerWorker(r.Context(), node); err != nil {
+		s.sendErrorResponse(w, fmt.Sprintf("Failed to register worker: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendSuccessResponse(w, "Worker registered successfully", map[string]interface{}{
+		"worker_id":                  node.ID,
+		"heartbeat_interval_seconds": int(s.heartbeatInterval() / time.Second),
+	})
+}
+
+// WorkerHeartbeat records a heartbeat of a worker registered by hand.
+// Admin only.
+func (s *Server) WorkerHeartbeat(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		s.sendErrorResponse(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if claims.Role != "admin" {
+		s.sendErrorResponse(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	workerID := mux.Vars(r)["workerId"]
+	var req WorkerHeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := s.recordHeartbeat(r.Context(), workerID, req.AvailableSpace, req.UsedSpace)
+	if errors.Is(err, core.ErrWorkerNotFound) {
+		s.sendErrorResponse(w, "Worker is not registered", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.sendErrorResponse(w, fmt.Sprintf("Failed to record heartbeat: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendSuccessResponse(w, "Heartbeat recorded", nil)
+}
+
+// WorkersHealthCheck lists the registered workers with their last
+// heartbeat, and asks the online ones for their health, load and rates.
+func (s *Server) WorkersHealthCheck(w http.ResponseWriter, r *http.Request) {
+	healthStatus := make(map[string]interface{})
+
+	for _, worker := range s.workers.Workers() {
+		status := map[string]interface{}{
+			"status":            worker.Status.String(),
+			"address":           worker.Address,
+			"last_heartbeat":    worker.LastHeartbeat,
+			"total_storage":     worker.TotalStorage,
+			"used_storage":      worker.UsedStorage,
+			"available_storage": worker.AvailableStorage,
+			"labels":            worker.Labels,
+		}
+
+		if workerClient, exists := s.workerRegistry.GetWorker(worker.ID); exists && worker.Status == core.WorkerStatusOnline {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			resp, err := workerClient.HealthCheck(ctx)
+			cancel()
+
+			if err != nil {
+				status["healthy"] = false
+				status["error"] = err.Error()
+			} else {
+				status["healthy"] = resp.GetHealthy()
+				status["timestamp"] = resp.GetTimestamp()
+			}
+
+			ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+			workerStatus, err := workerClient.GetStatus(ctx)
+			cancel()
+
+			if err == nil {
+				status["chunks_stored"] = workerStatus.GetChunksStored()
+				status["in_flight_rpcs"] = workerStatus.GetInFlightRpcs()
+				status["write_bytes_per_second"] = workerStatus.GetWriteBytesPerSecond()
+				status["read_bytes_per_second"] = workerStatus.GetReadBytesPerSecond()
+				status["requests_per_second"] = workerStatus.GetRequestsPerSecond()
+				status["error_rate"] = workerStatus.GetErrorRate()
+			}
+		} else {
+			status["healthy"] = false
+		}
+
+		healthStatus[worker.ID] = status
+	}
+
+	response := map[string]interface{}{
+		"service": "echofs-master",
+		"workers": healthStatus,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
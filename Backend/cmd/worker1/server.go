@@ -1,9 +1,11 @@
 package main
 
 import (
+    "encoding/json"
     "fmt"
     "net/http"
     "os"
+    grpcServer "echofs/internal/grpc"
     "github.com/gorilla/mux"
     "github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -53,21 +55,33 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf(`{"status": "healthy", "worker": "%s", "service": "echofs-worker"}`, workerID)))
 }
 
-func StatusCheck(w http.ResponseWriter, r *http.Request) {
-	workerID := getWorkerID()
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf(`{"worker": "%s", "available_space": 1000000000, "current_load": 0, "chunks_stored": 0, "protocols": ["http", "grpc"], "grpc_enabled": true}`, workerID)))
+// StatusCheck reports the same storage, load and rates as the GetStatus RPC.
+func StatusCheck(grpcSrv *grpcServer.WorkerGRPCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := struct {
+			grpcServer.WorkerStatus
+			Protocols   []string `json:"protocols"`
+			GRPCEnabled bool     `json:"grpc_enabled"`
+		}{
+			WorkerStatus: grpcSrv.Status(),
+			Protocols:    []string{"http", "grpc"},
+			GRPCEnabled:  true,
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(status)
+	}
 }
 
-func setupRoutes() *mux.Router {
+func setupRoutes(grpcSrv *grpcServer.WorkerGRPCServer) *mux.Router {
 	router := mux.NewRouter()
     
     router.HandleFunc("/chunks/{chunkId}", StoreChunk).Methods("POST")
     router.HandleFunc("/chunks/{chunkId}", RetrieveChunk).Methods("GET")
     router.HandleFunc("/chunks/{chunkId}", DeleteChunk).Methods("DELETE")
     router.HandleFunc("/health", HealthCheck).Methods("GET")
-    router.HandleFunc("/status", StatusCheck).Methods("GET")
+    router.HandleFunc("/status", StatusCheck(grpcSrv)).Methods("GET")
     router.Handle("/metrics", promhttp.Handler()).Methods("GET")
     
     return router
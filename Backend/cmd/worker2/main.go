@@ -6,6 +6,7 @@ import (
     "os"
     "log"
     "strconv"
+    "strings"
     "path/filepath"
 	"net"
 	"net/http"
@@ -77,12 +78,12 @@ func main() {
 	awsConfig, err := aws.NewAWSConfig(ctx, "us-east-1", "")
 	var s3Storage *storage.S3Storage
 	if err != nil {
-		fmt.Printf("Warning: Failed to initialize AWS config: %v. Using simulation mode.\n", err)
+		fmt.Printf("Warning: Failed to initialize AWS config: %v. Storing chunks on disk.\n", err)
 	} else {
 		s3Storage = storage.NewS3Storage(awsConfig.S3, awsConfig.S3BucketName)
 
 		if err := s3Storage.EnsureBucket(ctx); err != nil {
-			fmt.Printf("Warning: Failed to ensure S3 bucket: %v. Using simulation mode.\n", err)
+			fmt.Printf("Warning: Failed to ensure S3 bucket: %v. Storing chunks on disk.\n", err)
 			s3Storage = nil
 		} else {
 			fmt.Printf("✅ S3 storage initialized with bucket: %s\n", awsConfig.S3BucketName)
@@ -106,10 +107,36 @@ func main() {
 
 	// Set up gRPC server
 	logger := log.New(os.Stdout, fmt.Sprintf("[gRPC-%s] ", worker.WorkerID), log.LstdFlags)
-	grpcSrv := grpcServer.NewWorkerGRPCServer(worker.WorkerID, s3Storage, logger)
+	backends := storage.ParseBackends(os.Getenv("STORAGE_BACKEND"))
+	chunkStore, err := storage.NewChunkStore(storage.ChunkStoreConfig{
+		Backends:  backends,
+		FSRoot:    worker.StoragePath,
+		LocalRoot: filepath.Join(filepath.Dir(worker.StoragePath), "local"),
+		S3:        s3Storage,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open chunk storage: %v", err)
+	}
+	if len(backends) == 0 && s3Storage == nil {
+		fmt.Printf("Storing chunks on disk under %s\n", worker.StoragePath)
+	} else if len(backends) > 0 {
+		fmt.Printf("Chunk storage backends: %s\n", strings.Join(backends, ", "))
+	}
+	grpcSrv := grpcServer.NewWorkerGRPCServer(worker.WorkerID, chunkStore, logger)
+	
+	var capacity int64
+	if capacityStr := os.Getenv("WORKER_CAPACITY"); capacityStr != "" {
+		if capacity, err = strconv.ParseInt(capacityStr, 10, 64); err != nil {
+			log.Printf("invalid WORKER_CAPACITY")
+			capacity = 0
+		}
+	}
+	grpcSrv.SetEndpoint(os.Getenv("WORKER_ADDRESS"), worker.Port)
+	grpcSrv.SetCapacity(capacity)
+	go grpcSrv.MonitorUsage(ctx, grpcServer.UsageRefreshInterval)
 	
 	// Set up HTTP server
-	router := setupRoutes()
+	router := setupRoutes(grpcSrv)
 	httpServer := &http.Server{Handler: router}
 
 	// Start servers
@@ -128,6 +155,32 @@ func main() {
 	}()
 
 	fmt.Printf("Worker server (HTTP + gRPC) listening on port %d\n", worker.Port)
+
+	// Register with the master and keep sending it heartbeats
+	masterURL := os.Getenv("MASTER_URL")
+	if masterURL == "" {
+		masterURL = "localhost:8080"
+	}
+	masterClient, err := grpcServer.NewMasterClient(grpcServer.MasterAddress(masterURL), os.Getenv("WORKER_TOKEN"), logger)
+	if err != nil {
+		log.Fatalf("Failed to create master client: %v", err)
+	}
+	defer masterClient.Close()
+	go masterClient.KeepRegistered(ctx, grpcServer.WorkerInfo{
+		WorkerID:   worker.WorkerID,
+		Address:    os.Getenv("WORKER_ADDRESS"),
+		GRPCPort:   worker.Port,
+		TotalSpace: capacity,
+		Labels:     grpcServer.ParseLabels(os.Getenv("WORKER_LABELS")),
+	}, func(ctx context.Context) grpcServer.WorkerUsage {
+		status := grpcSrv.Status()
+		return grpcServer.WorkerUsage{
+			AvailableSpace: status.AvailableSpace,
+			UsedSpace:      status.UsedSpace,
+			CurrentLoad:    status.CurrentLoad,
+		}
+	})
+	fmt.Printf("Registering with master at %s\n", masterURL)
 	
 	// Start the multiplexer
 	if err := m.Serve(); err != nil {
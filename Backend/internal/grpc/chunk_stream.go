@@ -0,0 +1,266 @@
+package grpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"echofs/internal/metrics"
+	"echofs/internal/storage"
+	pb "echofs/proto/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ChunkFrameSize is the most chunk data sent in one stream message.
+	ChunkFrameSize = 64 * 1024
+
+	// StreamChunkThreshold is the chunk size above which the streaming
+	// RPCs should be used. gRPC messages are capped at 4MB by default and
+	// this leaves room for the rest of the message.
+	StreamChunkThreshold = 3 * 1024 * 1024
+)
+
+var errChunkChecksum = errors.New("chunk checksum mismatch")
+
+// chunkFrame is a message of a chunk stream, StoreChunkStreamRequest or
+// RetrieveChunkStreamResponse. A stream is a header, any number of data
+// frames and a trailer.
+type chunkFrame interface {
+	GetHeader() *pb.ChunkHeader
+	GetData() []byte
+	GetTrailer() *pb.ChunkTrailer
+}
+
+// chunkFrameReader reads the data of a chunk stream as it arrives. It
+// only returns io.EOF once the trailer has been checked, so the data is
+// only complete and verified if it reads to the end without an error.
+type chunkFrameReader struct {
+	recv     func() (chunkFrame, error)
+	header   *pb.ChunkHeader
+	hash     hash.Hash
+	received int64
+	pending  []byte
+	err      error
+}
+
+// newChunkFrameReader reads the header of the chunk stream from recv.
+func newChunkFrameReader(recv func() (chunkFrame, error)) (*chunkFrameReader, error) {
+	frame, err := recv()
+	if err != nil {
+		return nil, err
+	}
+	header := frame.GetHeader()
+	if header == nil {
+		return nil, errors.New("chunk stream does not start with a header")
+	}
+	return &chunkFrameReader{recv: recv, header: header, hash: sha256.New()}, nil
+}
+
+func (r *chunkFrameReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		data, err := r.next()
+		if err == nil && r.received == r.header.GetSize() {
+			// Check the trailer before handing out the last of the data,
+			// so a reader that stops after the header's size still sees a
+			// bad stream.
+			for err == nil {
+				_, err = r.next()
+			}
+			if err != io.EOF {
+				data = nil
+			}
+		}
+		r.pending, r.err = data, err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next receives the next frame and returns its data, or io.EOF once a
+// valid trailer arrives.
+func (r *chunkFrameReader) next() ([]byte, error) {
+	frame, err := r.recv()
+	if err == io.EOF {
+		return nil, fmt.Errorf("chunk stream for %s ended without a trailer", r.header.GetChunkId())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if trailer := frame.GetTrailer(); trailer != nil {
+		if r.received != r.header.GetSize() {
+			return nil, fmt.Errorf("chunk %s is %d bytes, %d received", r.header.GetChunkId(), r.header.GetSize(), r.received)
+		}
+		if !strings.EqualFold(hex.EncodeToString(r.hash.Sum(nil)), trailer.GetSha256()) {
+			return nil, fmt.Errorf("%w for chunk %s", errChunkChecksum, r.header.GetChunkId())
+		}
+		return nil, io.EOF
+	}
+	if frame.GetHeader() != nil {
+		return nil, fmt.Errorf("chunk stream for %s has a second header", r.header.GetChunkId())
+	}
+
+	data := frame.GetData()
+	r.received += int64(len(data))
+	if r.received > r.header.GetSize() {
+		return nil, fmt.Errorf("chunk %s is %d bytes, more received", r.header.GetChunkId(), r.header.GetSize())
+	}
+	r.hash.Write(data)
+	return data, nil
+}
+
+// readChunkFrames reads a chunk stream from recv and writes the chunk data
+// to w as it arrives. The data is only complete and verified once it
+// returns without error; otherwise what was written must be discarded.
+func readChunkFrames(recv func() (chunkFrame, error), w io.Writer) (*pb.ChunkHeader, error) {
+	r, err := newChunkFrameReader(recv)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+	return r.header, nil
+}
+
+// writeChunkFrames sends header, the header's size bytes read from r split
+// into frames, and a trailer with their checksum. send builds the message
+// from whichever of its arguments is set.
+func writeChunkFrames(send func(*pb.ChunkHeader, []byte, *pb.ChunkTrailer) error, header *pb.ChunkHeader, r io.Reader) error {
+	if err := send(header, nil, nil); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	var sent int64
+	for {
+		// A sent message may still be in use, so every frame gets its own
+		// buffer.
+		buf := make([]byte, ChunkFrameSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			sent += int64(n)
+			if err := send(nil, buf[:n], nil); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if sent != header.GetSize() {
+		return fmt.Errorf("chunk %s is %d bytes, %d read", header.GetChunkId(), header.GetSize(), sent)
+	}
+
+	return send(nil, nil, &pb.ChunkTrailer{Sha256: hex.EncodeToString(hash.Sum(nil))})
+}
+
+func storeChunkFrame(header *pb.ChunkHeader, data []byte, trailer *pb.ChunkTrailer) *pb.StoreChunkStreamRequest {
+	switch {
+	case header != nil:
+		return &pb.StoreChunkStreamRequest{Frame: &pb.StoreChunkStreamRequest_Header{Header: header}}
+	case trailer != nil:
+		return &pb.StoreChunkStreamRequest{Frame: &pb.StoreChunkStreamRequest_Trailer{Trailer: trailer}}
+	default:
+		return &pb.StoreChunkStreamRequest{Frame: &pb.StoreChunkStreamRequest_Data{Data: data}}
+	}
+}
+
+func retrieveChunkFrame(header *pb.ChunkHeader, data []byte, trailer *pb.ChunkTrailer) *pb.RetrieveChunkStreamResponse {
+	switch {
+	case header != nil:
+		return &pb.RetrieveChunkStreamResponse{Frame: &pb.RetrieveChunkStreamResponse_Header{Header: header}}
+	case trailer != nil:
+		return &pb.RetrieveChunkStreamResponse{Frame: &pb.RetrieveChunkStreamResponse_Trailer{Trailer: trailer}}
+	default:
+		return &pb.RetrieveChunkStreamResponse{Frame: &pb.RetrieveChunkStreamResponse_Data{Data: data}}
+	}
+}
+
+// StoreChunkStream receives a chunk in frames and writes it to the store
+// as it arrives. The store only keeps it if the whole chunk arrived and its
+// checksum matches.
+func (w *WorkerGRPCServer) StoreChunkStream(stream pb.WorkerService_StoreChunkStreamServer) error {
+	start := time.Now()
+
+	frames, err := newChunkFrameReader(func() (chunkFrame, error) { return stream.Recv() })
+	if err != nil {
+		return stream.SendAndClose(&pb.StoreChunkResponse{
+			Success:  false,
+			Message:  fmt.Sprintf("Failed to receive chunk: %v", err),
+			WorkerId: w.workerID,
+		})
+	}
+	header := frames.header
+	w.logger.Printf("gRPC StoreChunkStream called: fileID=%s, chunkID=%s, index=%d, size=%d",
+		header.GetFileId(), header.GetChunkId(), header.GetChunkIndex(), header.GetSize())
+
+	if metrics.AppMetrics != nil {
+		defer func() {
+			metrics.AppMetrics.RecordChunkProcessing(header.GetSize(), time.Since(start))
+		}()
+	}
+
+	err = w.store.StoreChunkFrom(stream.Context(), header.GetFileId(), header.GetChunkId(), int(header.GetChunkIndex()), frames, header.GetSize())
+	if err != nil {
+		return stream.SendAndClose(&pb.StoreChunkResponse{
+			Success:  false,
+			Message:  fmt.Sprintf("Failed to store chunk: %v", err),
+			WorkerId: w.workerID,
+		})
+	}
+	w.stats.addWritten(int(header.GetSize()))
+
+	return stream.SendAndClose(&pb.StoreChunkResponse{
+		Success:  true,
+		Message:  "Chunk stored successfully",
+		WorkerId: w.workerID,
+	})
+}
+
+// RetrieveChunkStream sends a stored chunk in frames as it is read from
+// the store.
+func (w *WorkerGRPCServer) RetrieveChunkStream(req *pb.RetrieveChunkRequest, stream pb.WorkerService_RetrieveChunkStreamServer) error {
+	w.logger.Printf("gRPC RetrieveChunkStream called: fileID=%s, chunkID=%s, index=%d",
+		req.GetFileId(), req.GetChunkId(), req.GetChunkIndex())
+
+	chunk, size, err := w.store.OpenChunk(stream.Context(), req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()))
+	if errors.Is(err, storage.ErrChunkNotFound) {
+		return status.Errorf(codes.NotFound, "Failed to retrieve chunk: %v", err)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to retrieve chunk: %v", err)
+	}
+	defer chunk.Close()
+
+	header := &pb.ChunkHeader{
+		FileId:     req.GetFileId(),
+		ChunkId:    req.GetChunkId(),
+		ChunkIndex: req.GetChunkIndex(),
+		Size:       size,
+	}
+	err = writeChunkFrames(func(header *pb.ChunkHeader, data []byte, trailer *pb.ChunkTrailer) error {
+		return stream.Send(retrieveChunkFrame(header, data, trailer))
+	}, header, chunk)
+	if err != nil {
+		return err
+	}
+	w.stats.addRead(int(size))
+	return nil
+}
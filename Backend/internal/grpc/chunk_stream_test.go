@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	pb "echofs/proto/v1"
+)
+
+// encodeChunk frames data the way a sender would.
+func encodeChunk(t *testing.T, data []byte) []chunkFrame {
+	t.Helper()
+	var frames []chunkFrame
+	header := &pb.ChunkHeader{FileId: "file", ChunkId: "chunk", Size: int64(len(data))}
+	err := writeChunkFrames(func(header *pb.ChunkHeader, data []byte, trailer *pb.ChunkTrailer) error {
+		frames = append(frames, storeChunkFrame(header, data, trailer))
+		return nil
+	}, header, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("writeChunkFrames: %v", err)
+	}
+	return frames
+}
+
+// replay returns a recv function handing out frames and then io.EOF.
+func replay(frames []chunkFrame) func() (chunkFrame, error) {
+	return func() (chunkFrame, error) {
+		if len(frames) == 0 {
+			return nil, io.EOF
+		}
+		frame := frames[0]
+		frames = frames[1:]
+		return frame, nil
+	}
+}
+
+func TestChunkFramesRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, ChunkFrameSize, 2*ChunkFrameSize + 7} {
+		data := bytes.Repeat([]byte("echo"), size/4+1)[:size]
+		frames := encodeChunk(t, data)
+		if want := 2 + (size+ChunkFrameSize-1)/ChunkFrameSize; len(frames) != want {
+			t.Errorf("%d bytes sent in %d frames, want %d", size, len(frames), want)
+		}
+
+		var got bytes.Buffer
+		header, err := readChunkFrames(replay(frames), &got)
+		if err != nil {
+			t.Fatalf("readChunkFrames(%d bytes): %v", size, err)
+		}
+		if header.GetChunkId() != "chunk" || !bytes.Equal(got.Bytes(), data) {
+			t.Errorf("readChunkFrames(%d bytes) = %s, %d bytes", size, header.GetChunkId(), got.Len())
+		}
+	}
+}
+
+func TestReadChunkFramesRejectsBadStreams(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), ChunkFrameSize+10)
+	good := encodeChunk(t, data)
+	header, body, trailer := good[0], good[1:len(good)-1], good[len(good)-1]
+	join := func(parts ...[]chunkFrame) []chunkFrame {
+		var frames []chunkFrame
+		for _, part := range parts {
+			frames = append(frames, part...)
+		}
+		return frames
+	}
+	badTrailer := storeChunkFrame(nil, nil, &pb.ChunkTrailer{Sha256: strings.Repeat("0", 64)})
+	extra := storeChunkFrame(nil, []byte("more"), nil)
+
+	tests := []struct {
+		name   string
+		frames []chunkFrame
+		want   string
+	}{
+		{name: "no header", frames: body, want: "does not start with a header"},
+		{name: "missing trailer", frames: join(good[:1], body), want: "without a trailer"},
+		{name: "bad checksum", frames: join(good[:1], body, []chunkFrame{badTrailer}), want: errChunkChecksum.Error()},
+		{name: "too short", frames: join(good[:1], body[:1], []chunkFrame{trailer}), want: "received"},
+		{name: "too long", frames: join(good[:1], body, []chunkFrame{extra, trailer}), want: "more received"},
+		{name: "second header", frames: join(good[:1], body[:1], []chunkFrame{header}, body[1:], []chunkFrame{trailer}), want: "second header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readChunkFrames(replay(tt.frames), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("readChunkFrames = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// A reader that stops after the header's size, as a store given the size
+// does, must still see a bad trailer.
+func TestChunkFrameReaderChecksTrailerBeforeLastData(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 100)
+	frames := encodeChunk(t, data)
+	frames[len(frames)-1] = storeChunkFrame(nil, nil, &pb.ChunkTrailer{Sha256: strings.Repeat("0", 64)})
+
+	r, err := newChunkFrameReader(replay(frames))
+	if err != nil {
+		t.Fatalf("newChunkFrameReader: %v", err)
+	}
+	buf := make([]byte, len(data))
+	if n, err := io.ReadFull(r, buf); !errors.Is(err, errChunkChecksum) {
+		t.Fatalf("ReadFull = %d, %v; want a checksum error", n, err)
+	}
+}
+
+func TestWriteChunkFramesChecksSize(t *testing.T) {
+	send := func(*pb.ChunkHeader, []byte, *pb.ChunkTrailer) error { return nil }
+	for _, size := range []int64{3, 5} {
+		header := &pb.ChunkHeader{ChunkId: "chunk", Size: size}
+		if err := writeChunkFrames(send, header, strings.NewReader("four")); err == nil {
+			t.Errorf("writeChunkFrames sent 4 bytes for a %d byte header", size)
+		}
+	}
+}
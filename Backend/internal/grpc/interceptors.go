@@ -1 +1,72 @@
-package grpc
\ No newline at end of file
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// workerTokenHeader carries the shared worker token on every call a
+// worker makes to the master.
+const workerTokenHeader = "authorization"
+
+// WorkerAuthInterceptor rejects calls that don't carry token, the master's
+// WORKER_TOKEN. Without a token only callers on the same host are let in,
+// which is enough for a local cluster and keeps strangers from registering
+// workers with a master reachable from outside.
+func WorkerAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorizeWorker(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authorizeWorker(ctx context.Context, token string) error {
+	if token == "" {
+		if p, ok := peer.FromContext(ctx); ok && isLoopback(p.Addr) {
+			return nil
+		}
+		return status.Error(codes.PermissionDenied, "the master has no WORKER_TOKEN and only accepts workers on its own host")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(workerTokenHeader) {
+		presented, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid worker token")
+}
+
+func isLoopback(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// workerToken sends the shared worker token with every call.
+type workerToken string
+
+func (t workerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{workerTokenHeader: "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity is false so local clusters can run in plaintext;
+// masters reached over the internet are dialled with TLS.
+func (workerToken) RequireTransportSecurity() bool { return false }
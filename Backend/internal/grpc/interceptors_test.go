@@ -0,0 +1,53 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func callerContext(t *testing.T, addr string, token string) context.Context {
+	t.Helper()
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		t.Fatalf("ResolveTCPAddr(%q): %v", addr, err)
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+	if token != "" {
+		md, _ := workerToken(token).GetRequestMetadata(ctx)
+		ctx = metadata.NewIncomingContext(ctx, metadata.New(md))
+	}
+	return ctx
+}
+
+func TestAuthorizeWorker(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		caller string
+		sent   string
+		want   codes.Code
+	}{
+		{name: "matching token", token: "secret", caller: "203.0.113.7:5000", sent: "secret", want: codes.OK},
+		{name: "wrong token", token: "secret", caller: "203.0.113.7:5000", sent: "guess", want: codes.Unauthenticated},
+		{name: "no token sent", token: "secret", caller: "203.0.113.7:5000", want: codes.Unauthenticated},
+		{name: "token required on loopback", token: "secret", caller: "127.0.0.1:5000", want: codes.Unauthenticated},
+		{name: "no master token, loopback", caller: "127.0.0.1:5000", want: codes.OK},
+		{name: "no master token, loopback v6", caller: "[::1]:5000", want: codes.OK},
+		{name: "no master token, remote", caller: "203.0.113.7:5000", sent: "anything", want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeWorker(callerContext(t, tt.caller, tt.sent), tt.token)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("authorizeWorker = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"time"
 	"strings"
+	"sync"
 	"crypto/tls"
 
 	"echofs/internal/metrics"
@@ -27,20 +29,8 @@ func NewWorkerClient(workerID, address string, logger *log.Logger) (*WorkerClien
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Determine if we should use TLS based on the address
-	var creds credentials.TransportCredentials
-	if strings.Contains(address, "onrender.com") || strings.Contains(address, ":443") {
-		// Use TLS for production endpoints
-		creds = credentials.NewTLS(&tls.Config{
-			ServerName: strings.Split(address, ":")[0], // Extract hostname
-		})
-	} else {
-		// Use insecure for localhost/development
-		creds = insecure.NewCredentials()
-	}
-
 	conn, err := grpc.DialContext(ctx, address, 
-		grpc.WithTransportCredentials(creds),
+		grpc.WithTransportCredentials(transportCredentials(address)),
 		grpc.WithUnaryInterceptor(metrics.UnaryClientInterceptor()),
 		grpc.WithBlock())
 	if err != nil {
@@ -58,6 +48,17 @@ func NewWorkerClient(workerID, address string, logger *log.Logger) (*WorkerClien
 	}, nil
 }
 
+// transportCredentials picks TLS for production endpoints and plaintext for
+// localhost/development, based on the address.
+func transportCredentials(address string) credentials.TransportCredentials {
+	if strings.Contains(address, "onrender.com") || strings.Contains(address, ":443") {
+		return credentials.NewTLS(&tls.Config{
+			ServerName: strings.Split(address, ":")[0], // Extract hostname
+		})
+	}
+	return insecure.NewCredentials()
+}
+
 func (wc *WorkerClient) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte, md5Hash string) (*pb.StoreChunkResponse, error) {
 	req := &pb.StoreChunkRequest{
 		FileId:     fileID,
@@ -137,12 +138,91 @@ func (wc *WorkerClient) GetStatus(ctx context.Context) (*pb.WorkerStatusResponse
 	return resp, nil
 }
 
+// ListChunks returns one page of the chunks the worker stores, starting at
+// pageToken; the response's NextPageToken is empty on the last page.
+func (wc *WorkerClient) ListChunks(ctx context.Context, pageToken string, pageSize int) (*pb.ListChunksResponse, error) {
+	req := &pb.ListChunksRequest{
+		WorkerId:  wc.workerID,
+		PageToken: pageToken,
+		PageSize:  int32(pageSize),
+	}
+
+	resp, err := wc.client.ListChunks(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks on worker %s: %v", wc.workerID, err)
+	}
+
+	return resp, nil
+}
+
+// StoreChunkStream sends a chunk of size bytes read from r to the worker in
+// frames, for chunks too large for StoreChunk.
+func (wc *WorkerClient) StoreChunkStream(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) (*pb.StoreChunkResponse, error) {
+	wc.logger.Printf("Streaming chunk %s (index %d, %d bytes) to worker %s via gRPC", chunkID, chunkIndex, size, wc.workerID)
+
+	stream, err := wc.client.StoreChunkStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store chunk on worker %s: %v", wc.workerID, err)
+	}
+
+	header := &pb.ChunkHeader{
+		FileId:     fileID,
+		ChunkId:    chunkID,
+		ChunkIndex: int32(chunkIndex),
+		Size:       size,
+	}
+	err = writeChunkFrames(func(header *pb.ChunkHeader, data []byte, trailer *pb.ChunkTrailer) error {
+		return stream.Send(storeChunkFrame(header, data, trailer))
+	}, header, r)
+	// io.EOF means the worker ended the stream; its reason comes with the
+	// response.
+	if err != nil && err != io.EOF {
+		stream.CloseSend()
+		return nil, fmt.Errorf("failed to store chunk on worker %s: %v", wc.workerID, err)
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store chunk on worker %s: %v", wc.workerID, err)
+	}
+
+	return resp, nil
+}
+
+// RetrieveChunkStream reads a chunk from the worker in frames, for chunks
+// too large for RetrieveChunk, writing it to w as it arrives. It returns
+// the chunk size; on error whatever was written to w must be discarded.
+func (wc *WorkerClient) RetrieveChunkStream(ctx context.Context, fileID, chunkID string, chunkIndex int, w io.Writer) (int64, error) {
+	req := &pb.RetrieveChunkRequest{
+		FileId:     fileID,
+		ChunkId:    chunkID,
+		ChunkIndex: int32(chunkIndex),
+	}
+
+	wc.logger.Printf("Streaming chunk %s (index %d) from worker %s via gRPC", chunkID, chunkIndex, wc.workerID)
+
+	stream, err := wc.client.RetrieveChunkStream(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve chunk from worker %s: %v", wc.workerID, err)
+	}
+
+	header, err := readChunkFrames(func() (chunkFrame, error) { return stream.Recv() }, w)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve chunk from worker %s: %w", wc.workerID, err)
+	}
+
+	return header.GetSize(), nil
+}
+
 func (wc *WorkerClient) Close() error {
 	return wc.conn.Close()
 }
 
+// WorkerRegistry holds a connection to every worker available for chunks.
+// Workers come and go as they register and miss heartbeats.
 type WorkerRegistry struct {
 	workers map[string]*WorkerClient
+	mutex   sync.RWMutex
 	logger  *log.Logger
 }
 
@@ -153,30 +233,59 @@ func NewWorkerRegistry(logger *log.Logger) *WorkerRegistry {
 	}
 }
 
+// RegisterWorker connects to the worker at address, replacing any previous
+// connection to it. A worker already connected at the same address is kept.
 func (wr *WorkerRegistry) RegisterWorker(workerID, address string) error {
+	wr.mutex.RLock()
+	existing, exists := wr.workers[workerID]
+	wr.mutex.RUnlock()
+	if exists && existing.address == address {
+		return nil
+	}
+
 	client, err := NewWorkerClient(workerID, address, wr.logger)
 	if err != nil {
 		return err
 	}
 
+	wr.mutex.Lock()
+	previous, replaced := wr.workers[workerID]
 	wr.workers[workerID] = client
+	wr.mutex.Unlock()
+	if replaced {
+		previous.Close()
+	}
+
 	wr.logger.Printf("Registered worker %s at %s via gRPC", workerID, address)
 	return nil
 }
 
 func (wr *WorkerRegistry) GetWorker(workerID string) (*WorkerClient, bool) {
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
 	client, exists := wr.workers[workerID]
 	return client, exists
 }
 
+// GetAllWorkers returns a copy of the connected workers.
 func (wr *WorkerRegistry) GetAllWorkers() map[string]*WorkerClient {
-	return wr.workers
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
+	workers := make(map[string]*WorkerClient, len(wr.workers))
+	for workerID, client := range wr.workers {
+		workers[workerID] = client
+	}
+	return workers
 }
 
 func (wr *WorkerRegistry) RemoveWorker(workerID string) {
-	if client, exists := wr.workers[workerID]; exists {
+	wr.mutex.Lock()
+	client, exists := wr.workers[workerID]
+	delete(wr.workers, workerID)
+	wr.mutex.Unlock()
+
+	if exists {
 		client.Close()
-		delete(wr.workers, workerID)
 		wr.logger.Printf("Removed worker %s from registry", workerID)
 	}
 }
\ No newline at end of file
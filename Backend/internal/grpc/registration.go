@@ -0,0 +1,201 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "echofs/proto/v1"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// defaultHeartbeatInterval applies when the master doesn't set one.
+	defaultHeartbeatInterval = 30 * time.Second
+	// registerRetryInterval is how long a worker waits before trying to
+	// register again after a failure.
+	registerRetryInterval = 5 * time.Second
+)
+
+// WorkerInfo is what a worker registers with.
+type WorkerInfo struct {
+	WorkerID string
+	// Address is where the master reaches the worker, host:port. Empty
+	// lets the master use the address the registration came from.
+	Address    string
+	GRPCPort   int
+	TotalSpace int64
+	Labels     map[string]string
+}
+
+// WorkerUsage is what a worker reports in its heartbeats.
+type WorkerUsage struct {
+	AvailableSpace int64
+	UsedSpace      int64
+	CurrentLoad    int
+}
+
+// MasterClient is a worker's connection to the master's MasterService.
+type MasterClient struct {
+	conn    *grpc.ClientConn
+	client  pb.MasterServiceClient
+	address string
+	logger  *log.Logger
+}
+
+// MasterAddress turns a master URL such as https://echofs.onrender.com or
+// http://localhost:8080 into a host:port to dial. A host:port is returned
+// as is.
+func MasterAddress(masterURL string) string {
+	u, err := url.Parse(masterURL)
+	if err != nil || u.Host == "" {
+		return masterURL
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return u.Host + ":443"
+	}
+	return u.Host + ":80"
+}
+
+// NewMasterClient connects to the master at address lazily, so a worker
+// can start before the master. A non-empty token, the master's
+// WORKER_TOKEN, is sent with every call.
+func NewMasterClient(address, token string, logger *log.Logger) (*MasterClient, error) {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(transportCredentials(address))}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(workerToken(token)))
+	}
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to master at %s: %v", address, err)
+	}
+
+	return &MasterClient{
+		conn:    conn,
+		client:  pb.NewMasterServiceClient(conn),
+		address: address,
+		logger:  logger,
+	}, nil
+}
+
+func (mc *MasterClient) Register(ctx context.Context, info WorkerInfo) (*pb.RegisterWorkerResponse, error) {
+	req := &pb.RegisterWorkerRequest{
+		WorkerId:       info.WorkerID,
+		Address:        info.Address,
+		GrpcPort:       int32(info.GRPCPort),
+		AvailableSpace: info.TotalSpace,
+		TotalSpace:     info.TotalSpace,
+		Labels:         info.Labels,
+	}
+
+	resp, err := mc.client.RegisterWorker(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register with master at %s: %v", mc.address, err)
+	}
+
+	return resp, nil
+}
+
+func (mc *MasterClient) Heartbeat(ctx context.Context, workerID string, usage WorkerUsage) (*pb.HeartbeatResponse, error) {
+	req := &pb.HeartbeatRequest{
+		WorkerId:       workerID,
+		AvailableSpace: usage.AvailableSpace,
+		UsedSpace:      usage.UsedSpace,
+		CurrentLoad:    int32(usage.CurrentLoad),
+	}
+
+	resp, err := mc.client.Heartbeat(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send heartbeat to master at %s: %v", mc.address, err)
+	}
+
+	return resp, nil
+}
+
+// KeepRegistered registers the worker and sends heartbeats, with the usage
+// usage returns, at the interval the master asks for until ctx is done.
+// The worker registers again whenever the master doesn't know it, such as
+// after a master restart.
+func (mc *MasterClient) KeepRegistered(ctx context.Context, info WorkerInfo, usage func(context.Context) WorkerUsage) {
+	for ctx.Err() == nil {
+		registerCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		resp, err := mc.Register(registerCtx, info)
+		cancel()
+		if err == nil && !resp.GetSuccess() {
+			err = fmt.Errorf("%s", resp.GetMessage())
+		}
+		if err != nil {
+			mc.logger.Printf("Failed to register worker %s: %v", info.WorkerID, err)
+			sleep(ctx, registerRetryInterval)
+			continue
+		}
+		mc.logger.Printf("Registered worker %s with master at %s", info.WorkerID, mc.address)
+
+		interval := time.Duration(resp.GetHeartbeatIntervalSeconds()) * time.Second
+		if interval <= 0 {
+			interval = defaultHeartbeatInterval
+		}
+		mc.sendHeartbeats(ctx, info.WorkerID, interval, usage)
+	}
+}
+
+// sendHeartbeats returns once the master asks the worker to register
+// again or ctx is done. Failed heartbeats are retried on the next tick;
+// the master marks the worker offline if they keep failing.
+func (mc *MasterClient) sendHeartbeats(ctx context.Context, workerID string, interval time.Duration, usage func(context.Context) WorkerUsage) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		heartbeatCtx, cancel := context.WithTimeout(ctx, interval)
+		resp, err := mc.Heartbeat(heartbeatCtx, workerID, usage(heartbeatCtx))
+		cancel()
+		if err != nil {
+			mc.logger.Printf("Heartbeat of worker %s failed: %v", workerID, err)
+			continue
+		}
+		if resp.GetReregister() {
+			mc.logger.Printf("Master asked worker %s to register again", workerID)
+			return
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (mc *MasterClient) Close() error {
+	return mc.conn.Close()
+}
+
+// ParseLabels parses labels written as key=value pairs separated by
+// commas, such as "zone=us-east-1a,disk=ssd".
+func ParseLabels(spec string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			labels[key] = strings.TrimSpace(value)
+		}
+	}
+	return labels
+}
@@ -13,18 +13,27 @@ import (
 	"google.golang.org/grpc"
 )
 
+// WorkerGRPCServer serves the chunks kept in store.
 type WorkerGRPCServer struct {
 	pb.UnimplementedWorkerServiceServer
-	workerID    string
-	s3Storage   *storage.S3Storage
-	logger      *log.Logger
+	workerID string
+	store    storage.ChunkStore
+	logger   *log.Logger
+
+	// address, port and capacity are what the worker reports about itself;
+	// stats tracks its storage and the RPCs it serves.
+	address  string
+	port     int
+	capacity int64
+	stats    *workerStats
 }
 
-func NewWorkerGRPCServer(workerID string, s3Storage *storage.S3Storage, logger *log.Logger) *WorkerGRPCServer {
+func NewWorkerGRPCServer(workerID string, store storage.ChunkStore, logger *log.Logger) *WorkerGRPCServer {
 	return &WorkerGRPCServer{
-		workerID:  workerID,
-		s3Storage: s3Storage,
-		logger:    logger,
+		workerID: workerID,
+		store:    store,
+		logger:   logger,
+		stats:    newWorkerStats(),
 	}
 }
 
@@ -41,28 +50,19 @@ func (w *WorkerGRPCServer) StoreChunk(ctx context.Context, req *pb.StoreChunkReq
 		}()
 	}
 
-	if w.s3Storage != nil {
-		err := w.s3Storage.StoreChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()), req.GetChunkData())
-		if err != nil {
-			return &pb.StoreChunkResponse{
-				Success:  false,
-				Message:  fmt.Sprintf("Failed to store chunk: %v", err),
-				WorkerId: w.workerID,
-			}, nil
-		}
-
-		s3Key := fmt.Sprintf("files/%s/chunks/%s_%d", req.GetFileId(), req.GetChunkId(), req.GetChunkIndex())
+	err := w.store.StoreChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()), req.GetChunkData())
+	if err != nil {
 		return &pb.StoreChunkResponse{
-			Success:  true,
-			Message:  "Chunk stored successfully in S3",
+			Success:  false,
+			Message:  fmt.Sprintf("Failed to store chunk: %v", err),
 			WorkerId: w.workerID,
-			S3Key:    s3Key,
 		}, nil
 	}
+	w.stats.addWritten(len(req.GetChunkData()))
 
 	return &pb.StoreChunkResponse{
 		Success:  true,
-		Message:  "Chunk stored successfully (simulated)",
+		Message:  "Chunk stored successfully",
 		WorkerId: w.workerID,
 	}, nil
 }
@@ -71,26 +71,19 @@ func (w *WorkerGRPCServer) RetrieveChunk(ctx context.Context, req *pb.RetrieveCh
 	w.logger.Printf("gRPC RetrieveChunk called: fileID=%s, chunkID=%s, index=%d", 
 		req.GetFileId(), req.GetChunkId(), req.GetChunkIndex())
 
-	if w.s3Storage != nil {
-		data, err := w.s3Storage.RetrieveChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()))
-		if err != nil {
-			return &pb.RetrieveChunkResponse{
-				Success: false,
-				Message: fmt.Sprintf("Failed to retrieve chunk: %v", err),
-			}, nil
-		}
-
+	data, err := w.store.RetrieveChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()))
+	if err != nil {
 		return &pb.RetrieveChunkResponse{
-			Success:   true,
-			ChunkData: data,
-			Message:   "Chunk retrieved successfully from S3",
+			Success: false,
+			Message: fmt.Sprintf("Failed to retrieve chunk: %v", err),
 		}, nil
 	}
+	w.stats.addRead(len(data))
 
 	return &pb.RetrieveChunkResponse{
 		Success:   true,
-		ChunkData: []byte("simulated chunk data"),
-		Message:   "Chunk retrieved successfully (simulated)",
+		ChunkData: data,
+		Message:   "Chunk retrieved successfully",
 	}, nil
 }
 
@@ -98,15 +91,13 @@ func (w *WorkerGRPCServer) DeleteChunk(ctx context.Context, req *pb.DeleteChunkR
 	w.logger.Printf("gRPC DeleteChunk called: fileID=%s, chunkID=%s, index=%d", 
 		req.GetFileId(), req.GetChunkId(), req.GetChunkIndex())
 
-	if w.s3Storage != nil {
-		err := w.s3Storage.DeleteChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()))
-		if err != nil {
-			return &pb.DeleteChunkResponse{
-				Success:  false,
-				Message:  fmt.Sprintf("Failed to delete chunk: %v", err),
-				WorkerId: w.workerID,
-			}, nil
-		}
+	err := w.store.DeleteChunk(ctx, req.GetFileId(), req.GetChunkId(), int(req.GetChunkIndex()))
+	if err != nil {
+		return &pb.DeleteChunkResponse{
+			Success:  false,
+			Message:  fmt.Sprintf("Failed to delete chunk: %v", err),
+			WorkerId: w.workerID,
+		}, nil
 	}
 
 	return &pb.DeleteChunkResponse{
@@ -116,6 +107,35 @@ func (w *WorkerGRPCServer) DeleteChunk(ctx context.Context, req *pb.DeleteChunkR
 	}, nil
 }
 
+func (w *WorkerGRPCServer) ListChunks(ctx context.Context, req *pb.ListChunksRequest) (*pb.ListChunksResponse, error) {
+	stored, nextPageToken, err := w.store.ListStoredChunks(ctx, req.GetPageToken(), int(req.GetPageSize()))
+	if err != nil {
+		return &pb.ListChunksResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to list chunks: %v", err),
+		}, nil
+	}
+
+	chunks := make([]*pb.StoredChunk, 0, len(stored))
+	for _, chunk := range stored {
+		chunks = append(chunks, &pb.StoredChunk{
+			FileId:     chunk.FileID,
+			ChunkId:    chunk.ChunkID,
+			ChunkIndex: int32(chunk.ChunkIndex),
+			Size:       chunk.Size,
+			ModifiedAt: chunk.ModifiedAt.Unix(),
+		})
+	}
+
+	return &pb.ListChunksResponse{
+		Success:       true,
+		Message:       "Chunks listed successfully",
+		Chunks:        chunks,
+		NextPageToken: nextPageToken,
+		SharedStorage: storage.IsShared(w.store),
+	}, nil
+}
+
 func (w *WorkerGRPCServer) HealthCheck(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
 	return &pb.HealthCheckResponse{
 		Healthy:   true,
@@ -125,14 +145,24 @@ func (w *WorkerGRPCServer) HealthCheck(ctx context.Context, req *pb.HealthCheckR
 }
 
 func (w *WorkerGRPCServer) GetStatus(ctx context.Context, req *pb.WorkerStatusRequest) (*pb.WorkerStatusResponse, error) {
+	status := w.Status()
 	return &pb.WorkerStatusResponse{
-		WorkerId:       w.workerID,
-		Address:        "localhost",
-		Port:           8081,
-		AvailableSpace: 1000000000,
-		CurrentLoad:    0,
-		Status:         "online",
-		LastHeartbeat:  time.Now().Unix(),
+		WorkerId:            status.WorkerID,
+		Address:             status.Address,
+		Port:                int32(status.Port),
+		AvailableSpace:      status.AvailableSpace,
+		CurrentLoad:         int32(status.CurrentLoad),
+		Status:              status.Status,
+		LastHeartbeat:       time.Now().Unix(),
+		UsedSpace:           status.UsedSpace,
+		TotalSpace:          status.TotalSpace,
+		ChunksStored:        status.ChunksStored,
+		InFlightRpcs:        int32(status.CurrentLoad),
+		WriteBytesPerSecond: status.WriteBytesPerSecond,
+		ReadBytesPerSecond:  status.ReadBytesPerSecond,
+		RequestsPerSecond:   status.RequestsPerSecond,
+		ErrorRate:           status.ErrorRate,
+		SharedStorage:       status.SharedStorage,
 	}, nil
 }
 
@@ -142,10 +172,7 @@ func (w *WorkerGRPCServer) StartGRPCServer(port int) error {
 		return fmt.Errorf("failed to listen on port %d: %v", port, err)
 	}
 
-	s := grpc.NewServer(
-		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(metrics.StreamServerInterceptor()),
-	)
+	s := grpc.NewServer(w.serverOptions()...)
 	pb.RegisterWorkerServiceServer(s, w)
 
 	w.logger.Printf("Worker gRPC server listening on port %d", port)
@@ -153,10 +180,7 @@ func (w *WorkerGRPCServer) StartGRPCServer(port int) error {
 }
 
 func (w *WorkerGRPCServer) ServeGRPC(lis net.Listener) error {
-	s := grpc.NewServer(
-		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(metrics.StreamServerInterceptor()),
-	)
+	s := grpc.NewServer(w.serverOptions()...)
 	pb.RegisterWorkerServiceServer(s, w)
 
 	w.logger.Printf("Worker gRPC server serving on provided listener")
@@ -0,0 +1,291 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"echofs/internal/metrics"
+	"echofs/internal/storage"
+	pb "echofs/proto/v1"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// statsWindow is how far back a worker's rates look, in seconds.
+	statsWindow = 60
+
+	// UsageRefreshInterval is how often a worker measures its storage.
+	// Measuring lists every stored chunk, so it isn't done per request.
+	UsageRefreshInterval = time.Minute
+)
+
+// WorkerStatus is a worker's state as GetStatus and the worker's HTTP
+// /status endpoint report it.
+type WorkerStatus struct {
+	WorkerID string `json:"worker"`
+	Address  string `json:"address,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Status   string `json:"status"`
+
+	// AvailableSpace and TotalSpace are 0 when the worker's capacity is
+	// unknown: no WORKER_CAPACITY and a store that isn't on a local disk.
+	AvailableSpace int64 `json:"available_space"`
+	UsedSpace      int64 `json:"used_space"`
+	TotalSpace     int64 `json:"total_space"`
+	ChunksStored   int64 `json:"chunks_stored"`
+	// SharedStorage is set when the worker stores chunks somewhere all
+	// workers share, such as S3. Its usage isn't measured then, and a
+	// WORKER_CAPACITY only weights its share of new chunks.
+	SharedStorage bool `json:"shared_storage,omitempty"`
+	// UsageMeasuredAt is when the figures above were last measured.
+	UsageMeasuredAt time.Time `json:"usage_measured_at"`
+	UsageError      string    `json:"usage_error,omitempty"`
+
+	// CurrentLoad is the number of chunk RPCs in flight.
+	CurrentLoad int `json:"current_load"`
+	// Rates over the last minute; ErrorRate is the share of failed RPCs.
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	RequestsPerSecond   float64 `json:"requests_per_second"`
+	ErrorRate           float64 `json:"error_rate"`
+}
+
+// rateBucket is what happened during one second.
+type rateBucket struct {
+	second   int64
+	requests int64
+	errors   int64
+	written  int64
+	read     int64
+}
+
+// workerStats tracks the RPCs a worker serves and its latest storage
+// measurement.
+type workerStats struct {
+	inFlight atomic.Int64
+	started  time.Time
+
+	mutex      sync.Mutex
+	buckets    [statsWindow]rateBucket
+	usage      storage.StorageUsage
+	usageErr   error
+	measuredAt time.Time
+}
+
+func newWorkerStats() *workerStats {
+	return &workerStats{started: time.Now()}
+}
+
+func (s *workerStats) record(update func(b *rateBucket)) {
+	second := time.Now().Unix()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := &s.buckets[second%statsWindow]
+	if b.second != second {
+		*b = rateBucket{second: second}
+	}
+	update(b)
+}
+
+func (s *workerStats) addWritten(n int) {
+	s.record(func(b *rateBucket) { b.written += int64(n) })
+}
+
+func (s *workerStats) addRead(n int) {
+	s.record(func(b *rateBucket) { b.read += int64(n) })
+}
+
+func (s *workerStats) finishRPC(failed bool) {
+	s.inFlight.Add(-1)
+	s.record(func(b *rateBucket) {
+		b.requests++
+		if failed {
+			b.errors++
+		}
+	})
+}
+
+func (s *workerStats) setUsage(usage storage.StorageUsage, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err == nil {
+		s.usage = usage
+		s.measuredAt = time.Now()
+	}
+	s.usageErr = err
+}
+
+// fill sets the usage and rates of status.
+func (s *workerStats) fill(status *WorkerStatus) {
+	now := time.Now()
+	var total rateBucket
+
+	s.mutex.Lock()
+	for _, b := range s.buckets {
+		if age := now.Unix() - b.second; age >= 0 && age < statsWindow {
+			total.requests += b.requests
+			total.errors += b.errors
+			total.written += b.written
+			total.read += b.read
+		}
+	}
+	status.UsedSpace = s.usage.UsedBytes
+	status.ChunksStored = s.usage.Chunks
+	status.TotalSpace = s.usage.TotalBytes
+	status.AvailableSpace = s.usage.FreeBytes
+	status.SharedStorage = s.usage.Shared
+	status.UsageMeasuredAt = s.measuredAt
+	if s.usageErr != nil {
+		status.UsageError = s.usageErr.Error()
+	}
+	s.mutex.Unlock()
+
+	// A worker that started less than a minute ago hasn't had the whole
+	// window to serve requests in.
+	window := time.Duration(statsWindow) * time.Second
+	if uptime := now.Sub(s.started); uptime < window {
+		window = uptime
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+
+	status.CurrentLoad = int(s.inFlight.Load())
+	status.WriteBytesPerSecond = float64(total.written) / window.Seconds()
+	status.ReadBytesPerSecond = float64(total.read) / window.Seconds()
+	status.RequestsPerSecond = float64(total.requests) / window.Seconds()
+	if total.requests > 0 {
+		status.ErrorRate = float64(total.errors) / float64(total.requests)
+	}
+}
+
+// countedRPC leaves the status RPCs out of the load and rates they
+// report.
+func countedRPC(fullMethod string) bool {
+	return fullMethod != pb.WorkerService_GetStatus_FullMethodName &&
+		fullMethod != pb.WorkerService_HealthCheck_FullMethodName
+}
+
+// failedResponse tells whether a response reports a failure in its
+// success field, the way most worker RPCs do instead of returning an
+// error.
+func failedResponse(resp interface{}) bool {
+	r, ok := resp.(interface{ GetSuccess() bool })
+	return ok && !r.GetSuccess()
+}
+
+func (s *workerStats) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !countedRPC(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		s.inFlight.Add(1)
+		resp, err := handler(ctx, req)
+		s.finishRPC(err != nil || failedResponse(resp))
+		return resp, err
+	}
+}
+
+// statsStream notes whether a stream sent a response reporting a failure.
+type statsStream struct {
+	grpc.ServerStream
+	failed bool
+}
+
+func (s *statsStream) SendMsg(m interface{}) error {
+	if failedResponse(m) {
+		s.failed = true
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *workerStats) streamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s.inFlight.Add(1)
+		wrapped := &statsStream{ServerStream: stream}
+		err := handler(srv, wrapped)
+		s.finishRPC(err != nil || wrapped.failed)
+		return err
+	}
+}
+
+// serverOptions are the interceptors of a worker's gRPC server.
+func (w *WorkerGRPCServer) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor(), w.stats.unaryInterceptor()),
+		grpc.ChainStreamInterceptor(metrics.StreamServerInterceptor(), w.stats.streamInterceptor()),
+	}
+}
+
+// SetEndpoint sets the address and port the worker reports. Call it
+// before serving.
+func (w *WorkerGRPCServer) SetEndpoint(address string, port int) {
+	w.address = address
+	w.port = port
+}
+
+// SetCapacity limits the space the worker offers to capacity bytes, on top
+// of the free space of its disk. Call it before serving.
+func (w *WorkerGRPCServer) SetCapacity(capacity int64) {
+	w.capacity = capacity
+}
+
+// RefreshUsage measures the worker's storage now.
+func (w *WorkerGRPCServer) RefreshUsage(ctx context.Context) error {
+	usage, err := storage.MeasureUsage(ctx, w.store)
+	w.stats.setUsage(usage, err)
+	if err == nil && !usage.Shared && metrics.AppMetrics != nil {
+		metrics.AppMetrics.StorageUsageBytes.Set(float64(usage.UsedBytes))
+	}
+	return err
+}
+
+// MonitorUsage measures the worker's storage every interval until ctx is
+// done.
+func (w *WorkerGRPCServer) MonitorUsage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RefreshUsage(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Printf("Failed to measure storage usage: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status reports the worker's storage, as last measured, and its current
+// load and rates.
+func (w *WorkerGRPCServer) Status() WorkerStatus {
+	status := WorkerStatus{
+		WorkerID: w.workerID,
+		Address:  w.address,
+		Port:     w.port,
+		Status:   "online",
+	}
+	w.stats.fill(&status)
+
+	// A configured capacity caps what the disk has free.
+	if w.capacity > 0 {
+		available := w.capacity - status.UsedSpace
+		if status.TotalSpace > 0 && status.AvailableSpace < available {
+			available = status.AvailableSpace
+		}
+		if available < 0 {
+			available = 0
+		}
+		status.TotalSpace = w.capacity
+		status.AvailableSpace = available
+	}
+	return status
+}
@@ -6,11 +6,28 @@ import (
 
 type FileMetadata struct {
 	FileID       string    `json:"file_id"`
+	// ObjectID is shared by all versions of a file and is what clients
+	// refer to the file by; FileID names one version. Versions count from
+	// 1 and IsCurrent marks the one served by default.
+	ObjectID  string `json:"object_id"`
+	Version   int64  `json:"version"`
+	IsCurrent bool   `json:"is_current"`
+	// FolderID is the folder holding the file, "" for the owner's root.
+	FolderID     string    `json:"folder_id,omitempty"`
+	// DeletedAt is set while the file is in its owner's trash; DeletedPath
+	// is then the folder it was deleted from.
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	DeletedPath  string     `json:"deleted_path,omitempty"`
 	Size         int64     `json:"size"`
 	OriginalName string    `json:"original_name"`
 	ChunkSize    int       `json:"chunk_size"`
 	TotalChunks  int       `json:"total_chunks"`
 	MD5Hash      string    `json:"md5_hash"`
+	SHA256Hash   string    `json:"sha256_hash"`
+	// EncryptionKeyID names the master key WrappedDataKey is wrapped with;
+	// both are empty for files stored unencrypted.
+	EncryptionKeyID string `json:"encryption_key_id,omitempty"`
+	WrappedDataKey  []byte `json:"-"`
 	UploadedBy   string    `json:"uploaded_by"` // User ID
 	OwnerID      string    `json:"owner_id"`    // User ID for access control
 	CreatedAt    time.Time `json:"created_at"`
@@ -18,13 +35,37 @@ type FileMetadata struct {
 	Status       string    `json:"status"`
 }
 
+// Folder is a directory of an owner's namespace. ParentID is "" for folders
+// at the root; Path is the folder's full path, filled in when known.
+type Folder struct {
+	FolderID  string    `json:"folder_id"`
+	OwnerID   string    `json:"owner_id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChunkRef is one entry of a file's chunk map. Size and Offset describe the
+// chunk in the original file, StoredSize and StoredOffset the bytes kept on
+// the workers after compression. Chunks with DataShards set are erasure
+// coded: Workers then lists the worker of each shard in shard order, with
+// "" for shards that are missing.
 type ChunkRef struct {
-	ChunkID   string   `json:"chunk_id"`
-	Index     int      `json:"index"`
-	Size      int64    `json:"size"`
-	Checksum  string   `json:"checksum"`
-	Workers   []string `json:"workers"`
-	Version   int64    `json:"version"`
+	ChunkID      string   `json:"chunk_id"`
+	Index        int      `json:"index"`
+	Size         int64    `json:"size"`
+	Offset       int64    `json:"offset"`
+	StoredSize   int64    `json:"stored_size"`
+	StoredOffset int64    `json:"stored_offset"`
+	Checksum     string   `json:"checksum"`
+	Compression  string   `json:"compression"`
+	DataShards   int      `json:"data_shards,omitempty"`
+	ParityShards int      `json:"parity_shards,omitempty"`
+	Workers      []string `json:"workers"`
+	RefCount     int64    `json:"ref_count"`
+	Version      int64    `json:"version"`
 }
 
 type ObjectMeta struct {
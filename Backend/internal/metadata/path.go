@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxNameLength is the longest file or folder name accepted, in bytes.
+const MaxNameLength = 255
+
+var ErrInvalidPath = errors.New("invalid path")
+
+// SplitPath splits a slash-separated path into its names, root first. The
+// leading slash is optional and "" or "/" is the root, which has no names.
+// Paths are taken literally: "." and ".." are rejected rather than resolved.
+func SplitPath(path string) ([]string, error) {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	names := strings.Split(trimmed, "/")
+	for _, name := range names {
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// SplitDir splits a path into the names of its directory and its last name,
+// which must not be the root.
+func SplitDir(path string) ([]string, string, error) {
+	names, err := SplitPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(names) == 0 {
+		return nil, "", ErrInvalidPath
+	}
+	return names[:len(names)-1], names[len(names)-1], nil
+}
+
+// JoinPath is the inverse of SplitPath.
+func JoinPath(names ...string) string {
+	return "/" + strings.Join(names, "/")
+}
+
+// ValidateName checks that name can be a single file or folder name.
+func ValidateName(name string) error {
+	switch {
+	case name == "", name == ".", name == "..":
+		return ErrInvalidPath
+	case len(name) > MaxNameLength:
+		return ErrInvalidPath
+	case strings.ContainsAny(name, "/\x00"):
+		return ErrInvalidPath
+	}
+	return nil
+}
@@ -1 +1,264 @@
-package metadata
\ No newline at end of file
+package metadata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"echofs/cmd/master/core"
+)
+
+var ErrNoWorkers = errors.New("no workers in hash ring")
+
+var _ core.ChunkPlacer = (*HashRing)(nil)
+
+// DefaultVirtualNodes is used when the ring is created with a non-positive
+// number of virtual nodes per worker.
+const DefaultVirtualNodes = 100
+
+type virtualNode struct {
+	hash     uint64
+	workerID string
+}
+
+type ringMember struct {
+	node   *core.WorkerNode
+	weight float64
+	vnodes int
+}
+
+// HashRing places chunks on workers with consistent hashing. Every worker owns
+// a number of virtual nodes proportional to its weight, and a chunk is stored
+// on the first distinct workers found walking clockwise from the chunk's hash.
+// Adding or removing a worker only moves the chunks whose arc it gains or
+// loses. HashRing implements core.ChunkPlacer.
+type HashRing struct {
+	mu            sync.RWMutex
+	vnodesPerUnit int
+	replicas      int
+	members       map[string]*ringMember
+	ring          []virtualNode
+}
+
+// NewHashRing creates an empty ring. vnodesPerWorker is the number of virtual
+// nodes of a worker with weight 1 and replicas the number of workers
+// returned for each chunk.
+func NewHashRing(vnodesPerWorker, replicas int) *HashRing {
+	if vnodesPerWorker <= 0 {
+		vnodesPerWorker = DefaultVirtualNodes
+	}
+	if replicas <= 0 {
+		replicas = 1
+	}
+	return &HashRing{
+		vnodesPerUnit: vnodesPerWorker,
+		replicas:      replicas,
+		members:       make(map[string]*ringMember),
+	}
+}
+
+// ChunkKey is the ring key of a chunk whose content is not known yet, such
+// as the expected placement of a resumable upload's chunks. PlaceChunk
+// places chunks by this key.
+func ChunkKey(fileID string, chunkIndex int) string {
+	return fmt.Sprintf("%s_chunk_%d", fileID, chunkIndex)
+}
+
+// CapacityWeight returns the weight of a worker with totalStorage bytes
+// relative to a baseline capacity, so a worker with twice the storage
+// receives roughly twice the chunks. Workers that have not reported their
+// capacity get weight 1.
+func CapacityWeight(totalStorage, baseline int64) float64 {
+	if totalStorage <= 0 || baseline <= 0 {
+		return 1
+	}
+	return float64(totalStorage) / float64(baseline)
+}
+
+// AddWorker adds a worker to the ring or updates it and its weight. A
+// weight of 1 gives the worker the configured number of virtual nodes;
+// non-positive weights are treated as 1. Changing the weight only adds or
+// removes the worker's highest numbered virtual nodes.
+func (r *HashRing) AddWorker(worker *core.WorkerNode, weight float64) {
+	if weight <= 0 {
+		weight = 1
+	}
+	vnodes := int(math.Round(weight * float64(r.vnodesPerUnit)))
+	if vnodes < 1 {
+		vnodes = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if member, exists := r.members[worker.ID]; exists {
+		member.node = worker
+		member.weight = weight
+		if member.vnodes == vnodes {
+			return
+		}
+		member.vnodes = vnodes
+	} else {
+		r.members[worker.ID] = &ringMember{node: worker, weight: weight, vnodes: vnodes}
+	}
+	r.rebuildLocked()
+}
+
+// RemoveWorker removes a worker and all of its virtual nodes.
+func (r *HashRing) RemoveWorker(workerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.members[workerID]; !exists {
+		return
+	}
+	delete(r.members, workerID)
+	r.rebuildLocked()
+}
+
+// Workers returns the IDs of the workers in the ring, sorted.
+func (r *HashRing) Workers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workerIDs := make([]string, 0, len(r.members))
+	for workerID := range r.members {
+		workerIDs = append(workerIDs, workerID)
+	}
+	sort.Strings(workerIDs)
+	return workerIDs
+}
+
+// SetReplicas changes the number of workers returned for each chunk.
+func (r *HashRing) SetReplicas(replicas int) {
+	if replicas <= 0 {
+		replicas = 1
+	}
+	r.mu.Lock()
+	r.replicas = replicas
+	r.mu.Unlock()
+}
+
+// Lookup returns up to n distinct workers for key in ring order. Asking for
+// every worker gives the full preference list, which is where replacements
+// for a failed replica should be taken from.
+func (r *HashRing) Lookup(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lookupLocked(key, n)
+}
+
+func (r *HashRing) lookupLocked(key string, n int) []string {
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+	if n <= 0 || len(r.ring) == 0 {
+		return nil
+	}
+
+	h := ringHash(key)
+	start := sort.Search(len(r.ring), func(i int) bool { return r.ring[i].hash >= h })
+
+	workerIDs := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(r.ring) && len(workerIDs) < n; i++ {
+		vnode := r.ring[(start+i)%len(r.ring)]
+		if seen[vnode.workerID] {
+			continue
+		}
+		seen[vnode.workerID] = true
+		workerIDs = append(workerIDs, vnode.workerID)
+	}
+	return workerIDs
+}
+
+// PlaceChunk returns the workers a new chunk should be written to, primary
+// first.
+func (r *HashRing) PlaceChunk(ctx context.Context, fileID string, chunkIndex int) ([]string, error) {
+	return r.RebalanceChunk(ctx, ChunkKey(fileID, chunkIndex))
+}
+
+// RebalanceChunk returns the workers an existing chunk belongs on given the
+// current ring, e.g. after a worker joined or left.
+func (r *HashRing) RebalanceChunk(ctx context.Context, chunkID string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workerIDs := r.lookupLocked(chunkID, r.replicas)
+	if len(workerIDs) == 0 {
+		return nil, ErrNoWorkers
+	}
+	return workerIDs, nil
+}
+
+// GetOptimalWorkers returns up to count online workers, preferring the ones
+// with the most available storage.
+func (r *HashRing) GetOptimalWorkers(ctx context.Context, count int) ([]*core.WorkerNode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candidates := make([]*ringMember, 0, len(r.members))
+	for _, member := range r.members {
+		if member.node.Status == core.WorkerStatusOffline || member.node.Status == core.WorkerStatusFailed || member.node.Status == core.WorkerStatusDraining {
+			continue
+		}
+		candidates = append(candidates, member)
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoWorkers
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].node.AvailableStorage != candidates[j].node.AvailableStorage {
+			return candidates[i].node.AvailableStorage > candidates[j].node.AvailableStorage
+		}
+		return candidates[i].node.ID < candidates[j].node.ID
+	})
+
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	workers := make([]*core.WorkerNode, 0, count)
+	for _, member := range candidates[:count] {
+		workers = append(workers, member.node)
+	}
+	return workers, nil
+}
+
+// rebuildLocked regenerates the sorted virtual node list. Virtual node hashes
+// only depend on the worker ID and the node number, so a rebuild never moves
+// nodes that already existed.
+func (r *HashRing) rebuildLocked() {
+	total := 0
+	for _, member := range r.members {
+		total += member.vnodes
+	}
+
+	ring := make([]virtualNode, 0, total)
+	for workerID, member := range r.members {
+		for i := 0; i < member.vnodes; i++ {
+			ring = append(ring, virtualNode{
+				hash:     ringHash(workerID + "#" + strconv.Itoa(i)),
+				workerID: workerID,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash != ring[j].hash {
+			return ring[i].hash < ring[j].hash
+		}
+		return ring[i].workerID < ring[j].workerID
+	})
+	r.ring = ring
+}
+
+func ringHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,47 @@
+package replication
+
+import "fmt"
+
+// Storage modes of a chunk: full copies on several workers, or Reed-Solomon
+// shards spread across workers.
+const (
+	StorageModeReplication = "replication"
+	StorageModeErasure     = "erasure"
+)
+
+// ErasureConfig selects erasure coding for large files. Threshold is the
+// file size from which files are erasure coded by default; 0 disables it.
+type ErasureConfig struct {
+	DataShards   int   `json:"data_shards"`
+	ParityShards int   `json:"parity_shards"`
+	Threshold    int64 `json:"threshold"`
+}
+
+// SelectStorageMode picks how a file of the given size is stored. An
+// explicitly requested mode wins over the size threshold. A negative size
+// means the size is not known up front; such files are replicated unless
+// erasure coding is requested.
+func (c ErasureConfig) SelectStorageMode(requested string, size int64) (string, error) {
+	switch requested {
+	case StorageModeReplication, StorageModeErasure:
+		return requested, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid storage mode: %s", requested)
+	}
+
+	if c.Threshold > 0 && size >= c.Threshold {
+		return StorageModeErasure, nil
+	}
+	return StorageModeReplication, nil
+}
+
+// MinShardAcks is the number of shards that must be stored for a write to
+// succeed: enough to read the chunk back with one more shard lost.
+// Background repair restores the rest.
+func MinShardAcks(dataShards, parityShards int) int {
+	if parityShards == 0 {
+		return dataShards
+	}
+	return dataShards + 1
+}
@@ -0,0 +1,103 @@
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// ErrTooFewShards means fewer than the data shard count survived, so the
+// data can't be reconstructed.
+var ErrTooFewShards = errors.New("too few shards to reconstruct")
+
+// ReedSolomon is a systematic Reed-Solomon erasure code over GF(2^8): data is
+// split into dataShards shards, parityShards parity shards are added, and the
+// data can be recovered from any dataShards of the total. The coding is done
+// by klauspost/reedsolomon with its default Vandermonde matrix, which
+// matches the shards written before it was used.
+type ReedSolomon struct {
+	dataShards   int
+	parityShards int
+	enc          reedsolomon.Encoder
+}
+
+func NewReedSolomon(dataShards, parityShards int) (*ReedSolomon, error) {
+	if dataShards <= 0 || parityShards < 0 {
+		return nil, fmt.Errorf("invalid shard counts %d+%d", dataShards, parityShards)
+	}
+	// Beyond 256 shards the library switches to a different field, which
+	// would make existing shards unreadable.
+	if dataShards+parityShards > 256 {
+		return nil, fmt.Errorf("at most 256 shards are supported, got %d", dataShards+parityShards)
+	}
+
+	enc, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	return &ReedSolomon{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		enc:          enc,
+	}, nil
+}
+
+func (rs *ReedSolomon) DataShards() int   { return rs.dataShards }
+func (rs *ReedSolomon) ParityShards() int { return rs.parityShards }
+func (rs *ReedSolomon) TotalShards() int  { return rs.dataShards + rs.parityShards }
+
+// ShardSize is the size of each shard of size bytes of data.
+func (rs *ReedSolomon) ShardSize(size int) int {
+	return (size + rs.dataShards - 1) / rs.dataShards
+}
+
+// Split cuts data into data shards, zero-padding the last one, and computes
+// the parity shards. The data shards share data's memory, so data must not
+// change while they are in use.
+func (rs *ReedSolomon) Split(data []byte) ([][]byte, error) {
+	// Capping the capacity keeps the library from padding and encoding
+	// into whatever follows data in its array.
+	shards, err := rs.enc.Split(data[:len(data):len(data)])
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.enc.Encode(shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+// Reconstruct fills in the missing (nil) shards from the ones present.
+func (rs *ReedSolomon) Reconstruct(shards [][]byte) error {
+	if len(shards) != rs.TotalShards() {
+		return fmt.Errorf("expected %d shards, got %d", rs.TotalShards(), len(shards))
+	}
+
+	err := rs.enc.Reconstruct(shards)
+	if errors.Is(err, reedsolomon.ErrTooFewShards) {
+		present := 0
+		for _, shard := range shards {
+			if len(shard) > 0 {
+				present++
+			}
+		}
+		return fmt.Errorf("%w: have %d of %d", ErrTooFewShards, present, rs.dataShards)
+	}
+	return err
+}
+
+// Join concatenates the data shards and trims the padding off.
+func (rs *ReedSolomon) Join(shards [][]byte, size int) ([]byte, error) {
+	if len(shards) < rs.dataShards {
+		return nil, fmt.Errorf("%w: have %d of %d", ErrTooFewShards, len(shards), rs.dataShards)
+	}
+
+	var data bytes.Buffer
+	data.Grow(size)
+	if err := rs.enc.Join(&data, shards, size); err != nil {
+		return nil, fmt.Errorf("failed to join shards: %w", err)
+	}
+	return data.Bytes(), nil
+}
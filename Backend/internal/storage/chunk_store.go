@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrChunkNotFound is returned, wrapped, by RetrieveChunk and StatChunk
+// when a store doesn't hold the chunk.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// ChunkStore is where a worker keeps its chunks. A chunk is addressed by
+// the file it was stored under, its ID and its index.
+type ChunkStore interface {
+	StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error
+	RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error)
+	// StoreChunkFrom stores a chunk of size bytes read from r without
+	// holding it in memory. The chunk is only stored if r yields exactly
+	// size bytes; when reading fails nothing is stored.
+	StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error
+	// OpenChunk returns a reader over a stored chunk and the chunk's size.
+	OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error)
+	// DeleteChunk succeeds when the chunk doesn't exist.
+	DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error
+	ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error)
+	StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error)
+	// ListStoredChunks returns one page of at most pageSize chunks and the
+	// token of the next page, "" after the last one.
+	ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error)
+}
+
+var (
+	_ ChunkStore = (*S3Storage)(nil)
+	_ ChunkStore = (*FSChunkStore)(nil)
+	_ ChunkStore = (*LocalStorage)(nil)
+	_ ChunkStore = (*MemoryChunkStore)(nil)
+	_ ChunkStore = (*LayeredChunkStore)(nil)
+)
+
+func chunkNotFound(chunkID string) error {
+	return fmt.Errorf("chunk %s: %w", chunkID, ErrChunkNotFound)
+}
+
+// readChunkData reads a chunk of size bytes from r for the stores that keep
+// chunks in memory anyway.
+func readChunkData(r io.Reader, chunkID string, size int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", chunkID, err)
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("chunk %s is %d bytes, %d read", chunkID, size, len(data))
+	}
+	return data, nil
+}
+
+// chunkExists turns the error of StatChunk into the result of ChunkExists.
+func chunkExists(err error) (bool, error) {
+	if errors.Is(err, ErrChunkNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Chunk store backends, as named in the worker's STORAGE_BACKEND.
+const (
+	BackendS3     = "s3"
+	BackendFS     = "fs"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+// DefaultMemoryBytes caps the memory backend when ChunkStoreConfig doesn't.
+const DefaultMemoryBytes = 256 << 20
+
+// ChunkStoreConfig selects a worker's chunk store. With several backends
+// the store is layered, the first backend on top: see LayeredChunkStore.
+type ChunkStoreConfig struct {
+	Backends []string
+	// FSRoot is the root of the sharded fs backend.
+	FSRoot string
+	// LocalRoot is the root of the flat local backend.
+	LocalRoot string
+	// S3 backs the s3 backend; nil when S3 isn't configured.
+	S3 *S3Storage
+	// MemoryBytes caps the memory backend; 0 means DefaultMemoryBytes.
+	MemoryBytes int64
+}
+
+// ParseBackends splits a comma separated list of backends, such as
+// "memory,s3".
+func ParseBackends(spec string) []string {
+	var backends []string
+	for _, backend := range strings.Split(spec, ",") {
+		if backend = strings.ToLower(strings.TrimSpace(backend)); backend != "" {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// NewChunkStore opens the backends in cfg. Without any it uses S3 when it
+// is configured and the fs backend otherwise. The memory backend evicts
+// chunks, so it can only cache the backends below it.
+func NewChunkStore(cfg ChunkStoreConfig) (ChunkStore, error) {
+	backends := cfg.Backends
+	if len(backends) == 0 {
+		backends = []string{BackendFS}
+		if cfg.S3 != nil {
+			backends = []string{BackendS3}
+		}
+	}
+
+	if backends[len(backends)-1] == BackendMemory {
+		return nil, fmt.Errorf("storage backend %q can only be layered above another backend", BackendMemory)
+	}
+
+	layers := make([]ChunkStore, 0, len(backends))
+	for _, backend := range backends {
+		var store ChunkStore
+		var err error
+		switch backend {
+		case BackendS3:
+			if cfg.S3 == nil {
+				return nil, fmt.Errorf("storage backend %q requires S3 to be configured", backend)
+			}
+			store = cfg.S3
+		case BackendFS:
+			store, err = NewFSChunkStore(cfg.FSRoot)
+		case BackendLocal:
+			store, err = NewLocalStorage(cfg.LocalRoot)
+		case BackendMemory:
+			maxBytes := cfg.MemoryBytes
+			if maxBytes <= 0 {
+				maxBytes = DefaultMemoryBytes
+			}
+			store = NewMemoryChunkStore(maxBytes)
+		default:
+			return nil, fmt.Errorf("unknown storage backend %q", backend)
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, store)
+	}
+
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return NewLayeredChunkStore(layers...), nil
+}
+
+// MemoryChunkStore keeps chunks in memory. It is meant for tests and as a
+// cache layer; nothing survives a restart. Once the chunks add up to more
+// than maxBytes the least recently used ones are evicted.
+type MemoryChunkStore struct {
+	mutex    sync.Mutex
+	maxBytes int64
+	bytes    int64
+	chunks   map[string]*list.Element
+	// recent holds the chunks, most recently used first.
+	recent *list.List
+}
+
+type memoryChunk struct {
+	key  string
+	info StoredChunk
+	data []byte
+}
+
+// NewMemoryChunkStore returns a store holding at most maxBytes of chunks,
+// or any amount when maxBytes is 0.
+func NewMemoryChunkStore(maxBytes int64) *MemoryChunkStore {
+	return &MemoryChunkStore{
+		maxBytes: maxBytes,
+		chunks:   make(map[string]*list.Element),
+		recent:   list.New(),
+	}
+}
+
+// memoryKey orders chunks by file ID, then chunk ID and index, the way the
+// disk backends list them.
+func memoryKey(fileID, chunkID string, chunkIndex int) string {
+	return fmt.Sprintf("%s/%s_%d", fileID, chunkID, chunkIndex)
+}
+
+func (m *MemoryChunkStore) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error {
+	if m.maxBytes > 0 && int64(len(data)) > m.maxBytes {
+		return fmt.Errorf("chunk %s of %d bytes exceeds the %d byte memory store", chunkID, len(data), m.maxBytes)
+	}
+	key := memoryKey(fileID, chunkID, chunkIndex)
+	chunk := &memoryChunk{
+		key: key,
+		info: StoredChunk{
+			FileID:     fileID,
+			ChunkID:    chunkID,
+			ChunkIndex: chunkIndex,
+			Size:       int64(len(data)),
+			ModifiedAt: time.Now(),
+		},
+		data: append([]byte(nil), data...),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeLocked(key)
+	m.chunks[key] = m.recent.PushFront(chunk)
+	m.bytes += chunk.info.Size
+	for m.maxBytes > 0 && m.bytes > m.maxBytes {
+		m.removeLocked(m.recent.Back().Value.(*memoryChunk).key)
+	}
+	return nil
+}
+
+func (m *MemoryChunkStore) removeLocked(key string) {
+	elem, ok := m.chunks[key]
+	if !ok {
+		return
+	}
+	m.recent.Remove(elem)
+	delete(m.chunks, key)
+	m.bytes -= elem.Value.(*memoryChunk).info.Size
+}
+
+func (m *MemoryChunkStore) StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error {
+	data, err := readChunkData(r, chunkID, size)
+	if err != nil {
+		return err
+	}
+	return m.StoreChunk(ctx, fileID, chunkID, chunkIndex, data)
+}
+
+func (m *MemoryChunkStore) OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error) {
+	data, err := m.RetrieveChunk(ctx, fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func (m *MemoryChunkStore) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	elem, ok := m.chunks[memoryKey(fileID, chunkID, chunkIndex)]
+	if !ok {
+		return nil, chunkNotFound(chunkID)
+	}
+	m.recent.MoveToFront(elem)
+	return append([]byte(nil), elem.Value.(*memoryChunk).data...), nil
+}
+
+func (m *MemoryChunkStore) DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeLocked(memoryKey(fileID, chunkID, chunkIndex))
+	return nil
+}
+
+func (m *MemoryChunkStore) ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.chunks[memoryKey(fileID, chunkID, chunkIndex)]
+	return ok, nil
+}
+
+func (m *MemoryChunkStore) StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	elem, ok := m.chunks[memoryKey(fileID, chunkID, chunkIndex)]
+	if !ok {
+		return StoredChunk{}, chunkNotFound(chunkID)
+	}
+	return elem.Value.(*memoryChunk).info, nil
+}
+
+// ListStoredChunks lists chunks in key order; the token is the key of the
+// last chunk returned.
+func (m *MemoryChunkStore) ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make([]string, 0, len(m.chunks))
+	for key := range m.chunks {
+		if key > pageToken {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	nextPageToken := ""
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		nextPageToken = keys[pageSize-1]
+	}
+	chunks := make([]StoredChunk, 0, len(keys))
+	for _, key := range keys {
+		chunks = append(chunks, m.chunks[key].Value.(*memoryChunk).info)
+	}
+	return chunks, nextPageToken, nil
+}
+
+// LayeredChunkStore stacks chunk stores, the first on top. Chunks are
+// written to every layer, bottom first, and read from the topmost layer
+// holding them; a chunk found lower down is copied into the layers above.
+// The bottom layer holds every chunk, so listing only looks at it.
+type LayeredChunkStore struct {
+	layers []ChunkStore
+
+	// fillMutex orders copying a chunk into the layers above against
+	// deletes, and deletes counts them, so a chunk deleted while it was
+	// being read isn't copied back afterwards.
+	fillMutex sync.Mutex
+	deletes   uint64
+}
+
+func NewLayeredChunkStore(layers ...ChunkStore) *LayeredChunkStore {
+	return &LayeredChunkStore{layers: layers}
+}
+
+func (l *LayeredChunkStore) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error {
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		if err := l.layers[i].StoreChunk(ctx, fileID, chunkID, chunkIndex, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreChunkFrom streams the chunk into the bottom layer and copies it from
+// there into the layers above, so r is only read once.
+func (l *LayeredChunkStore) StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error {
+	bottom := l.layers[len(l.layers)-1]
+	if err := bottom.StoreChunkFrom(ctx, fileID, chunkID, chunkIndex, r, size); err != nil {
+		return err
+	}
+	for i := len(l.layers) - 2; i >= 0; i-- {
+		stored, storedSize, err := bottom.OpenChunk(ctx, fileID, chunkID, chunkIndex)
+		if err != nil {
+			return err
+		}
+		err = l.layers[i].StoreChunkFrom(ctx, fileID, chunkID, chunkIndex, stored, storedSize)
+		stored.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenChunk reads from the topmost layer holding the chunk. Unlike
+// RetrieveChunk it doesn't copy the chunk into the layers above, which
+// would mean reading it twice.
+func (l *LayeredChunkStore) OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error) {
+	var lastErr error
+	for _, layer := range l.layers {
+		r, size, err := layer.OpenChunk(ctx, fileID, chunkID, chunkIndex)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return r, size, nil
+	}
+	return nil, 0, lastErr
+}
+
+func (l *LayeredChunkStore) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	l.fillMutex.Lock()
+	deletes := l.deletes
+	l.fillMutex.Unlock()
+
+	var lastErr error
+	for i, layer := range l.layers {
+		data, err := layer.RetrieveChunk(ctx, fileID, chunkID, chunkIndex)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		l.fill(ctx, l.layers[:i], deletes, fileID, chunkID, chunkIndex, data)
+		return data, nil
+	}
+	return nil, lastErr
+}
+
+// fill copies a chunk read from a lower layer into the layers above, unless
+// a chunk was deleted since the read started. Filling is best effort; the
+// chunk was read either way.
+func (l *LayeredChunkStore) fill(ctx context.Context, layers []ChunkStore, deletes uint64, fileID, chunkID string, chunkIndex int, data []byte) {
+	if len(layers) == 0 {
+		return
+	}
+	l.fillMutex.Lock()
+	defer l.fillMutex.Unlock()
+	if l.deletes != deletes {
+		return
+	}
+	for _, above := range layers {
+		above.StoreChunk(ctx, fileID, chunkID, chunkIndex, data)
+	}
+}
+
+// DeleteChunk deletes the chunk from every layer, even when some fail.
+func (l *LayeredChunkStore) DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error {
+	l.fillMutex.Lock()
+	l.deletes++
+	l.fillMutex.Unlock()
+
+	var errs []error
+	for _, layer := range l.layers {
+		if err := layer.DeleteChunk(ctx, fileID, chunkID, chunkIndex); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *LayeredChunkStore) ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error) {
+	for _, layer := range l.layers {
+		exists, err := layer.ChunkExists(ctx, fileID, chunkID, chunkIndex)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (l *LayeredChunkStore) StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	for _, layer := range l.layers {
+		info, err := layer.StatChunk(ctx, fileID, chunkID, chunkIndex)
+		if err == nil || !errors.Is(err, ErrChunkNotFound) {
+			return info, err
+		}
+	}
+	return StoredChunk{}, chunkNotFound(chunkID)
+}
+
+func (l *LayeredChunkStore) ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	return l.layers[len(l.layers)-1].ListStoredChunks(ctx, pageToken, pageSize)
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryChunkStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryChunkStore(10)
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.StoreChunk(ctx, "file", id, 0, []byte("0123")); err != nil {
+			t.Fatalf("StoreChunk(%s): %v", id, err)
+		}
+	}
+	// Reading a makes b the least recently used chunk.
+	if _, err := store.RetrieveChunk(ctx, "file", "a", 0); err != nil {
+		t.Fatalf("RetrieveChunk(a): %v", err)
+	}
+	if err := store.StoreChunk(ctx, "file", "c", 0, []byte("0123")); err != nil {
+		t.Fatalf("StoreChunk(c): %v", err)
+	}
+
+	for id, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if exists, _ := store.ChunkExists(ctx, "file", id, 0); exists != want {
+			t.Errorf("ChunkExists(%s) = %v, want %v", id, exists, want)
+		}
+	}
+	if store.bytes != 8 {
+		t.Errorf("store holds %d bytes, want 8", store.bytes)
+	}
+
+	if err := store.StoreChunk(ctx, "file", "big", 0, make([]byte, 11)); err == nil {
+		t.Error("StoreChunk accepted a chunk larger than the store")
+	}
+}
+
+func TestMemoryChunkStoreReplaceAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryChunkStore(0)
+
+	store.StoreChunk(ctx, "file", "a", 0, []byte("old"))
+	store.StoreChunk(ctx, "file", "a", 0, []byte("newer"))
+	if data, _ := store.RetrieveChunk(ctx, "file", "a", 0); string(data) != "newer" {
+		t.Fatalf("RetrieveChunk = %q, want newer", data)
+	}
+	if store.bytes != 5 {
+		t.Fatalf("store holds %d bytes after replacing, want 5", store.bytes)
+	}
+
+	if err := store.DeleteChunk(ctx, "file", "a", 0); err != nil {
+		t.Fatalf("DeleteChunk: %v", err)
+	}
+	if err := store.DeleteChunk(ctx, "file", "a", 0); err != nil {
+		t.Fatalf("DeleteChunk of a missing chunk: %v", err)
+	}
+	if _, err := store.RetrieveChunk(ctx, "file", "a", 0); !errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("RetrieveChunk after delete = %v, want ErrChunkNotFound", err)
+	}
+	if store.bytes != 0 {
+		t.Fatalf("store holds %d bytes after deleting, want 0", store.bytes)
+	}
+}
+
+func TestMemoryChunkStoreListsInPages(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryChunkStore(0)
+	for _, id := range []string{"c", "a", "b"} {
+		store.StoreChunk(ctx, "file", id, 0, []byte(id))
+	}
+
+	var ids []string
+	token := ""
+	for {
+		chunks, next, err := store.ListStoredChunks(ctx, token, 2)
+		if err != nil {
+			t.Fatalf("ListStoredChunks: %v", err)
+		}
+		for _, chunk := range chunks {
+			ids = append(ids, chunk.ChunkID)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if got := strings.Join(ids, ","); got != "a,b,c" {
+		t.Fatalf("listed %v, want a, b, c", ids)
+	}
+}
+
+func TestLayeredChunkStoreReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	cache, base := NewMemoryChunkStore(0), NewMemoryChunkStore(0)
+	store := NewLayeredChunkStore(cache, base)
+
+	if err := store.StoreChunk(ctx, "file", "a", 0, []byte("data")); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	for name, layer := range map[string]*MemoryChunkStore{"cache": cache, "base": base} {
+		if exists, _ := layer.ChunkExists(ctx, "file", "a", 0); !exists {
+			t.Errorf("StoreChunk didn't write to the %s layer", name)
+		}
+	}
+
+	// A chunk only in the bottom layer is copied up when read.
+	base.StoreChunk(ctx, "file", "b", 1, []byte("lower"))
+	data, err := store.RetrieveChunk(ctx, "file", "b", 1)
+	if err != nil || string(data) != "lower" {
+		t.Fatalf("RetrieveChunk = %q, %v; want lower", data, err)
+	}
+	if exists, _ := cache.ChunkExists(ctx, "file", "b", 1); !exists {
+		t.Error("RetrieveChunk didn't fill the cache layer")
+	}
+
+	if err := store.DeleteChunk(ctx, "file", "b", 1); err != nil {
+		t.Fatalf("DeleteChunk: %v", err)
+	}
+	if exists, _ := store.ChunkExists(ctx, "file", "b", 1); exists {
+		t.Error("chunk still exists after DeleteChunk")
+	}
+	if _, err := store.StatChunk(ctx, "file", "b", 1); !errors.Is(err, ErrChunkNotFound) {
+		t.Errorf("StatChunk after delete = %v, want ErrChunkNotFound", err)
+	}
+}
+
+// deletingStore deletes the chunk being read through the layered store
+// above it, the way a concurrent DeleteChunk would between the read and
+// the fill.
+type deletingStore struct {
+	*MemoryChunkStore
+	layered *LayeredChunkStore
+}
+
+func (d *deletingStore) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	data, err := d.MemoryChunkStore.RetrieveChunk(ctx, fileID, chunkID, chunkIndex)
+	if err == nil {
+		d.layered.DeleteChunk(ctx, fileID, chunkID, chunkIndex)
+	}
+	return data, err
+}
+
+func TestLayeredChunkStoreDoesNotRefillDeletedChunks(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryChunkStore(0)
+	base := &deletingStore{MemoryChunkStore: NewMemoryChunkStore(0)}
+	store := NewLayeredChunkStore(cache, base)
+	base.layered = store
+
+	base.StoreChunk(ctx, "file", "a", 0, []byte("data"))
+	if _, err := store.RetrieveChunk(ctx, "file", "a", 0); err != nil {
+		t.Fatalf("RetrieveChunk: %v", err)
+	}
+	if exists, _ := cache.ChunkExists(ctx, "file", "a", 0); exists {
+		t.Fatal("chunk deleted during the read was copied back into the cache")
+	}
+}
+
+func TestNewChunkStoreRejectsMemoryAtTheBottom(t *testing.T) {
+	for _, backends := range [][]string{{BackendMemory}, {BackendFS, BackendMemory}} {
+		if _, err := NewChunkStore(ChunkStoreConfig{Backends: backends, FSRoot: t.TempDir()}); err == nil {
+			t.Errorf("NewChunkStore(%v) succeeded", backends)
+		}
+	}
+
+	store, err := NewChunkStore(ChunkStoreConfig{Backends: []string{BackendMemory, BackendFS}, FSRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewChunkStore(memory, fs): %v", err)
+	}
+	layered, ok := store.(*LayeredChunkStore)
+	if !ok {
+		t.Fatalf("NewChunkStore(memory, fs) = %T, want a layered store", store)
+	}
+	if cache := layered.layers[0].(*MemoryChunkStore); cache.maxBytes != DefaultMemoryBytes {
+		t.Errorf("memory layer holds %d bytes, want %d", cache.maxBytes, DefaultMemoryBytes)
+	}
+}
+
+func TestMeasureUsageSkipsSharedStores(t *testing.T) {
+	ctx := context.Background()
+	// The nil client would panic if MeasureUsage listed the bucket.
+	s3 := NewS3Storage(nil, "bucket")
+	for _, store := range []ChunkStore{s3, NewLayeredChunkStore(NewMemoryChunkStore(0), s3)} {
+		usage, err := MeasureUsage(ctx, store)
+		if err != nil {
+			t.Fatalf("MeasureUsage(%T): %v", store, err)
+		}
+		if usage != (StorageUsage{Shared: true}) {
+			t.Errorf("MeasureUsage(%T) = %+v, want shared and nothing measured", store, usage)
+		}
+	}
+
+	fsStore, err := NewFSChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSChunkStore: %v", err)
+	}
+	fsStore.StoreChunk(ctx, "file", "a", 0, []byte("data"))
+	usage, err := MeasureUsage(ctx, fsStore)
+	if err != nil {
+		t.Fatalf("MeasureUsage(fs): %v", err)
+	}
+	if usage.Shared || usage.Chunks != 1 || usage.UsedBytes != 4 || usage.TotalBytes <= 0 {
+		t.Errorf("MeasureUsage(fs) = %+v, want 1 chunk of 4 bytes on a sized disk", usage)
+	}
+}
+
+// failingReader yields data and then fails.
+type failingReader struct {
+	data []byte
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func TestStoreChunkFromKeepsOnlyWholeChunks(t *testing.T) {
+	ctx := context.Background()
+	fsStore, err := NewFSChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSChunkStore: %v", err)
+	}
+	localStore, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	stores := map[string]ChunkStore{
+		"memory":  NewMemoryChunkStore(0),
+		"fs":      fsStore,
+		"local":   localStore,
+		"layered": NewLayeredChunkStore(NewMemoryChunkStore(0), fsStore),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := store.StoreChunkFrom(ctx, "file", "a", 0, strings.NewReader("data"), 4); err != nil {
+				t.Fatalf("StoreChunkFrom: %v", err)
+			}
+			r, size, err := store.OpenChunk(ctx, "file", "a", 0)
+			if err != nil {
+				t.Fatalf("OpenChunk: %v", err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil || size != 4 || string(data) != "data" {
+				t.Fatalf("OpenChunk read %q, %v with size %d; want data", data, err, size)
+			}
+
+			failed := map[string]func() error{
+				"reader fails": func() error {
+					return store.StoreChunkFrom(ctx, "file", "b", 0, &failingReader{data: []byte("da")}, 4)
+				},
+				"too short": func() error {
+					return store.StoreChunkFrom(ctx, "file", "b", 0, strings.NewReader("da"), 4)
+				},
+				"too long": func() error {
+					return store.StoreChunkFrom(ctx, "file", "b", 0, strings.NewReader("data!"), 4)
+				},
+			}
+			for what, attempt := range failed {
+				if err := attempt(); err == nil {
+					t.Errorf("StoreChunkFrom succeeded when the %s", what)
+				}
+			}
+			if exists, _ := store.ChunkExists(ctx, "file", "b", 0); exists {
+				t.Error("a failed StoreChunkFrom left a chunk behind")
+			}
+			if _, _, err := store.OpenChunk(ctx, "file", "b", 0); !errors.Is(err, ErrChunkNotFound) {
+				t.Errorf("OpenChunk of a missing chunk = %v, want ErrChunkNotFound", err)
+			}
+		})
+	}
+}
+
+func TestLayeredStoreChunkFromWritesEveryLayer(t *testing.T) {
+	ctx := context.Background()
+	cache, base := NewMemoryChunkStore(0), NewMemoryChunkStore(0)
+	store := NewLayeredChunkStore(cache, base)
+
+	if err := store.StoreChunkFrom(ctx, "file", "a", 0, strings.NewReader("data"), 4); err != nil {
+		t.Fatalf("StoreChunkFrom: %v", err)
+	}
+	for name, layer := range map[string]*MemoryChunkStore{"cache": cache, "base": base} {
+		if data, _ := layer.RetrieveChunk(ctx, "file", "a", 0); string(data) != "data" {
+			t.Errorf("%s layer holds %q, want data", name, data)
+		}
+	}
+}
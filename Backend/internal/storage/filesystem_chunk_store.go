@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultStorageRoot = "./storage/chunks"
+
+	// tempPrefix marks chunks still being written; they are never listed.
+	tempPrefix = ".tmp-"
+)
+
+// FSChunkStore keeps chunks as files under StorageRoot, laid out like the
+// S3 keys but sharded by a hash of the chunk ID so no directory grows too
+// large: <root>/ab/cd/<file ID>/<chunk ID>_<index>.
+type FSChunkStore struct {
+	StorageRoot string
+}
+
+func NewFSChunkStore(root string) (*FSChunkStore, error) {
+	if root == "" {
+		root = DefaultStorageRoot
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create storage root directory %s: %w", root, err)
+	}
+	return &FSChunkStore{StorageRoot: root}, nil
+}
+
+// GetChunkPath returns where a chunk is stored. IDs that could escape the
+// storage root are rejected.
+func (f *FSChunkStore) GetChunkPath(fileID, chunkID string, chunkIndex int) (string, error) {
+	if !validPathID(fileID) || !validPathID(chunkID) || chunkIndex < 0 {
+		return "", fmt.Errorf("invalid chunk key %s/%s/%d", fileID, chunkID, chunkIndex)
+	}
+	sum := sha256.Sum256([]byte(chunkID))
+	shard := hex.EncodeToString(sum[:2])
+	return filepath.Join(f.StorageRoot, shard[:2], shard[2:], fileID, fmt.Sprintf("%s_%d", chunkID, chunkIndex)), nil
+}
+
+func validPathID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.HasPrefix(id, tempPrefix) &&
+		!strings.ContainsAny(id, "/\\\x00")
+}
+
+func (f *FSChunkStore) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return writeChunkFile(chunkPath, chunkID, bytes.NewReader(data), int64(len(data)))
+}
+
+func (f *FSChunkStore) StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return writeChunkFile(chunkPath, chunkID, r, size)
+}
+
+// writeChunkFile writes a chunk of size bytes read from r atomically: the
+// data goes to a temporary file that is synced and then renamed over the
+// chunk, so a reader or a crash never sees a partial chunk. If r fails or
+// doesn't yield size bytes the temporary file is removed.
+func writeChunkFile(chunkPath, chunkID string, r io.Reader, size int64) error {
+	dir := filepath.Dir(chunkPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create chunk directory for %s: %w", chunkID, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to write chunk %s to disk: %w", chunkID, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	written, err := io.Copy(tmp, r)
+	if err != nil {
+		return fmt.Errorf("failed to write chunk %s to disk: %w", chunkID, err)
+	}
+	if written != size {
+		return fmt.Errorf("chunk %s is %d bytes, %d read", chunkID, size, written)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync chunk %s: %w", chunkID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write chunk %s to disk: %w", chunkID, err)
+	}
+	if err := os.Rename(tmp.Name(), chunkPath); err != nil {
+		return fmt.Errorf("failed to write chunk %s to disk: %w", chunkID, err)
+	}
+	committed = true
+
+	// The rename itself only survives a crash once the directory is synced.
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync chunk %s: %w", chunkID, err)
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (f *FSChunkStore) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, err
+	}
+	return readChunkFile(chunkPath, chunkID)
+}
+
+func (f *FSChunkStore) OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error) {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, 0, err
+	}
+	return openChunkFile(chunkPath, chunkID)
+}
+
+func openChunkFile(chunkPath, chunkID string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(chunkPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, chunkNotFound(chunkID)
+		}
+		return nil, 0, fmt.Errorf("failed to open chunk %s: %w", chunkID, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat chunk %s: %w", chunkID, err)
+	}
+	return file, info.Size(), nil
+}
+
+func readChunkFile(chunkPath, chunkID string) ([]byte, error) {
+	data, err := os.ReadFile(chunkPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, chunkNotFound(chunkID)
+		}
+		return nil, fmt.Errorf("failed to read chunk %s from disk: %w", chunkID, err)
+	}
+	return data, nil
+}
+
+func (f *FSChunkStore) DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return deleteChunkFile(chunkPath, chunkID)
+}
+
+func deleteChunkFile(chunkPath, chunkID string) error {
+	if err := os.Remove(chunkPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete chunk %s: %w", chunkID, err)
+	}
+	return nil
+}
+
+func (f *FSChunkStore) ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error) {
+	_, err := f.StatChunk(ctx, fileID, chunkID, chunkIndex)
+	return chunkExists(err)
+}
+
+func (f *FSChunkStore) StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	chunkPath, err := f.GetChunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return StoredChunk{}, err
+	}
+	return statChunkFile(chunkPath, fileID, chunkID, chunkIndex)
+}
+
+func statChunkFile(chunkPath, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	info, err := os.Stat(chunkPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return StoredChunk{}, chunkNotFound(chunkID)
+		}
+		return StoredChunk{}, fmt.Errorf("failed to stat chunk %s: %w", chunkID, err)
+	}
+	return StoredChunk{
+		FileID:     fileID,
+		ChunkID:    chunkID,
+		ChunkIndex: chunkIndex,
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+	}, nil
+}
+
+// errPageFull stops the walk in ListStoredChunks once a page is complete.
+var errPageFull = errors.New("page full")
+
+// ListStoredChunks returns one page of the stored chunks, at most pageSize
+// long, and the token of the next page, "" after the last one. Chunks are
+// listed in directory order and the token is the path of the last chunk
+// returned.
+func (f *FSChunkStore) ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	return listChunkFiles(ctx, f.StorageRoot, 4, pageToken, pageSize)
+}
+
+// listChunkFiles lists the chunks under root, each depth path components
+// deep and named <file ID>/<chunk ID>_<index> in its last two.
+func listChunkFiles(ctx context.Context, root string, depth int, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	after := splitRelPath(pageToken)
+
+	var chunks []StoredChunk
+	nextPageToken := ""
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		parts := splitRelPath(filepath.ToSlash(rel))
+
+		if d.IsDir() {
+			// Directories sorting before the token's hold chunks
+			// that were listed already.
+			if len(after) > len(parts) && comparePaths(parts, after[:len(parts)]) < 0 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(parts) != depth || strings.HasPrefix(d.Name(), tempPrefix) || comparePaths(parts, after) <= 0 {
+			return nil
+		}
+		name := parts[depth-1]
+		i := strings.LastIndex(name, "_")
+		if i <= 0 {
+			return nil
+		}
+		index, err := strconv.Atoi(name[i+1:])
+		if err != nil {
+			return nil
+		}
+
+		if len(chunks) == pageSize {
+			nextPageToken = strings.Join(after, "/")
+			return errPageFull
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		chunks = append(chunks, StoredChunk{
+			FileID:     parts[depth-2],
+			ChunkID:    name[:i],
+			ChunkIndex: index,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		})
+		after = parts
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, "", fmt.Errorf("failed to list chunks: %w", err)
+	}
+	return chunks, nextPageToken, nil
+}
+
+func splitRelPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// comparePaths orders paths the way WalkDir visits them: component by
+// component, each in lexical order.
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// listAll pages through store and returns every chunk as
+// <file ID>/<chunk ID>_<index>, failing on duplicates.
+func listAll(t *testing.T, store ChunkStore, pageSize int, between func()) []string {
+	t.Helper()
+	seen := map[string]bool{}
+	var keys []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 1000 {
+			t.Fatal("paging did not terminate")
+		}
+		chunks, next, err := store.ListStoredChunks(context.Background(), token, pageSize)
+		if err != nil {
+			t.Fatalf("ListStoredChunks(%q, %d): %v", token, pageSize, err)
+		}
+		if len(chunks) > pageSize {
+			t.Fatalf("page of %d chunks, want at most %d", len(chunks), pageSize)
+		}
+		for _, chunk := range chunks {
+			key := memoryKey(chunk.FileID, chunk.ChunkID, chunk.ChunkIndex)
+			if seen[key] {
+				t.Fatalf("chunk %s listed twice", key)
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+		if between != nil {
+			between()
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func storeTestChunks(t *testing.T, store ChunkStore) []string {
+	t.Helper()
+	var keys []string
+	for f := 0; f < 4; f++ {
+		for c := 0; c < 6; c++ {
+			fileID, chunkID := fmt.Sprintf("file%d", f), fmt.Sprintf("chunk_%d", c)
+			if err := store.StoreChunk(context.Background(), fileID, chunkID, c, []byte(chunkID)); err != nil {
+				t.Fatalf("StoreChunk: %v", err)
+			}
+			keys = append(keys, memoryKey(fileID, chunkID, c))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestFSChunkStoreListsEveryChunkOnce(t *testing.T) {
+	store, err := NewFSChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSChunkStore: %v", err)
+	}
+	want := storeTestChunks(t, store)
+
+	// Leftovers of interrupted writes and stray files are not chunks.
+	path, _ := store.GetChunkPath("file0", "chunk_0", 0)
+	os.WriteFile(filepath.Join(filepath.Dir(path), tempPrefix+"123"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(filepath.Dir(path), "notes"), []byte("stray"), 0644)
+
+	for _, pageSize := range []int{1, 3, 7, len(want), 1000} {
+		if got := listAll(t, store, pageSize, nil); !slices.Equal(got, want) {
+			t.Errorf("page size %d listed %v, want %v", pageSize, got, want)
+		}
+	}
+}
+
+func TestFSChunkStoreListsAcrossDeletes(t *testing.T) {
+	store, err := NewFSChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSChunkStore: %v", err)
+	}
+	all := storeTestChunks(t, store)
+
+	// Deleting the chunk a page token names, and its whole directory,
+	// must not make later pages repeat or skip chunks.
+	ctx := context.Background()
+	deleted := map[string]bool{}
+	between := func() {
+		chunks, _, _ := store.ListStoredChunks(ctx, "", 1)
+		for _, chunk := range chunks {
+			store.DeleteChunk(ctx, chunk.FileID, chunk.ChunkID, chunk.ChunkIndex)
+			deleted[memoryKey(chunk.FileID, chunk.ChunkID, chunk.ChunkIndex)] = true
+		}
+	}
+	got := listAll(t, store, 5, between)
+
+	listed := map[string]bool{}
+	for _, key := range got {
+		listed[key] = true
+	}
+	for _, key := range all {
+		if !listed[key] && !deleted[key] {
+			t.Errorf("chunk %s was skipped", key)
+		}
+	}
+}
+
+func TestLocalStorageListsInPages(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	want := storeTestChunks(t, store)
+
+	for _, pageSize := range []int{1, 4, 1000} {
+		if got := listAll(t, store, pageSize, nil); !slices.Equal(got, want) {
+			t.Errorf("page size %d listed %v, want %v", pageSize, got, want)
+		}
+	}
+}
+
+func TestFSChunkStoreRejectsEscapingIDs(t *testing.T) {
+	store, err := NewFSChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSChunkStore: %v", err)
+	}
+	for _, ids := range [][2]string{{"..", "chunk"}, {"file", "../chunk"}, {"file", ""}, {"a/b", "chunk"}, {"file", tempPrefix + "x"}} {
+		if _, err := store.GetChunkPath(ids[0], ids[1], 0); err == nil {
+			t.Errorf("GetChunkPath(%q, %q) succeeded", ids[0], ids[1])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type LocalStorage struct {
+	basePath string
+}
+
+func NewLocalStorage(basePath string) (*LocalStorage, error) {
+	if basePath == "" {
+		basePath = "./storage/files"
+	}
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorage{basePath: basePath}, nil
+}
+
+func (ls *LocalStorage) StoreFile(fileID string, reader io.Reader) error {
+	filePath := filepath.Join(ls.basePath, fileID)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LocalStorage) RetrieveFile(fileID string) (io.ReadCloser, error) {
+	filePath := filepath.Join(ls.basePath, fileID)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (ls *LocalStorage) DeleteFile(fileID string) error {
+	filePath := filepath.Join(ls.basePath, fileID)
+	return os.Remove(filePath)
+}
+
+func (ls *LocalStorage) FileExists(fileID string) bool {
+	filePath := filepath.Join(ls.basePath, fileID)
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+// Chunks are kept flat under basePath as <file ID>/<chunk ID>_<index>,
+// without the sharding of FSChunkStore.
+func (ls *LocalStorage) chunkPath(fileID, chunkID string, chunkIndex int) (string, error) {
+	if !validPathID(fileID) || !validPathID(chunkID) || chunkIndex < 0 {
+		return "", fmt.Errorf("invalid chunk key %s/%s/%d", fileID, chunkID, chunkIndex)
+	}
+	return filepath.Join(ls.basePath, fileID, fmt.Sprintf("%s_%d", chunkID, chunkIndex)), nil
+}
+
+func (ls *LocalStorage) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return writeChunkFile(chunkPath, chunkID, bytes.NewReader(data), int64(len(data)))
+}
+
+func (ls *LocalStorage) StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return writeChunkFile(chunkPath, chunkID, r, size)
+}
+
+func (ls *LocalStorage) OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error) {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, 0, err
+	}
+	return openChunkFile(chunkPath, chunkID)
+}
+
+func (ls *LocalStorage) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return nil, err
+	}
+	return readChunkFile(chunkPath, chunkID)
+}
+
+func (ls *LocalStorage) DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return err
+	}
+	return deleteChunkFile(chunkPath, chunkID)
+}
+
+func (ls *LocalStorage) ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error) {
+	_, err := ls.StatChunk(ctx, fileID, chunkID, chunkIndex)
+	return chunkExists(err)
+}
+
+func (ls *LocalStorage) StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	chunkPath, err := ls.chunkPath(fileID, chunkID, chunkIndex)
+	if err != nil {
+		return StoredChunk{}, err
+	}
+	return statChunkFile(chunkPath, fileID, chunkID, chunkIndex)
+}
+
+func (ls *LocalStorage) ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	return listChunkFiles(ctx, ls.basePath, 2, pageToken, pageSize)
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// StoredChunk is a chunk object found in the bucket.
+type StoredChunk struct {
+	FileID     string
+	ChunkID    string
+	ChunkIndex int
+	Size       int64
+	ModifiedAt time.Time
+}
+
+type S3Storage struct {
+	client     *s3.Client
+	bucketName string
+}
+
+func NewS3Storage(client *s3.Client, bucketName string) *S3Storage {
+	return &S3Storage{
+		client:     client,
+		bucketName: bucketName,
+	}
+}
+
+func (s *S3Storage) StoreChunk(ctx context.Context, fileID, chunkID string, chunkIndex int, data []byte) error {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucketName),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+		Metadata: map[string]string{
+			"file-id":     fileID,
+			"chunk-id":    chunkID,
+			"chunk-index": fmt.Sprintf("%d", chunkIndex),
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to store chunk %s: %w", chunkID, err)
+	}
+
+	return nil
+}
+
+// StoreChunkFrom uploads the chunk as it is read. S3 only creates the
+// object once all size bytes arrived, so a failed read leaves no chunk.
+func (s *S3Storage) StoreChunkFrom(ctx context.Context, fileID, chunkID string, chunkIndex int, r io.Reader, size int64) error {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucketName),
+		Key:                  aws.String(key),
+		Body:                 r,
+		ContentLength:        aws.Int64(size),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+		Metadata: map[string]string{
+			"file-id":     fileID,
+			"chunk-id":    chunkID,
+			"chunk-index": fmt.Sprintf("%d", chunkIndex),
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to store chunk %s: %w", chunkID, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) OpenChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (io.ReadCloser, int64, error) {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return nil, 0, chunkNotFound(chunkID)
+		}
+		return nil, 0, fmt.Errorf("failed to retrieve chunk %s: %w", chunkID, err)
+	}
+
+	var size int64
+	if result.ContentLength != nil {
+		size = *result.ContentLength
+	}
+	return result.Body, size, nil
+}
+
+func (s *S3Storage) RetrieveChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) ([]byte, error) {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return nil, chunkNotFound(chunkID)
+		}
+		return nil, fmt.Errorf("failed to retrieve chunk %s: %w", chunkID, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk data: %w", err)
+	}
+
+	return data, nil
+}
+
+func (s *S3Storage) DeleteChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) error {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete chunk %s: %w", chunkID, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ListChunks(ctx context.Context, fileID string) ([]string, error) {
+	prefix := fmt.Sprintf("files/%s/chunks/", fileID)
+
+	result, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks for file %s: %w", fileID, err)
+	}
+
+	var chunks []string
+	for _, obj := range result.Contents {
+		if obj.Key != nil {
+			chunks = append(chunks, *obj.Key)
+		}
+	}
+
+	return chunks, nil
+}
+
+// ListStoredChunks returns one page of every chunk in the bucket, at most
+// pageSize long, and the token of the next page, "" after the last one.
+func (s *S3Storage) ListStoredChunks(ctx context.Context, pageToken string, pageSize int) ([]StoredChunk, string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String("files/"),
+	}
+	if pageToken != "" {
+		input.ContinuationToken = aws.String(pageToken)
+	}
+	if pageSize > 0 {
+		input.MaxKeys = aws.Int32(int32(pageSize))
+	}
+
+	result, err := s.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	var chunks []StoredChunk
+	for _, obj := range result.Contents {
+		if obj.Key == nil {
+			continue
+		}
+		chunk, ok := parseChunkKey(*obj.Key)
+		if !ok {
+			continue
+		}
+		if obj.Size != nil {
+			chunk.Size = *obj.Size
+		}
+		if obj.LastModified != nil {
+			chunk.ModifiedAt = *obj.LastModified
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	nextPageToken := ""
+	if result.IsTruncated != nil && *result.IsTruncated && result.NextContinuationToken != nil {
+		nextPageToken = *result.NextContinuationToken
+	}
+
+	return chunks, nextPageToken, nil
+}
+
+func (s *S3Storage) DeleteAllChunks(ctx context.Context, fileID string) error {
+	chunks, err := s.ListChunks(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	var objects []types.ObjectIdentifier
+	for _, chunk := range chunks {
+		objects = append(objects, types.ObjectIdentifier{
+			Key: aws.String(chunk),
+		})
+	}
+
+	_, err = s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.bucketName),
+		Delete: &types.Delete{
+			Objects: objects,
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete chunks for file %s: %w", fileID, err)
+	}
+
+	return nil
+}
+
+// StatChunk reads a chunk's size and modification time from its object.
+func (s *S3Storage) StatChunk(ctx context.Context, fileID, chunkID string, chunkIndex int) (StoredChunk, error) {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") {
+			return StoredChunk{}, chunkNotFound(chunkID)
+		}
+		return StoredChunk{}, fmt.Errorf("failed to stat chunk %s: %w", chunkID, err)
+	}
+
+	chunk := StoredChunk{
+		FileID:     fileID,
+		ChunkID:    chunkID,
+		ChunkIndex: chunkIndex,
+	}
+	if result.ContentLength != nil {
+		chunk.Size = *result.ContentLength
+	}
+	if result.LastModified != nil {
+		chunk.ModifiedAt = *result.LastModified
+	}
+	return chunk, nil
+}
+
+func (s *S3Storage) ChunkExists(ctx context.Context, fileID, chunkID string, chunkIndex int) (bool, error) {
+	key := s.generateChunkKey(fileID, chunkID, chunkIndex)
+
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+
+		if strings.Contains(err.Error(), "NotFound") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check chunk existence: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *S3Storage) generateChunkKey(fileID, chunkID string, chunkIndex int) string {
+	return fmt.Sprintf("files/%s/chunks/%s_%d", fileID, chunkID, chunkIndex)
+}
+
+// parseChunkKey is the inverse of generateChunkKey. Chunk IDs may contain
+// underscores, so the index is whatever follows the last one.
+func parseChunkKey(key string) (StoredChunk, bool) {
+	rest, ok := strings.CutPrefix(key, "files/")
+	if !ok {
+		return StoredChunk{}, false
+	}
+	fileID, name, ok := strings.Cut(rest, "/chunks/")
+	if !ok || fileID == "" {
+		return StoredChunk{}, false
+	}
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return StoredChunk{}, false
+	}
+	index, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return StoredChunk{}, false
+	}
+	return StoredChunk{FileID: fileID, ChunkID: name[:i], ChunkIndex: index}, true
+}
+
+func (s *S3Storage) EnsureBucket(ctx context.Context) error {
+
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucketName),
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	_, err = s.client.CreateBucket(ctx, &s3.CreateBucketInput{
+		Bucket: aws.String(s.bucketName),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", s.bucketName, err)
+	}
+
+	return nil
+}
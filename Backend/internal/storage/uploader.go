@@ -0,0 +1 @@
+package storage
\ No newline at end of file
@@ -0,0 +1,77 @@
+package storage
+
+import "context"
+
+// StorageUsage is what a chunk store holds and, for stores on a local
+// disk, how much room the disk has left.
+type StorageUsage struct {
+	Chunks    int64
+	UsedBytes int64
+	// FreeBytes and TotalBytes describe the disk the store is on; both are
+	// 0 for stores without a fixed size, such as S3 and memory.
+	FreeBytes  int64
+	TotalBytes int64
+	// Shared is set for stores the workers share, such as S3. What they
+	// hold isn't this worker's, so nothing else is measured.
+	Shared bool
+}
+
+// diskBacked is implemented by the stores that keep chunks on a local disk.
+type diskBacked interface {
+	diskRoot() string
+}
+
+func (f *FSChunkStore) diskRoot() string { return f.StorageRoot }
+
+func (l *LocalStorage) diskRoot() string { return l.basePath }
+
+// IsShared reports whether store keeps its chunks somewhere every worker
+// shares, such as one S3 bucket, so that every worker sees the same chunks.
+func IsShared(store ChunkStore) bool {
+	// Every chunk of a layered store is in its bottom layer.
+	if layered, ok := store.(*LayeredChunkStore); ok {
+		store = layered.layers[len(layered.layers)-1]
+	}
+	_, ok := store.(*S3Storage)
+	return ok
+}
+
+// MeasureUsage counts the chunks in store by listing all of them, so it
+// takes as long as a full listing. Shared stores aren't listed: the S3
+// bucket holds every worker's chunks, and listing it each time would cost a
+// full bucket LIST per worker.
+func MeasureUsage(ctx context.Context, store ChunkStore) (StorageUsage, error) {
+	if IsShared(store) {
+		return StorageUsage{Shared: true}, nil
+	}
+
+	var usage StorageUsage
+	pageToken := ""
+	for {
+		chunks, nextPageToken, err := store.ListStoredChunks(ctx, pageToken, 1000)
+		if err != nil {
+			return StorageUsage{}, err
+		}
+		for _, chunk := range chunks {
+			usage.Chunks++
+			usage.UsedBytes += chunk.Size
+		}
+		if nextPageToken == "" {
+			break
+		}
+		pageToken = nextPageToken
+	}
+
+	bottom := store
+	if layered, ok := store.(*LayeredChunkStore); ok {
+		bottom = layered.layers[len(layered.layers)-1]
+	}
+	if disk, ok := bottom.(diskBacked); ok {
+		free, total, err := diskSpace(disk.diskRoot())
+		if err != nil {
+			return StorageUsage{}, err
+		}
+		usage.FreeBytes, usage.TotalBytes = free, total
+	}
+	return usage, nil
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"echofs/pkg/fileops/Compressor"
 )
 
 type MasterConfig struct {
@@ -19,13 +21,23 @@ type MasterConfig struct {
 
 	
 	ReplicationFactor     int           `json:"replication_factor"`
+	MinWriteAcks          int           `json:"min_write_acks"`
 	VirtualNodesPerWorker int           `json:"virtual_nodes_per_worker"`
 	WorkerHealthTimeout   time.Duration `json:"worker_health_timeout"`
 	HeartbeatInterval     time.Duration `json:"heartbeat_interval"`
 	
+	// Erasure-coded chunks are split into ErasureDataShards shards plus
+	// ErasureParityShards parity shards instead of being replicated. Files
+	// of at least ErasureCodingThreshold bytes are erasure coded unless the
+	// upload asks otherwise; 0 leaves it to the uploads.
+	ErasureDataShards      int   `json:"erasure_data_shards"`
+	ErasureParityShards    int   `json:"erasure_parity_shards"`
+	ErasureCodingThreshold int64 `json:"erasure_coding_threshold"`
+	
 	SessionTimeout      time.Duration `json:"session_timeout"`
 	CleanupInterval     time.Duration `json:"cleanup_interval"`
 	MaxConcurrentUploads int          `json:"max_concurrent_uploads"`
+	ChunkDispatchConcurrency int      `json:"chunk_dispatch_concurrency"`
 	
 	JWTSecret       string        `json:"jwt_secret"`
 	JWTExpiry       time.Duration `json:"jwt_expiry"`
@@ -33,10 +45,47 @@ type MasterConfig struct {
 	TLSCertPath     string        `json:"tls_cert_path"`
 	TLSKeyPath      string        `json:"tls_key_path"`
 	
+	// WorkerToken is the secret workers present to register and send
+	// heartbeats. Without one only workers on the master's host are
+	// accepted.
+	WorkerToken string `json:"-"`
+	
+	// EncryptionEnabled seals every chunk with a per-file data key wrapped
+	// by the master keys in the keyring at EncryptionKeyringPath.
+	EncryptionEnabled     bool   `json:"encryption_enabled"`
+	EncryptionKeyringPath string `json:"encryption_keyring_path"`
+	
 	MaxGoroutines     int `json:"max_goroutines"`
 	RequestBufferSize int `json:"request_buffer_size"`
 	ChunkSize         int `json:"chunk_size"`
 	
+	// ChunkingMode is the default for uploads that don't pick one: "fixed"
+	// cuts ChunkSize pieces, "cdc" cuts content-defined chunks of
+	// CDCMinChunkSize..CDCMaxChunkSize bytes averaging CDCAvgChunkSize.
+	ChunkingMode    string `json:"chunking_mode"`
+	CDCMinChunkSize int    `json:"cdc_min_chunk_size"`
+	CDCAvgChunkSize int    `json:"cdc_avg_chunk_size"`
+	CDCMaxChunkSize int    `json:"cdc_max_chunk_size"`
+	
+	// CompressionCodec is the default codec for fixed-size uploads: gzip,
+	// lz4, zstd or none. Data that doesn't compress is stored as is.
+	CompressionCodec string `json:"compression_codec"`
+	
+	// VersionRetention is how many versions of a file are kept for users
+	// who haven't set their own limit; 0 keeps them all.
+	VersionRetention int `json:"version_retention"`
+	
+	// TrashRetention is how long deleted files stay in the trash before
+	// the cleanup service removes them for good.
+	TrashRetention time.Duration `json:"trash_retention"`
+	
+	// The chunk GC compares every worker's chunks with the metadata store
+	// each GCInterval and deletes those no file refers to once they are
+	// older than GCGracePeriod. With GCDryRun it only reports them.
+	GCInterval    time.Duration `json:"gc_interval"`
+	GCGracePeriod time.Duration `json:"gc_grace_period"`
+	GCDryRun      bool          `json:"gc_dry_run"`
+	
 	MetricsEnabled bool   `json:"metrics_enabled"`
 	MetricsPort    int    `json:"metrics_port"`
 	HealthPort     int    `json:"health_port"`
@@ -51,16 +100,28 @@ func LoadMasterConfig() (*MasterConfig, error) {
 		DatabaseTimeout:      30 * time.Second,
 		ReplicationFactor:    3,
 		VirtualNodesPerWorker: 100,
+		ErasureDataShards:    6,
+		ErasureParityShards:  3,
 		WorkerHealthTimeout:  90 * time.Second,
 		HeartbeatInterval:    30 * time.Second,
 		SessionTimeout:       24 * time.Hour,
 		CleanupInterval:      1 * time.Hour,
+		TrashRetention:       30 * 24 * time.Hour,
+		GCInterval:           24 * time.Hour,
+		GCGracePeriod:        48 * time.Hour,
 		MaxConcurrentUploads: 100,
+		ChunkDispatchConcurrency: 8,
 		JWTExpiry:           24 * time.Hour,
 		TLSEnabled:          false,
+		EncryptionKeyringPath: "./keys/keyring.json",
 		MaxGoroutines:       1000,
 		RequestBufferSize:   1024,
 		ChunkSize:           1024 * 1024, 
+		ChunkingMode:        "fixed",
+		CDCMinChunkSize:     256 * 1024,
+		CDCAvgChunkSize:     1024 * 1024,
+		CDCMaxChunkSize:     4 * 1024 * 1024,
+		CompressionCodec:    compressor.CodecGzip,
 		MetricsEnabled:      true,
 		MetricsPort:         9090,
 		HealthPort:          8081,
@@ -86,6 +147,8 @@ func LoadMasterConfig() (*MasterConfig, error) {
 	
 	
 	
+	config.WorkerToken = os.Getenv("WORKER_TOKEN")
+	
 	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
 		config.JWTSecret = jwtSecret
 	} else {
@@ -98,12 +161,120 @@ func LoadMasterConfig() (*MasterConfig, error) {
 		}
 	}
 	
+	if minWriteAcks := os.Getenv("MIN_WRITE_ACKS"); minWriteAcks != "" {
+		if acks, err := strconv.Atoi(minWriteAcks); err == nil {
+			config.MinWriteAcks = acks
+		}
+	}
+	if config.MinWriteAcks == 0 {
+		// Two acknowledgements unless fewer replicas are written at all.
+		config.MinWriteAcks = min(2, config.ReplicationFactor)
+	}
+	
+	if dataShards := os.Getenv("ERASURE_DATA_SHARDS"); dataShards != "" {
+		if k, err := strconv.Atoi(dataShards); err == nil {
+			config.ErasureDataShards = k
+		}
+	}
+	
+	if parityShards := os.Getenv("ERASURE_PARITY_SHARDS"); parityShards != "" {
+		if m, err := strconv.Atoi(parityShards); err == nil {
+			config.ErasureParityShards = m
+		}
+	}
+	
+	if threshold := os.Getenv("ERASURE_CODING_THRESHOLD"); threshold != "" {
+		if t, err := strconv.ParseInt(threshold, 10, 64); err == nil {
+			config.ErasureCodingThreshold = t
+		}
+	}
+	
+	if healthTimeout := os.Getenv("WORKER_HEALTH_TIMEOUT"); healthTimeout != "" {
+		if d, err := time.ParseDuration(healthTimeout); err == nil {
+			config.WorkerHealthTimeout = d
+		}
+	}
+	
+	if heartbeatInterval := os.Getenv("HEARTBEAT_INTERVAL"); heartbeatInterval != "" {
+		if d, err := time.ParseDuration(heartbeatInterval); err == nil {
+			config.HeartbeatInterval = d
+		}
+	}
+	
+	if dispatch := os.Getenv("CHUNK_DISPATCH_CONCURRENCY"); dispatch != "" {
+		if d, err := strconv.Atoi(dispatch); err == nil {
+			config.ChunkDispatchConcurrency = d
+		}
+	}
+	
 	if chunkSize := os.Getenv("CHUNK_SIZE"); chunkSize != "" {
 		if cs, err := strconv.Atoi(chunkSize); err == nil {
 			config.ChunkSize = cs
 		}
 	}
 	
+	if chunkingMode := os.Getenv("CHUNKING_MODE"); chunkingMode != "" {
+		config.ChunkingMode = chunkingMode
+	}
+	
+	if minSize := os.Getenv("CDC_MIN_CHUNK_SIZE"); minSize != "" {
+		if size, err := strconv.Atoi(minSize); err == nil {
+			config.CDCMinChunkSize = size
+		}
+	}
+	
+	if avgSize := os.Getenv("CDC_AVG_CHUNK_SIZE"); avgSize != "" {
+		if size, err := strconv.Atoi(avgSize); err == nil {
+			config.CDCAvgChunkSize = size
+		}
+	}
+	
+	if maxSize := os.Getenv("CDC_MAX_CHUNK_SIZE"); maxSize != "" {
+		if size, err := strconv.Atoi(maxSize); err == nil {
+			config.CDCMaxChunkSize = size
+		}
+	}
+	
+	if codec := os.Getenv("COMPRESSION_CODEC"); codec != "" {
+		config.CompressionCodec = codec
+	}
+	
+	if retention := os.Getenv("VERSION_RETENTION"); retention != "" {
+		if keep, err := strconv.Atoi(retention); err == nil {
+			config.VersionRetention = keep
+		}
+	}
+	
+	if trashRetention := os.Getenv("TRASH_RETENTION"); trashRetention != "" {
+		if d, err := time.ParseDuration(trashRetention); err == nil {
+			config.TrashRetention = d
+		}
+	}
+	
+	if gcInterval := os.Getenv("GC_INTERVAL"); gcInterval != "" {
+		if d, err := time.ParseDuration(gcInterval); err == nil {
+			config.GCInterval = d
+		}
+	}
+	
+	if gracePeriod := os.Getenv("GC_GRACE_PERIOD"); gracePeriod != "" {
+		if d, err := time.ParseDuration(gracePeriod); err == nil {
+			config.GCGracePeriod = d
+		}
+	}
+	
+	if dryRun := os.Getenv("GC_DRY_RUN"); dryRun == "true" {
+		config.GCDryRun = true
+	}
+	
+	if encryptionEnabled := os.Getenv("ENCRYPTION_ENABLED"); encryptionEnabled == "true" {
+		config.EncryptionEnabled = true
+	}
+	
+	if keyringPath := os.Getenv("ENCRYPTION_KEYRING_PATH"); keyringPath != "" {
+		config.EncryptionKeyringPath = keyringPath
+	}
+	
 	if tlsEnabled := os.Getenv("TLS_ENABLED"); tlsEnabled == "true" {
 		config.TLSEnabled = true
 		config.TLSCertPath = os.Getenv("TLS_CERT_PATH")
@@ -126,12 +297,69 @@ func (c *MasterConfig) Validate() error {
 		return fmt.Errorf("replication factor must be positive")
 	}
 	
+	if c.MinWriteAcks <= 0 || c.MinWriteAcks > c.ReplicationFactor {
+		return fmt.Errorf("min write acks must be between 1 and the replication factor")
+	}
+	
+	if c.ErasureDataShards <= 0 || c.ErasureParityShards <= 0 || c.ErasureDataShards+c.ErasureParityShards > 256 {
+		return fmt.Errorf("erasure coding needs at least one data and one parity shard, at most 256 in total")
+	}
+	
+	if c.ErasureCodingThreshold < 0 {
+		return fmt.Errorf("erasure coding threshold cannot be negative")
+	}
+	
+	// A worker is only marked offline after missing a few heartbeats.
+	if c.HeartbeatInterval < time.Second || c.WorkerHealthTimeout < 2*c.HeartbeatInterval {
+		return fmt.Errorf("heartbeat interval must be at least 1s and the worker health timeout at least twice as long")
+	}
+	
+	if c.ChunkDispatchConcurrency <= 0 || c.MaxConcurrentUploads <= 0 || c.MaxGoroutines <= 0 {
+		return fmt.Errorf("concurrency limits must be positive")
+	}
+	
 	if c.ChunkSize <= 0 {
 		return fmt.Errorf("chunk size must be positive")
 	}
 	
+	switch c.ChunkingMode {
+	case "fixed":
+	case "cdc":
+		if c.CDCMinChunkSize <= 0 || c.CDCAvgChunkSize < c.CDCMinChunkSize || c.CDCMaxChunkSize < c.CDCAvgChunkSize {
+			return fmt.Errorf("CDC chunk sizes must satisfy 0 < min <= avg <= max")
+		}
+	default:
+		return fmt.Errorf("invalid chunking mode: %s", c.ChunkingMode)
+	}
+	
+	if _, err := compressor.GetCodec(c.CompressionCodec); err != nil {
+		return fmt.Errorf("invalid compression codec: %w", err)
+	}
+	
 
 	
+	if c.VersionRetention < 0 {
+		return fmt.Errorf("version retention cannot be negative")
+	}
+	
+	if c.TrashRetention <= 0 || c.CleanupInterval <= 0 {
+		return fmt.Errorf("trash retention and cleanup interval must be positive")
+	}
+	
+	if c.GCInterval <= 0 {
+		return fmt.Errorf("gc interval must be positive")
+	}
+	
+	// Chunks of an upload still in progress are not referenced by any file
+	// yet; the grace period has to outlast the session.
+	if c.GCGracePeriod < c.SessionTimeout {
+		return fmt.Errorf("gc grace period cannot be shorter than the session timeout")
+	}
+	
+	if c.EncryptionEnabled && c.EncryptionKeyringPath == "" {
+		return fmt.Errorf("encryption keyring path cannot be empty when encryption is enabled")
+	}
+	
 	if c.JWTSecret == "" {
 		return fmt.Errorf("JWT secret cannot be empty")
 	}
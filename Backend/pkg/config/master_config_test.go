@@ -0,0 +1,64 @@
+package config
+
+import "testing"
+
+func TestMinWriteAcksDefault(t *testing.T) {
+	tests := []struct {
+		replicationFactor string
+		minWriteAcks      string
+		want              int
+	}{
+		{replicationFactor: "", minWriteAcks: "", want: 2},
+		{replicationFactor: "1", minWriteAcks: "", want: 1},
+		{replicationFactor: "5", minWriteAcks: "", want: 2},
+		{replicationFactor: "5", minWriteAcks: "4", want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("JWT_SECRET", "secret")
+		t.Setenv("REPLICATION_FACTOR", tt.replicationFactor)
+		t.Setenv("MIN_WRITE_ACKS", tt.minWriteAcks)
+
+		cfg, err := LoadMasterConfig()
+		if err != nil {
+			t.Fatalf("LoadMasterConfig: %v", err)
+		}
+		if cfg.MinWriteAcks != tt.want {
+			t.Errorf("REPLICATION_FACTOR=%q MIN_WRITE_ACKS=%q: MinWriteAcks = %d, want %d",
+				tt.replicationFactor, tt.minWriteAcks, cfg.MinWriteAcks, tt.want)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("REPLICATION_FACTOR=%q MIN_WRITE_ACKS=%q: Validate: %v", tt.replicationFactor, tt.minWriteAcks, err)
+		}
+	}
+}
+
+func TestGCAndTrashSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "grace covers sessions", env: map[string]string{"GC_GRACE_PERIOD": "24h"}},
+		{name: "grace shorter than sessions", env: map[string]string{"GC_GRACE_PERIOD": "1h"}, wantErr: true},
+		{name: "no trash retention", env: map[string]string{"TRASH_RETENTION": "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", "secret")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := LoadMasterConfig()
+			if err != nil {
+				t.Fatalf("LoadMasterConfig: %v", err)
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package database
 import (
 	"context"
 	"database/sql"
+	"sort"
 	"time"
 
 	"echofs/internal/metadata"
+	"github.com/lib/pq"
 )
 
 type FileRepository struct {
@@ -26,14 +28,101 @@ func (r *FileRepository) InitSchema(ctx context.Context) error {
 		chunk_size INTEGER NOT NULL,
 		total_chunks INTEGER NOT NULL,
 		md5_hash VARCHAR(255),
+		sha256_hash VARCHAR(64),
 		status VARCHAR(50) NOT NULL DEFAULT 'active',
 		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
 	);
 
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS sha256_hash VARCHAR(64);
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS encryption_key_id VARCHAR(255);
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS wrapped_data_key BYTEA;
+
+	-- Every upload is a row of its own. Uploads of a name the owner
+	-- already has become a new version of the same object: they share
+	-- object_id, and only the newest, is_current, one is listed.
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS object_id VARCHAR(255);
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS is_current BOOLEAN NOT NULL DEFAULT TRUE;
+	UPDATE files SET object_id = file_id WHERE object_id IS NULL;
+
+	-- folders is each owner's directory tree; a NULL parent_id or
+	-- folder_id is the owner's root. Names are unique within a folder,
+	-- across both files and subfolders.
+	CREATE TABLE IF NOT EXISTS folders (
+		folder_id VARCHAR(255) PRIMARY KEY,
+		owner_id VARCHAR(255) NOT NULL,
+		parent_id VARCHAR(255),
+		name VARCHAR(500) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (parent_id) REFERENCES folders(folder_id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_name ON folders(owner_id, (COALESCE(parent_id, '')), name);
+
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS folder_id VARCHAR(255) REFERENCES folders(folder_id);
+
+	-- Deleted files stay in their owner's trash until purged. deleted_at
+	-- marks every version of a trashed file; deleted_path is the folder
+	-- it was deleted from, as trashed files leave their folder.
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_path TEXT;
+
 	CREATE INDEX IF NOT EXISTS idx_files_owner_id ON files(owner_id);
 	CREATE INDEX IF NOT EXISTS idx_files_created_at ON files(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_files_object_id ON files(object_id, version DESC);
+	CREATE INDEX IF NOT EXISTS idx_files_current_path ON files(owner_id, (COALESCE(folder_id, '')), original_name) WHERE is_current;
+	CREATE INDEX IF NOT EXISTS idx_files_deleted_at ON files(deleted_at) WHERE deleted_at IS NOT NULL;
+
+	-- chunks holds one row per stored chunk, keyed by its content hash.
+	-- ref_count counts the file_chunks rows and in-flight uploads using it;
+	-- the chunk is removed from the workers when it drops to zero. size is
+	-- the original size and stored_size the size after the chunk's own
+	-- compression. Erasure-coded chunks have data_shards set and list the
+	-- worker of each shard in workers, in shard order.
+	CREATE TABLE IF NOT EXISTS chunks (
+		chunk_id VARCHAR(255) PRIMARY KEY,
+		size BIGINT NOT NULL,
+		checksum VARCHAR(255) NOT NULL,
+		compression VARCHAR(50) NOT NULL DEFAULT 'none',
+		stored_size BIGINT NOT NULL DEFAULT 0,
+		data_shards INTEGER NOT NULL DEFAULT 0,
+		parity_shards INTEGER NOT NULL DEFAULT 0,
+		workers TEXT[] NOT NULL DEFAULT '{}',
+		ref_count BIGINT NOT NULL DEFAULT 0,
+		version BIGINT NOT NULL DEFAULT 1,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	ALTER TABLE chunks ADD COLUMN IF NOT EXISTS compression VARCHAR(50) NOT NULL DEFAULT 'none';
+	ALTER TABLE chunks ADD COLUMN IF NOT EXISTS stored_size BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE chunks ADD COLUMN IF NOT EXISTS data_shards INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chunks ADD COLUMN IF NOT EXISTS parity_shards INTEGER NOT NULL DEFAULT 0;
+
+	-- file_chunks is the chunk map of a file. compression is the chunk's
+	-- codec, or "<codec>-stream" for files compressed as a whole before
+	-- being cut. offset and stored_offset locate the chunk in the original
+	-- and the stored file so a byte range maps straight to its chunks.
+	CREATE TABLE IF NOT EXISTS file_chunks (
+		file_id VARCHAR(255) NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		chunk_id VARCHAR(255) NOT NULL,
+		compression VARCHAR(50) NOT NULL DEFAULT 'none',
+		chunk_offset BIGINT NOT NULL DEFAULT 0,
+		stored_offset BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (file_id, chunk_index),
+		FOREIGN KEY (file_id) REFERENCES files(file_id) ON DELETE CASCADE,
+		FOREIGN KEY (chunk_id) REFERENCES chunks(chunk_id)
+	);
+
+	ALTER TABLE file_chunks ADD COLUMN IF NOT EXISTS chunk_offset BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE file_chunks ADD COLUMN IF NOT EXISTS stored_offset BIGINT NOT NULL DEFAULT 0;
+
+	CREATE INDEX IF NOT EXISTS idx_file_chunks_chunk_id ON file_chunks(chunk_id);
 	`
 
 	_, err := r.db.ExecContext(ctx, query)
@@ -42,8 +131,8 @@ func (r *FileRepository) InitSchema(ctx context.Context) error {
 
 func (r *FileRepository) CreateFile(ctx context.Context, file *metadata.FileMetadata) error {
 	query := `
-		INSERT INTO files (file_id, owner_id, original_name, size, chunk_size, total_chunks, md5_hash, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO files (file_id, object_id, owner_id, original_name, size, chunk_size, total_chunks, md5_hash, sha256_hash, status, created_at, updated_at)
+		VALUES ($1, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -54,6 +143,7 @@ func (r *FileRepository) CreateFile(ctx context.Context, file *metadata.FileMeta
 		file.ChunkSize,
 		file.TotalChunks,
 		file.MD5Hash,
+		file.SHA256Hash,
 		file.Status,
 		file.CreatedAt,
 		file.UpdatedAt,
@@ -62,42 +152,619 @@ func (r *FileRepository) CreateFile(ctx context.Context, file *metadata.FileMeta
 	return err
 }
 
-func (r *FileRepository) GetFileByID(ctx context.Context, fileID string) (*metadata.FileMetadata, error) {
-	file := &metadata.FileMetadata{}
+// CreateFileWithChunks stores the file row and its chunk map in a single
+// transaction, so a file is never visible without knowing where its data is.
+// The chunks must already have been acquired with AcquireChunk; the
+// references taken then are handed over to the file. If the owner already
+// has a file of the same name, the new one becomes its next version; the
+// object ID and version it was given are set on file.
+func (r *FileRepository) CreateFileWithChunks(ctx context.Context, file *metadata.FileMetadata, chunks []metadata.ChunkRef) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := nextVersionTx(ctx, tx, file); err != nil {
+		return err
+	}
+
+	if err := insertFileTx(ctx, tx, file); err != nil {
+		return err
+	}
+
+	chunkQuery := `
+		INSERT INTO file_chunks (file_id, chunk_index, chunk_id, compression, chunk_offset, stored_offset)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	stmt, err := tx.PrepareContext(ctx, chunkQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, chunk := range chunks {
+		if _, err := stmt.ExecContext(ctx, file.FileID, chunk.Index, chunk.ChunkID, chunk.Compression, chunk.Offset, chunk.StoredOffset); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// nextVersionTx makes file the next version of the owner's current file of
+// the same path, or the first version of a new object.
+func nextVersionTx(ctx context.Context, tx *sql.Tx, file *metadata.FileMetadata) error {
+	if err := lockPathsTx(ctx, tx, file.OwnerID, pathKey(file.FolderID, file.OriginalName)); err != nil {
+		return err
+	}
+
+	objectID, err := currentFileAt(ctx, tx, file.OwnerID, file.FolderID, file.OriginalName)
+	if err == ErrUserNotFound {
+		// A new file can't take the name of a folder next to it.
+		if err := checkNameFree(ctx, tx, file.OwnerID, file.FolderID, file.OriginalName, ""); err != nil {
+			return err
+		}
+		file.ObjectID = file.FileID
+		file.Version = 1
+		file.IsCurrent = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return supersedeTx(ctx, tx, objectID, file)
+}
+
+// supersedeTx makes file the new current version of objectID.
+func supersedeTx(ctx context.Context, tx *sql.Tx, objectID string, file *metadata.FileMetadata) error {
+	var lastVersion int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM files WHERE object_id = $1
+	`, objectID).Scan(&lastVersion)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE files SET is_current = FALSE, updated_at = $2 WHERE object_id = $1 AND is_current
+	`, objectID, time.Now()); err != nil {
+		return err
+	}
+
+	file.ObjectID = objectID
+	file.Version = lastVersion + 1
+	file.IsCurrent = true
+	return nil
+}
+
+func insertFileTx(ctx context.Context, tx *sql.Tx, file *metadata.FileMetadata) error {
+	query := `
+		INSERT INTO files (file_id, object_id, version, is_current, folder_id, owner_id, original_name, size, chunk_size, total_chunks, md5_hash, sha256_hash, encryption_key_id, wrapped_data_key, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), $14, $15, $16, $17)
+	`
+
+	_, err := tx.ExecContext(ctx, query,
+		file.FileID,
+		file.ObjectID,
+		file.Version,
+		file.IsCurrent,
+		file.FolderID,
+		file.OwnerID,
+		file.OriginalName,
+		file.Size,
+		file.ChunkSize,
+		file.TotalChunks,
+		file.MD5Hash,
+		file.SHA256Hash,
+		file.EncryptionKeyID,
+		file.WrappedDataKey,
+		file.Status,
+		file.CreatedAt,
+		file.UpdatedAt,
+	)
+	return err
+}
+
+// AcquireChunk takes a reference on a chunk, creating its row if this is the
+// first time the content is seen. It returns the chunk as stored before the
+// call, or nil if it is new. A chunk that exists but has no workers yet is
+// still being written by another upload.
+func (r *FileRepository) AcquireChunk(ctx context.Context, chunk metadata.ChunkRef) (*metadata.ChunkRef, error) {
 	query := `
-		SELECT file_id, owner_id, original_name, size, chunk_size, total_chunks, md5_hash, status, created_at, updated_at
+		INSERT INTO chunks (chunk_id, size, checksum, compression, stored_size, data_shards, parity_shards, workers, ref_count, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, '{}', 1, 1, $8, $8)
+		ON CONFLICT (chunk_id) DO UPDATE
+		SET ref_count = chunks.ref_count + 1, updated_at = EXCLUDED.updated_at
+		RETURNING (xmax = 0) AS inserted, size, checksum, compression, stored_size, data_shards, parity_shards, workers, ref_count - 1, version
+	`
+
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Wait for a deletion of the chunk's copies that is in progress, so a
+	// new copy can't be written in the middle of it.
+	if err := lockChunksTx(ctx, tx, []string{chunk.ChunkID}); err != nil {
+		return nil, err
+	}
+
+	var inserted bool
+	existing := metadata.ChunkRef{ChunkID: chunk.ChunkID}
+	err = tx.QueryRowContext(ctx, query,
+		chunk.ChunkID,
+		chunk.Size,
+		chunk.Checksum,
+		chunk.Compression,
+		chunk.StoredSize,
+		chunk.DataShards,
+		chunk.ParityShards,
+		time.Now(),
+	).Scan(
+		&inserted,
+		&existing.Size,
+		&existing.Checksum,
+		&existing.Compression,
+		&existing.StoredSize,
+		&existing.DataShards,
+		&existing.ParityShards,
+		pq.Array(&existing.Workers),
+		&existing.RefCount,
+		&existing.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if inserted {
+		return nil, nil
+	}
+	return &existing, nil
+}
+
+// LockChunks runs fn while holding the locks AcquireChunk takes on chunkIDs,
+// so none of the chunks can gain a reference in the meantime. fn is told
+// which of the chunks have a row again, having been acquired after they
+// were released; their copies on the workers must be kept.
+func (r *FileRepository) LockChunks(ctx context.Context, chunkIDs []string, fn func(referenced map[string]bool) error) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockChunksTx(ctx, tx, chunkIDs); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT chunk_id FROM chunks WHERE chunk_id = ANY($1)`, pq.Array(chunkIDs))
+	if err != nil {
+		return err
+	}
+	existing, err := scanStrings(rows)
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool, len(existing))
+	for _, chunkID := range existing {
+		referenced[chunkID] = true
+	}
+
+	if err := fn(referenced); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockChunksTx serializes references to the given chunks until the
+// transaction ends. Locks are taken in a fixed order so two transactions
+// locking the same chunks can't deadlock.
+func lockChunksTx(ctx context.Context, tx *sql.Tx, chunkIDs []string) error {
+	keys := append([]string(nil), chunkIDs...)
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i > 0 && key == keys[i-1] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('chunk/' || $1))`, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseChunks drops one reference per listed chunk ID (an ID listed twice
+// loses two). Chunks left without references are deleted and returned so
+// the caller can remove them from the workers.
+func (r *FileRepository) ReleaseChunks(ctx context.Context, chunkIDs []string) ([]metadata.ChunkRef, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orphaned, err := releaseChunksTx(ctx, tx, chunkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return orphaned, tx.Commit()
+}
+
+func releaseChunksTx(ctx context.Context, tx *sql.Tx, chunkIDs []string) ([]metadata.ChunkRef, error) {
+	releaseQuery := `
+		UPDATE chunks c
+		SET ref_count = GREATEST(c.ref_count - r.refs, 0), updated_at = $2
+		FROM (SELECT id, COUNT(*) AS refs FROM unnest($1::text[]) AS id GROUP BY id) r
+		WHERE c.chunk_id = r.id
+	`
+
+	if _, err := tx.ExecContext(ctx, releaseQuery, pq.Array(chunkIDs), time.Now()); err != nil {
+		return nil, err
+	}
+
+	deleteQuery := `
+		DELETE FROM chunks
+		WHERE chunk_id = ANY($1) AND ref_count = 0
+			AND NOT EXISTS (SELECT 1 FROM file_chunks fc WHERE fc.chunk_id = chunks.chunk_id)
+		RETURNING chunk_id, size, checksum, data_shards, parity_shards, workers, version
+	`
+
+	rows, err := tx.QueryContext(ctx, deleteQuery, pq.Array(chunkIDs))
+	if err != nil {
+		return nil, err
+	}
+	return scanChunkRows(rows)
+}
+
+// scanChunkRows reads chunk rows selected or returned as chunk_id, size,
+// checksum, data_shards, parity_shards, workers, version.
+func scanChunkRows(rows *sql.Rows) ([]metadata.ChunkRef, error) {
+	defer rows.Close()
+
+	var chunks []metadata.ChunkRef
+	for rows.Next() {
+		var chunk metadata.ChunkRef
+		err := rows.Scan(
+			&chunk.ChunkID,
+			&chunk.Size,
+			&chunk.Checksum,
+			&chunk.DataShards,
+			&chunk.ParityShards,
+			pq.Array(&chunk.Workers),
+			&chunk.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+func (r *FileRepository) GetChunks(ctx context.Context, fileID string) ([]metadata.ChunkRef, error) {
+	query := `
+		SELECT c.chunk_id, fc.chunk_index, c.size, c.stored_size, fc.chunk_offset, fc.stored_offset, c.checksum, fc.compression, c.data_shards, c.parity_shards, c.workers, c.ref_count, c.version
+		FROM file_chunks fc
+		JOIN chunks c ON c.chunk_id = fc.chunk_id
+		WHERE fc.file_id = $1
+		ORDER BY fc.chunk_index
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []metadata.ChunkRef
+	for rows.Next() {
+		var chunk metadata.ChunkRef
+		err := rows.Scan(
+			&chunk.ChunkID,
+			&chunk.Index,
+			&chunk.Size,
+			&chunk.StoredSize,
+			&chunk.Offset,
+			&chunk.StoredOffset,
+			&chunk.Checksum,
+			&chunk.Compression,
+			&chunk.DataShards,
+			&chunk.ParityShards,
+			pq.Array(&chunk.Workers),
+			&chunk.RefCount,
+			&chunk.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// UpdateChunkWorkers replaces the recorded locations of a chunk, e.g. after
+// it was first stored or re-replicated, and bumps its version.
+func (r *FileRepository) UpdateChunkWorkers(ctx context.Context, chunkID string, workers []string) error {
+	query := `
+		UPDATE chunks
+		SET workers = $1, version = version + 1, updated_at = $2
+		WHERE chunk_id = $3
+	`
+
+	result, err := r.db.ExecContext(ctx, query, pq.Array(workers), time.Now(), chunkID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetChunk returns the stored chunk row of chunkID.
+func (r *FileRepository) GetChunk(ctx context.Context, chunkID string) (*metadata.ChunkRef, error) {
+	chunk := &metadata.ChunkRef{ChunkID: chunkID}
+	query := `
+		SELECT size, stored_size, checksum, compression, data_shards, parity_shards, workers, ref_count, version
+		FROM chunks
+		WHERE chunk_id = $1
+	`
+
+	err := r.db.QueryRowContext(ctx, query, chunkID).Scan(
+		&chunk.Size,
+		&chunk.StoredSize,
+		&chunk.Checksum,
+		&chunk.Compression,
+		&chunk.DataShards,
+		&chunk.ParityShards,
+		pq.Array(&chunk.Workers),
+		&chunk.RefCount,
+		&chunk.Version,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+// ListErasureCodedChunks returns the erasure-coded chunks still referenced,
+// so missing shards can be found and rebuilt.
+func (r *FileRepository) ListErasureCodedChunks(ctx context.Context) ([]metadata.ChunkRef, error) {
+	query := `
+		SELECT chunk_id, size, stored_size, checksum, compression, data_shards, parity_shards, workers, version
+		FROM chunks
+		WHERE data_shards > 0 AND ref_count > 0 AND cardinality(workers) > 0
+		ORDER BY chunk_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []metadata.ChunkRef
+	for rows.Next() {
+		var chunk metadata.ChunkRef
+		err := rows.Scan(
+			&chunk.ChunkID,
+			&chunk.Size,
+			&chunk.StoredSize,
+			&chunk.Checksum,
+			&chunk.Compression,
+			&chunk.DataShards,
+			&chunk.ParityShards,
+			pq.Array(&chunk.Workers),
+			&chunk.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// StorageStats compares the bytes files refer to with the bytes actually
+// stored once deduplicated and compressed.
+type StorageStats struct {
+	Files            int64   `json:"files"`
+	ChunkReferences  int64   `json:"chunk_references"`
+	UniqueChunks     int64   `json:"unique_chunks"`
+	LogicalBytes     int64   `json:"logical_bytes"`
+	PhysicalBytes    int64   `json:"physical_bytes"`
+	StoredBytes      int64   `json:"stored_bytes"`
+	ReplicatedBytes  int64   `json:"replicated_bytes"`
+	SavedBytes       int64   `json:"saved_bytes"`
+	DedupRatio       float64 `json:"dedup_ratio"`
+	CompressionRatio float64 `json:"compression_ratio"`
+}
+
+func (r *FileRepository) GetStorageStats(ctx context.Context) (*StorageStats, error) {
+	stats := &StorageStats{}
+
+	logicalQuery := `
+		SELECT COUNT(DISTINCT fc.file_id), COUNT(*), COALESCE(SUM(c.size), 0)
+		FROM file_chunks fc
+		JOIN chunks c ON c.chunk_id = fc.chunk_id
+	`
+	err := r.db.QueryRowContext(ctx, logicalQuery).Scan(&stats.Files, &stats.ChunkReferences, &stats.LogicalBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks written before per-chunk compression have no stored size and
+	// are stored as they are. Erasure-coded chunks take one shard, a
+	// data_shards-th of the chunk, per worker entry.
+	physicalQuery := `
+		SELECT COUNT(*), COALESCE(SUM(size), 0),
+			COALESCE(SUM(COALESCE(NULLIF(stored_size, 0), size)), 0),
+			COALESCE(SUM(CASE
+				WHEN data_shards > 0 THEN CEIL(COALESCE(NULLIF(stored_size, 0), size)::numeric / data_shards) * cardinality(array_remove(workers, ''))
+				ELSE COALESCE(NULLIF(stored_size, 0), size) * cardinality(workers)
+			END), 0)::bigint
+		FROM chunks
+		WHERE ref_count > 0
+	`
+	err = r.db.QueryRowContext(ctx, physicalQuery).Scan(&stats.UniqueChunks, &stats.PhysicalBytes, &stats.StoredBytes, &stats.ReplicatedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.SavedBytes = stats.LogicalBytes - stats.PhysicalBytes
+	if stats.PhysicalBytes > 0 {
+		stats.DedupRatio = float64(stats.LogicalBytes) / float64(stats.PhysicalBytes)
+	}
+	if stats.StoredBytes > 0 {
+		stats.CompressionRatio = float64(stats.PhysicalBytes) / float64(stats.StoredBytes)
+	}
+
+	return stats, nil
+}
+
+// ListWrappedKeys returns the files whose data key is wrapped with a master
+// key other than keyID, with only their ID and key fields set.
+func (r *FileRepository) ListWrappedKeys(ctx context.Context, keyID string) ([]metadata.FileMetadata, error) {
+	query := `
+		SELECT file_id, encryption_key_id, wrapped_data_key
 		FROM files
-		WHERE file_id = $1
+		WHERE encryption_key_id IS NOT NULL AND encryption_key_id <> $1
 	`
 
-	err := r.db.QueryRowContext(ctx, query, fileID).Scan(
+	rows, err := r.db.QueryContext(ctx, query, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []metadata.FileMetadata
+	for rows.Next() {
+		var file metadata.FileMetadata
+		if err := rows.Scan(&file.FileID, &file.EncryptionKeyID, &file.WrappedDataKey); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// UpdateWrappedKey stores a re-wrapped data key. It only applies if the file
+// is still wrapped with oldKeyID, so concurrent rotations can't overwrite
+// each other with stale keys.
+func (r *FileRepository) UpdateWrappedKey(ctx context.Context, fileID, oldKeyID, keyID string, wrapped []byte) (bool, error) {
+	query := `
+		UPDATE files
+		SET encryption_key_id = $1, wrapped_data_key = $2, updated_at = $3
+		WHERE file_id = $4 AND encryption_key_id = $5
+	`
+
+	result, err := r.db.ExecContext(ctx, query, keyID, wrapped, time.Now(), fileID, oldKeyID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// fileColumns are the files columns scanned by scanFile.
+const fileColumns = `file_id, COALESCE(object_id, file_id), version, is_current, COALESCE(folder_id, ''), deleted_at, COALESCE(deleted_path, ''), owner_id, original_name, size, chunk_size, total_chunks, COALESCE(md5_hash, ''), COALESCE(sha256_hash, ''), COALESCE(encryption_key_id, ''), wrapped_data_key, status, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row rowScanner) (*metadata.FileMetadata, error) {
+	file := &metadata.FileMetadata{}
+	var deletedAt sql.NullTime
+	err := row.Scan(
 		&file.FileID,
+		&file.ObjectID,
+		&file.Version,
+		&file.IsCurrent,
+		&file.FolderID,
+		&deletedAt,
+		&file.DeletedPath,
 		&file.OwnerID,
 		&file.OriginalName,
 		&file.Size,
 		&file.ChunkSize,
 		&file.TotalChunks,
 		&file.MD5Hash,
+		&file.SHA256Hash,
+		&file.EncryptionKeyID,
+		&file.WrappedDataKey,
 		&file.Status,
 		&file.CreatedAt,
 		&file.UpdatedAt,
 	)
-
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-
+	if deletedAt.Valid {
+		file.DeletedAt = &deletedAt.Time
+	}
 	return file, nil
 }
 
+func scanFiles(rows *sql.Rows) ([]*metadata.FileMetadata, error) {
+	defer rows.Close()
+
+	var files []*metadata.FileMetadata
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func (r *FileRepository) GetFileByID(ctx context.Context, fileID string) (*metadata.FileMetadata, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE file_id = $1`
+	return scanFile(r.db.QueryRowContext(ctx, query, fileID))
+}
+
+// GetFilesByOwner lists the current version of each of the owner's files.
 func (r *FileRepository) GetFilesByOwner(ctx context.Context, ownerID string) ([]*metadata.FileMetadata, error) {
 	query := `
-		SELECT file_id, owner_id, original_name, size, chunk_size, total_chunks, md5_hash, status, created_at, updated_at
+		SELECT ` + fileColumns + `
 		FROM files
-		WHERE owner_id = $1
+		WHERE owner_id = $1 AND is_current AND deleted_at IS NULL
 		ORDER BY created_at DESC
 	`
 
@@ -105,53 +772,177 @@ func (r *FileRepository) GetFilesByOwner(ctx context.Context, ownerID string) ([
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanFiles(rows)
+}
 
-	var files []*metadata.FileMetadata
-	for rows.Next() {
-		file := &metadata.FileMetadata{}
-		err := rows.Scan(
-			&file.FileID,
-			&file.OwnerID,
-			&file.OriginalName,
-			&file.Size,
-			&file.ChunkSize,
-			&file.TotalChunks,
-			&file.MD5Hash,
-			&file.Status,
-			&file.CreatedAt,
-			&file.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		files = append(files, file)
+// objectOf is the object a file ID refers to, whether it names the object
+// or one of its versions. Files in the trash are left out.
+const objectOf = `(SELECT object_id FROM files WHERE (object_id = $1 OR file_id = $1) AND owner_id = $2 AND deleted_at IS NULL LIMIT 1)`
+
+// GetFileVersion returns the given version of the owner's file fileID, which
+// may be the object's ID or the ID of any of its versions. Version 0 returns
+// the current version of an object, or the version fileID names.
+func (r *FileRepository) GetFileVersion(ctx context.Context, fileID, ownerID string, version int64) (*metadata.FileMetadata, error) {
+	if version > 0 {
+		query := `SELECT ` + fileColumns + ` FROM files WHERE object_id = ` + objectOf + ` AND version = $3`
+		return scanFile(r.db.QueryRowContext(ctx, query, fileID, ownerID, version))
 	}
 
-	return files, rows.Err()
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE owner_id = $2 AND ((object_id = $1 AND is_current) OR file_id = $1) AND deleted_at IS NULL
+		ORDER BY (object_id = $1 AND is_current) DESC
+		LIMIT 1
+	`
+	return scanFile(r.db.QueryRowContext(ctx, query, fileID, ownerID))
 }
 
-func (r *FileRepository) DeleteFile(ctx context.Context, fileID, ownerID string) error {
+// ListVersions returns every version of the owner's file fileID, newest
+// first.
+func (r *FileRepository) ListVersions(ctx context.Context, fileID, ownerID string) ([]*metadata.FileMetadata, error) {
 	query := `
-		DELETE FROM files
-		WHERE file_id = $1 AND owner_id = $2
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE object_id = ` + objectOf + `
+		ORDER BY version DESC
 	`
 
-	result, err := r.db.ExecContext(ctx, query, fileID, ownerID)
+	rows, err := r.db.QueryContext(ctx, query, fileID, ownerID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return scanFiles(rows)
+}
 
-	rowsAffected, err := result.RowsAffected()
+// RestoreVersion makes a copy of an older version the new current version
+// of the owner's file, stored as newFileID. The copy shares the old
+// version's chunks, so no data is moved; the chunks just gain references.
+func (r *FileRepository) RestoreVersion(ctx context.Context, fileID, ownerID string, version int64, newFileID string) (*metadata.FileMetadata, error) {
+	tx, err := r.db.BeginTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		return ErrUserNotFound
+	query := `SELECT ` + fileColumns + ` FROM files WHERE object_id = ` + objectOf + ` AND version = $3`
+	source, err := scanFile(tx.QueryRowContext(ctx, query, fileID, ownerID, version))
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Keep the current path, so restoring doesn't move the file.
+	current, err := scanFile(tx.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE object_id = $1 AND is_current`, source.ObjectID))
+	if err != nil {
+		return nil, err
+	}
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(current.FolderID, current.OriginalName)); err != nil {
+		return nil, err
+	}
+
+	restored := *source
+	restored.FileID = newFileID
+	restored.FolderID = current.FolderID
+	restored.OriginalName = current.OriginalName
+	restored.CreatedAt = time.Now()
+	restored.UpdatedAt = restored.CreatedAt
+	if err := supersedeTx(ctx, tx, source.ObjectID, &restored); err != nil {
+		return nil, err
+	}
+	if err := insertFileTx(ctx, tx, &restored); err != nil {
+		return nil, err
+	}
+
+	copyQuery := `
+		INSERT INTO file_chunks (file_id, chunk_index, chunk_id, compression, chunk_offset, stored_offset)
+		SELECT $1, chunk_index, chunk_id, compression, chunk_offset, stored_offset
+		FROM file_chunks
+		WHERE file_id = $2
+	`
+	if _, err := tx.ExecContext(ctx, copyQuery, newFileID, source.FileID); err != nil {
+		return nil, err
+	}
+
+	refQuery := `
+		UPDATE chunks c
+		SET ref_count = c.ref_count + r.refs, updated_at = $2
+		FROM (SELECT chunk_id, COUNT(*) AS refs FROM file_chunks WHERE file_id = $1 GROUP BY chunk_id) r
+		WHERE c.chunk_id = r.chunk_id
+	`
+	if _, err := tx.ExecContext(ctx, refQuery, newFileID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &restored, tx.Commit()
+}
+
+// PruneVersions deletes the oldest versions of an object beyond the newest
+// keep, never the current one. Chunks no other file refers to are returned
+// so the caller can delete them from the workers.
+func (r *FileRepository) PruneVersions(ctx context.Context, objectID string, keep int) ([]metadata.ChunkRef, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT file_id
+		FROM files
+		WHERE object_id = $1 AND NOT is_current
+		ORDER BY version DESC
+		OFFSET $2
+	`, objectID, keep-1)
+	if err != nil {
+		return nil, err
+	}
+	fileIDs, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+
+	orphaned, err := deleteFilesTx(ctx, tx, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return orphaned, tx.Commit()
+}
+
+// deleteFilesTx deletes the given file rows and drops their chunk
+// references, returning the chunks left without any.
+func deleteFilesTx(ctx context.Context, tx *sql.Tx, fileIDs []string) ([]metadata.ChunkRef, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT chunk_id FROM file_chunks WHERE file_id = ANY($1)`, pq.Array(fileIDs))
+	if err != nil {
+		return nil, err
+	}
+	chunkIDs, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM files WHERE file_id = ANY($1)`, pq.Array(fileIDs)); err != nil {
+		return nil, err
+	}
+
+	return releaseChunksTx(ctx, tx, chunkIDs)
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
 }
 
 func (r *FileRepository) UpdateFileStatus(ctx context.Context, fileID, status string) error {
@@ -168,7 +959,7 @@ func (r *FileRepository) UpdateFileStatus(ctx context.Context, fileID, status st
 func (r *FileRepository) CheckFileOwnership(ctx context.Context, fileID, ownerID string) (bool, error) {
 	var exists bool
 	query := `
-		SELECT EXISTS(SELECT 1 FROM files WHERE file_id = $1 AND owner_id = $2)
+		SELECT EXISTS(SELECT 1 FROM files WHERE (file_id = $1 OR object_id = $1) AND owner_id = $2 AND deleted_at IS NULL)
 	`
 
 	err := r.db.QueryRowContext(ctx, query, fileID, ownerID).Scan(&exists)
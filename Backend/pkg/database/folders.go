@@ -0,0 +1,500 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"echofs/internal/metadata"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNameConflict   = errors.New("name already exists")
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+	ErrInvalidMove    = errors.New("folder cannot be moved into itself")
+)
+
+// querier is what both the database and a transaction offer for reading.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const folderColumns = `folder_id, owner_id, COALESCE(parent_id, ''), name, created_at, updated_at`
+
+func scanFolder(row rowScanner) (*metadata.Folder, error) {
+	folder := &metadata.Folder{}
+	err := row.Scan(
+		&folder.FolderID,
+		&folder.OwnerID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// pathKey names the entry called name in folderID for lockPathsTx.
+func pathKey(folderID, name string) string {
+	return folderID + "/" + name
+}
+
+// lockPathsTx serializes changes to the given paths of an owner's namespace
+// until the transaction ends. Locks are taken in a fixed order so two
+// transactions locking the same paths can't deadlock.
+func lockPathsTx(ctx context.Context, tx *sql.Tx, ownerID string, keys ...string) error {
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || '/' || $2))`, ownerID, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentFileAt returns the object ID of the current file called name in
+// folderID.
+func currentFileAt(ctx context.Context, q querier, ownerID, folderID, name string) (string, error) {
+	var objectID string
+	err := q.QueryRowContext(ctx, `
+		SELECT object_id
+		FROM files
+		WHERE owner_id = $1 AND COALESCE(folder_id, '') = $2 AND original_name = $3 AND is_current AND deleted_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, ownerID, folderID, name).Scan(&objectID)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return objectID, err
+}
+
+// folderAt returns the ID of the subfolder called name in parentID.
+func folderAt(ctx context.Context, q querier, ownerID, parentID, name string) (string, error) {
+	var folderID string
+	err := q.QueryRowContext(ctx, `
+		SELECT folder_id
+		FROM folders
+		WHERE owner_id = $1 AND COALESCE(parent_id, '') = $2 AND name = $3
+	`, ownerID, parentID, name).Scan(&folderID)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return folderID, err
+}
+
+// checkNameFree fails with ErrNameConflict if parentID already holds a file
+// or folder called name, other than the entry with ID self.
+func checkNameFree(ctx context.Context, q querier, ownerID, parentID, name, self string) error {
+	objectID, err := currentFileAt(ctx, q, ownerID, parentID, name)
+	if err == nil && objectID != self {
+		return ErrNameConflict
+	}
+	if err != nil && err != ErrUserNotFound {
+		return err
+	}
+
+	folderID, err := folderAt(ctx, q, ownerID, parentID, name)
+	if err == nil && folderID != self {
+		return ErrNameConflict
+	}
+	if err != nil && err != ErrUserNotFound {
+		return err
+	}
+	return nil
+}
+
+// resolveFolder walks names down from the owner's root and returns the ID
+// of the folder they name, "" for the root. Missing folders are created if
+// tx is given, and reported as ErrUserNotFound otherwise.
+func resolveFolder(ctx context.Context, q querier, tx *sql.Tx, ownerID string, names []string) (string, error) {
+	folderID := ""
+	for _, name := range names {
+		childID, err := folderAt(ctx, q, ownerID, folderID, name)
+		if err == ErrUserNotFound && tx != nil {
+			childID, err = createFolderTx(ctx, tx, ownerID, folderID, name)
+		}
+		if err != nil {
+			return "", err
+		}
+		folderID = childID
+	}
+	return folderID, nil
+}
+
+// createFolderTx creates the folder called name in parentID, or returns the
+// existing one if another transaction just created it.
+func createFolderTx(ctx context.Context, tx *sql.Tx, ownerID, parentID, name string) (string, error) {
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(parentID, name)); err != nil {
+		return "", err
+	}
+
+	if folderID, err := folderAt(ctx, tx, ownerID, parentID, name); err != ErrUserNotFound {
+		return folderID, err
+	}
+	if err := checkNameFree(ctx, tx, ownerID, parentID, name, ""); err != nil {
+		return "", err
+	}
+
+	folderID := uuid.New().String()
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO folders (folder_id, owner_id, parent_id, name, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $5)
+	`, folderID, ownerID, parentID, name, now)
+	if err != nil {
+		return "", err
+	}
+	return folderID, nil
+}
+
+// ResolveFolder returns the ID of the owner's folder at the path given by
+// names, "" for the root. With create set, missing folders along the path
+// are created.
+func (r *FileRepository) ResolveFolder(ctx context.Context, ownerID string, names []string, create bool) (string, error) {
+	if !create {
+		return resolveFolder(ctx, r.db, nil, ownerID, names)
+	}
+
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	folderID, err := resolveFolder(ctx, tx, tx, ownerID, names)
+	if err != nil {
+		return "", err
+	}
+	return folderID, tx.Commit()
+}
+
+// CreateFolder creates the folder at the path given by names, along with any
+// missing parents. It fails with ErrNameConflict if the path already exists.
+func (r *FileRepository) CreateFolder(ctx context.Context, ownerID string, names []string) (*metadata.Folder, error) {
+	if len(names) == 0 {
+		return nil, ErrNameConflict
+	}
+
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	parentID, err := resolveFolder(ctx, tx, tx, ownerID, names[:len(names)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := names[len(names)-1]
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(parentID, name)); err != nil {
+		return nil, err
+	}
+	if _, err := folderAt(ctx, tx, ownerID, parentID, name); err != ErrUserNotFound {
+		if err == nil {
+			err = ErrNameConflict
+		}
+		return nil, err
+	}
+
+	folderID, err := createFolderTx(ctx, tx, ownerID, parentID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := scanFolder(tx.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE folder_id = $1`, folderID))
+	if err != nil {
+		return nil, err
+	}
+	folder.Path = metadata.JoinPath(names...)
+	return folder, tx.Commit()
+}
+
+// FolderPath returns the names along the path of the owner's folder, root
+// first.
+func (r *FileRepository) FolderPath(ctx context.Context, folderID, ownerID string) ([]string, error) {
+	return folderPath(ctx, r.db, folderID, ownerID)
+}
+
+func folderPath(ctx context.Context, q querier, folderID, ownerID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT parent_id, name, 0 AS depth FROM folders WHERE folder_id = $1 AND owner_id = $2
+			UNION ALL
+			SELECT f.parent_id, f.name, a.depth + 1 FROM folders f JOIN ancestors a ON f.folder_id = a.parent_id
+		)
+		SELECT name FROM ancestors ORDER BY depth DESC
+	`, folderID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	names, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return names, nil
+}
+
+// FolderPaths maps the ID of each of the owner's folders to its path.
+func (r *FileRepository) FolderPaths(ctx context.Context, ownerID string) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE owner_id = $1`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := make(map[string]*metadata.Folder)
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		folders[folder.FolderID] = folder
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string, len(folders))
+	var pathOf func(folderID string) string
+	pathOf = func(folderID string) string {
+		folder, ok := folders[folderID]
+		if !ok {
+			return ""
+		}
+		if path, ok := paths[folderID]; ok {
+			return path
+		}
+		path := pathOf(folder.ParentID) + "/" + folder.Name
+		paths[folderID] = path
+		return path
+	}
+	for folderID := range folders {
+		pathOf(folderID)
+	}
+	return paths, nil
+}
+
+// ListFolder returns the subfolders and the current files of the owner's
+// folder folderID, "" for the root, both sorted by name.
+func (r *FileRepository) ListFolder(ctx context.Context, ownerID, folderID string) ([]*metadata.Folder, []*metadata.FileMetadata, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+folderColumns+`
+		FROM folders
+		WHERE owner_id = $1 AND COALESCE(parent_id, '') = $2
+		ORDER BY name
+	`, ownerID, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var folders []*metadata.Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		folders = append(folders, folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	fileRows, err := r.db.QueryContext(ctx, `
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE owner_id = $1 AND COALESCE(folder_id, '') = $2 AND is_current AND deleted_at IS NULL
+		ORDER BY original_name
+	`, ownerID, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := scanFiles(fileRows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return folders, files, nil
+}
+
+// MoveFile renames or moves the owner's file fileID, with all its versions,
+// to name in the folder at dir, creating missing folders along the way.
+// Only metadata changes; the file's chunks stay where they are.
+func (r *FileRepository) MoveFile(ctx context.Context, fileID, ownerID string, dir []string, name string) (*metadata.FileMetadata, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + fileColumns + ` FROM files WHERE object_id = ` + objectOf + ` AND is_current`
+	file, err := scanFile(tx.QueryRowContext(ctx, query, fileID, ownerID))
+	if err != nil {
+		return nil, err
+	}
+
+	folderID, err := resolveFolder(ctx, tx, tx, ownerID, dir)
+	if err != nil {
+		return nil, err
+	}
+	if folderID == file.FolderID && name == file.OriginalName {
+		return file, nil
+	}
+
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(file.FolderID, file.OriginalName), pathKey(folderID, name)); err != nil {
+		return nil, err
+	}
+	if err := checkNameFree(ctx, tx, ownerID, folderID, name, file.ObjectID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE files
+		SET folder_id = NULLIF($1, ''), original_name = $2, updated_at = $3
+		WHERE object_id = $4
+	`, folderID, name, now, file.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	file.FolderID = folderID
+	file.OriginalName = name
+	file.UpdatedAt = now
+	return file, tx.Commit()
+}
+
+// MoveFolder renames or moves the owner's folder, with everything in it, to
+// name in the folder at dir, creating missing folders along the way.
+func (r *FileRepository) MoveFolder(ctx context.Context, folderID, ownerID string, dir []string, name string) (*metadata.Folder, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	folder, err := scanFolder(tx.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE folder_id = $1 AND owner_id = $2`, folderID, ownerID))
+	if err != nil {
+		return nil, err
+	}
+
+	parentID, err := resolveFolder(ctx, tx, tx, ownerID, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new parent must not be the folder itself or inside it.
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT folder_id, parent_id FROM folders WHERE folder_id = $1
+			UNION ALL
+			SELECT f.folder_id, f.parent_id FROM folders f JOIN ancestors a ON f.folder_id = a.parent_id
+		)
+		SELECT EXISTS(SELECT 1 FROM ancestors WHERE folder_id = $2)
+	`, parentID, folderID).Scan(&cycle)
+	if err != nil {
+		return nil, err
+	}
+	if cycle {
+		return nil, ErrInvalidMove
+	}
+
+	folder.Path = metadata.JoinPath(append(append([]string{}, dir...), name)...)
+	if parentID == folder.ParentID && name == folder.Name {
+		return folder, tx.Commit()
+	}
+
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(folder.ParentID, folder.Name), pathKey(parentID, name)); err != nil {
+		return nil, err
+	}
+	if err := checkNameFree(ctx, tx, ownerID, parentID, name, folderID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE folders
+		SET parent_id = NULLIF($1, ''), name = $2, updated_at = $3
+		WHERE folder_id = $4
+	`, parentID, name, now, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.ParentID = parentID
+	folder.Name = name
+	folder.UpdatedAt = now
+	return folder, tx.Commit()
+}
+
+// DeleteFolder deletes the owner's folder. Unless recursive is set the
+// folder must be empty; otherwise its subfolders go with it and the files in
+// them are moved to the trash, each keeping the path of the folder it was in.
+func (r *FileRepository) DeleteFolder(ctx context.Context, folderID, ownerID string, recursive bool) error {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := scanFolder(tx.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE folder_id = $1 AND owner_id = $2 FOR UPDATE`, folderID, ownerID)); err != nil {
+		return err
+	}
+
+	if !recursive {
+		var empty bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT NOT EXISTS(SELECT 1 FROM folders WHERE parent_id = $1)
+				AND NOT EXISTS(SELECT 1 FROM files WHERE folder_id = $1)
+		`, folderID).Scan(&empty)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return ErrFolderNotEmpty
+		}
+	}
+
+	names, err := folderPath(ctx, tx, folderID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT folder_id, $2::text AS path FROM folders WHERE folder_id = $1
+			UNION ALL
+			SELECT f.folder_id, t.path || '/' || f.name FROM folders f JOIN tree t ON f.parent_id = t.folder_id
+		)
+		UPDATE files
+		SET deleted_at = $3, deleted_path = tree.path, folder_id = NULL, updated_at = $3
+		FROM tree
+		WHERE files.folder_id = tree.folder_id
+	`, folderID, metadata.JoinPath(names...), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Subfolders go with their parent through ON DELETE CASCADE.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM folders WHERE folder_id = $1`, folderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"echofs/internal/metadata"
+
+	"github.com/lib/pq"
+)
+
+// staleChunk matches chunk rows no file refers to that have not been
+// touched since $1 and are not among the chunks in $2, which uploads still
+// in progress hold. Their reference counts were leaked by uploads that
+// never finished.
+const staleChunk = `
+	updated_at < $1 AND NOT (chunk_id = ANY($2))
+	AND NOT EXISTS (SELECT 1 FROM file_chunks fc WHERE fc.chunk_id = chunks.chunk_id)
+`
+
+func staleChunkArgs(before time.Time, live []string) []interface{} {
+	if live == nil {
+		// A NULL array would match nothing rather than exclude nothing.
+		live = []string{}
+	}
+	return []interface{}{before, pq.Array(live)}
+}
+
+// ListStaleChunks returns the chunk rows DeleteStaleChunks would delete.
+func (r *FileRepository) ListStaleChunks(ctx context.Context, before time.Time, live []string) ([]metadata.ChunkRef, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT chunk_id, size, checksum, data_shards, parity_shards, workers, version
+		FROM chunks
+		WHERE `+staleChunk, staleChunkArgs(before, live)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanChunkRows(rows)
+}
+
+// DeleteStaleChunks deletes chunk rows no file refers to that have not been
+// touched since before, except those in live. The deleted chunks are
+// returned so the caller can remove them from the workers.
+func (r *FileRepository) DeleteStaleChunks(ctx context.Context, before time.Time, live []string) ([]metadata.ChunkRef, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		DELETE FROM chunks
+		WHERE `+staleChunk+`
+		RETURNING chunk_id, size, checksum, data_shards, parity_shards, workers, version
+	`, staleChunkArgs(before, live)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanChunkRows(rows)
+}
+
+// ExistingChunks reports which of chunkIDs have a chunk row.
+func (r *FileRepository) ExistingChunks(ctx context.Context, chunkIDs []string) (map[string]bool, error) {
+	return r.existing(ctx, `SELECT chunk_id FROM chunks WHERE chunk_id = ANY($1)`, chunkIDs)
+}
+
+// ExistingFiles reports which of fileIDs name a file version, including
+// versions in the trash.
+func (r *FileRepository) ExistingFiles(ctx context.Context, fileIDs []string) (map[string]bool, error) {
+	return r.existing(ctx, `SELECT file_id FROM files WHERE file_id = ANY($1)`, fileIDs)
+}
+
+func (r *FileRepository) existing(ctx context.Context, query string, ids []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range existing {
+		found[id] = true
+	}
+	return found, nil
+}
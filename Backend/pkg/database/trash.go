@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"echofs/internal/metadata"
+)
+
+// trashedObjectOf is objectOf for files in the trash.
+const trashedObjectOf = `(SELECT object_id FROM files WHERE (object_id = $1 OR file_id = $1) AND owner_id = $2 AND deleted_at IS NOT NULL LIMIT 1)`
+
+// TrashFile moves the owner's file, with all its versions, to the trash. The
+// file leaves its folder, whose path is kept so the file can be restored
+// there.
+func (r *FileRepository) TrashFile(ctx context.Context, fileID, ownerID string) (*metadata.FileMetadata, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + fileColumns + ` FROM files WHERE object_id = ` + objectOf + ` AND is_current`
+	file, err := scanFile(tx.QueryRowContext(ctx, query, fileID, ownerID))
+	if err != nil {
+		return nil, err
+	}
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(file.FolderID, file.OriginalName)); err != nil {
+		return nil, err
+	}
+
+	path := ""
+	if file.FolderID != "" {
+		names, err := folderPath(ctx, tx, file.FolderID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		path = metadata.JoinPath(names...)
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE files
+		SET deleted_at = $1, deleted_path = $2, folder_id = NULL, updated_at = $1
+		WHERE object_id = $3
+	`, now, path, file.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	file.FolderID = ""
+	file.DeletedAt = &now
+	file.DeletedPath = path
+	return file, tx.Commit()
+}
+
+// ListTrash lists the files in the owner's trash, most recently deleted
+// first.
+func (r *FileRepository) ListTrash(ctx context.Context, ownerID string) ([]*metadata.FileMetadata, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE owner_id = $1 AND is_current AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// RestoreFromTrash takes the owner's file out of the trash, as name in the
+// folder at dir, creating missing folders along the way. An empty name
+// restores the file where it was deleted from.
+func (r *FileRepository) RestoreFromTrash(ctx context.Context, fileID, ownerID string, dir []string, name string) (*metadata.FileMetadata, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + fileColumns + ` FROM files WHERE object_id = ` + trashedObjectOf + ` AND is_current`
+	file, err := scanFile(tx.QueryRowContext(ctx, query, fileID, ownerID))
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		if dir, err = metadata.SplitPath(file.DeletedPath); err != nil {
+			return nil, err
+		}
+		name = file.OriginalName
+	}
+
+	folderID, err := resolveFolder(ctx, tx, tx, ownerID, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockPathsTx(ctx, tx, ownerID, pathKey(folderID, name)); err != nil {
+		return nil, err
+	}
+	if err := checkNameFree(ctx, tx, ownerID, folderID, name, ""); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE files
+		SET deleted_at = NULL, deleted_path = NULL, folder_id = NULLIF($1, ''), original_name = $2, updated_at = $3
+		WHERE object_id = $4
+	`, folderID, name, now, file.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	file.FolderID = folderID
+	file.OriginalName = name
+	file.DeletedAt = nil
+	file.DeletedPath = ""
+	file.UpdatedAt = now
+	return file, tx.Commit()
+}
+
+// EmptyTrash permanently deletes every file in the owner's trash. Chunks no
+// other file refers to are returned so the caller can delete them from the
+// workers.
+func (r *FileRepository) EmptyTrash(ctx context.Context, ownerID string) ([]metadata.ChunkRef, error) {
+	return r.purgeTrashed(ctx, `owner_id = $1`, ownerID)
+}
+
+// PurgeTrash permanently deletes every file that went to the trash before
+// the given time, for all owners.
+func (r *FileRepository) PurgeTrash(ctx context.Context, before time.Time) ([]metadata.ChunkRef, error) {
+	return r.purgeTrashed(ctx, `deleted_at < $1`, before)
+}
+
+func (r *FileRepository) purgeTrashed(ctx context.Context, condition string, args ...interface{}) ([]metadata.ChunkRef, error) {
+	tx, err := r.db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT file_id FROM files WHERE deleted_at IS NOT NULL AND `+condition+` FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	fileIDs, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+
+	orphaned, err := deleteFilesTx(ctx, tx, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return orphaned, tx.Commit()
+}
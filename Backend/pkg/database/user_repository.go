@@ -50,6 +50,9 @@ func (r *UserRepository) InitSchema(ctx context.Context) error {
 	
 	-- Update admin user if exists
 	UPDATE users SET role = 'admin' WHERE username = 'admin';
+	
+	-- How many versions of each file to keep; 0 keeps all, NULL uses the server default
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS version_retention INTEGER;
 	`
 
 	_, err := r.db.ExecContext(ctx, query)
@@ -166,3 +169,55 @@ func (r *UserRepository) AuthenticateUser(ctx context.Context, email, password s
 
 	return user, nil
 }
+
+// GetVersionRetention returns how many versions of each file the user keeps,
+// 0 meaning all of them, or nil if the user has not set a limit.
+func (r *UserRepository) GetVersionRetention(ctx context.Context, userID string) (*int, error) {
+	var retention sql.NullInt64
+	query := `SELECT version_retention FROM users WHERE id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&retention)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !retention.Valid {
+		return nil, nil
+	}
+
+	keep := int(retention.Int64)
+	return &keep, nil
+}
+
+// SetVersionRetention sets how many versions of each file the user keeps;
+// 0 keeps all of them and nil clears the limit back to the server default.
+func (r *UserRepository) SetVersionRetention(ctx context.Context, userID string, retention *int) error {
+	query := `
+		UPDATE users
+		SET version_retention = $1, updated_at = $2
+		WHERE id = $3
+	`
+
+	var value sql.NullInt64
+	if retention != nil {
+		value = sql.NullInt64{Int64: int64(*retention), Valid: true}
+	}
+
+	result, err := r.db.ExecContext(ctx, query, value, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
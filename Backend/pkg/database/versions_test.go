@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"echofs/internal/metadata"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func newMockDB(t *testing.T) (*PostgresDB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return &PostgresDB{db: db}, mock
+}
+
+// fileRows returns files as rows of fileColumns.
+func fileRows(files ...*metadata.FileMetadata) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{
+		"file_id", "object_id", "version", "is_current", "folder_id", "deleted_at", "deleted_path",
+		"owner_id", "original_name", "size", "chunk_size", "total_chunks", "md5_hash", "sha256_hash",
+		"encryption_key_id", "wrapped_data_key", "status", "created_at", "updated_at",
+	})
+	for _, f := range files {
+		rows.AddRow(f.FileID, f.ObjectID, f.Version, f.IsCurrent, f.FolderID, nil, "",
+			f.OwnerID, f.OriginalName, f.Size, f.ChunkSize, f.TotalChunks, f.MD5Hash, f.SHA256Hash,
+			"", nil, f.Status, f.CreatedAt, f.UpdatedAt)
+	}
+	return rows
+}
+
+func fileVersion(objectID string, n int64, current bool) *metadata.FileMetadata {
+	return &metadata.FileMetadata{
+		FileID:       fmt.Sprintf("%s-v%d", objectID, n),
+		ObjectID:     objectID,
+		Version:      n,
+		IsCurrent:    current,
+		OwnerID:      "owner",
+		OriginalName: "report.txt",
+		Size:         100 * n,
+		Status:       "completed",
+		CreatedAt:    time.Unix(1700000000+n, 0).UTC(),
+		UpdatedAt:    time.Unix(1700000000+n, 0).UTC(),
+	}
+}
+
+func TestPruneVersionsDeletesBeyondKeep(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewFileRepository(db)
+
+	mock.ExpectBegin()
+	// The current version counts towards keep, so only keep-1 older ones
+	// are skipped.
+	mock.ExpectQuery(`SELECT file_id\s+FROM files\s+WHERE object_id = \$1 AND NOT is_current\s+ORDER BY version DESC\s+OFFSET \$2`).
+		WithArgs("obj", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"file_id"}).AddRow("obj-v2").AddRow("obj-v1"))
+	mock.ExpectQuery(`SELECT chunk_id FROM file_chunks WHERE file_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"obj-v2", "obj-v1"})).
+		WillReturnRows(sqlmock.NewRows([]string{"chunk_id"}).AddRow("shared").AddRow("old").AddRow("shared"))
+	mock.ExpectExec(`DELETE FROM files WHERE file_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"obj-v2", "obj-v1"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE chunks c\s+SET ref_count = GREATEST`).
+		WithArgs(pq.Array([]string{"shared", "old", "shared"}), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`DELETE FROM chunks\s+WHERE chunk_id = ANY\(\$1\) AND ref_count = 0`).
+		WithArgs(pq.Array([]string{"shared", "old", "shared"})).
+		WillReturnRows(sqlmock.NewRows([]string{"chunk_id", "size", "checksum", "data_shards", "parity_shards", "workers", "version"}).
+			AddRow("old", 64, "sum", 0, 0, "{w1,w2}", 1))
+	mock.ExpectCommit()
+
+	orphaned, err := repo.PruneVersions(context.Background(), "obj", 3)
+	if err != nil {
+		t.Fatalf("PruneVersions: %v", err)
+	}
+	want := []metadata.ChunkRef{{ChunkID: "old", Size: 64, Checksum: "sum", Workers: []string{"w1", "w2"}, Version: 1}}
+	if !reflect.DeepEqual(orphaned, want) {
+		t.Errorf("PruneVersions orphaned %+v, want %+v", orphaned, want)
+	}
+}
+
+func TestPruneVersionsWithinKeep(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewFileRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT file_id\s+FROM files`).
+		WithArgs("obj", 4).
+		WillReturnRows(sqlmock.NewRows([]string{"file_id"}))
+	mock.ExpectRollback()
+
+	orphaned, err := repo.PruneVersions(context.Background(), "obj", 5)
+	if err != nil || orphaned != nil {
+		t.Fatalf("PruneVersions = %v, %v; want nothing pruned", orphaned, err)
+	}
+}
+
+func TestListVersionsNewestFirst(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewFileRepository(db)
+
+	v1, v2 := fileVersion("obj", 1, false), fileVersion("obj", 2, true)
+	// Any version's ID finds the whole object.
+	mock.ExpectQuery(`FROM files\s+WHERE object_id = \(SELECT object_id FROM files WHERE \(object_id = \$1 OR file_id = \$1\) AND owner_id = \$2 .*\)\s+ORDER BY version DESC`).
+		WithArgs(v1.FileID, "owner").
+		WillReturnRows(fileRows(v2, v1))
+
+	versions, err := repo.ListVersions(context.Background(), v1.FileID, "owner")
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+	if !reflect.DeepEqual(versions, []*metadata.FileMetadata{v2, v1}) {
+		t.Errorf("ListVersions = %+v, want v2, v1", versions)
+	}
+}
+
+func TestRestoreVersionAddsNewestVersion(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewFileRepository(db)
+
+	source := fileVersion("obj", 1, false)
+	current := fileVersion("obj", 3, true)
+	current.FolderID = "folder"
+	current.OriginalName = "renamed.txt"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM files WHERE object_id = \(SELECT object_id .*\) AND version = \$3`).
+		WithArgs("obj", "owner", int64(1)).
+		WillReturnRows(fileRows(source))
+	mock.ExpectQuery(`FROM files WHERE object_id = \$1 AND is_current`).
+		WithArgs("obj").
+		WillReturnRows(fileRows(current))
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs("owner", "folder/renamed.txt").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM files WHERE object_id = \$1`).
+		WithArgs("obj").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(3))
+	mock.ExpectExec(`UPDATE files SET is_current = FALSE`).
+		WithArgs("obj", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO files`).
+		WithArgs("restored", "obj", int64(4), true, "folder", "owner", "renamed.txt", source.Size,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The restored version shares the source's chunks.
+	mock.ExpectExec(`INSERT INTO file_chunks .*\s+SELECT \$1, .*\s+FROM file_chunks\s+WHERE file_id = \$2`).
+		WithArgs("restored", source.FileID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE chunks c\s+SET ref_count = c.ref_count \+ r.refs`).
+		WithArgs("restored", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	restored, err := repo.RestoreVersion(context.Background(), "obj", "owner", 1, "restored")
+	if err != nil {
+		t.Fatalf("RestoreVersion: %v", err)
+	}
+	if restored.FileID != "restored" || restored.Version != 4 || !restored.IsCurrent {
+		t.Errorf("restored %s as version %d (current %v), want restored as current version 4",
+			restored.FileID, restored.Version, restored.IsCurrent)
+	}
+	if restored.FolderID != "folder" || restored.OriginalName != "renamed.txt" {
+		t.Errorf("restored to %s/%s, want the current path folder/renamed.txt", restored.FolderID, restored.OriginalName)
+	}
+	if restored.Size != source.Size || restored.SHA256Hash != source.SHA256Hash {
+		t.Errorf("restored content differs from version 1")
+	}
+}
+
+func TestRestoreVersionNotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewFileRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`AND version = \$3`).
+		WithArgs("obj", "owner", int64(9)).
+		WillReturnRows(fileRows())
+	mock.ExpectRollback()
+
+	if _, err := repo.RestoreVersion(context.Background(), "obj", "owner", 9, "restored"); err != ErrUserNotFound {
+		t.Fatalf("RestoreVersion of a missing version = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestVersionRetentionUnsetIsNull(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewUserRepository(db)
+	zero, five := 0, 5
+
+	for _, tt := range []struct {
+		stored interface{}
+		want   *int
+	}{
+		{stored: nil, want: nil},
+		{stored: 0, want: &zero},
+		{stored: 5, want: &five},
+	} {
+		mock.ExpectQuery(`SELECT version_retention FROM users WHERE id = \$1`).
+			WithArgs("user").
+			WillReturnRows(sqlmock.NewRows([]string{"version_retention"}).AddRow(tt.stored))
+
+		got, err := repo.GetVersionRetention(context.Background(), "user")
+		if err != nil {
+			t.Fatalf("GetVersionRetention: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("stored %v: GetVersionRetention = %v, want %v", tt.stored, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		retention *int
+		stored    interface{}
+	}{
+		{retention: nil, stored: nil},
+		{retention: &zero, stored: int64(0)},
+		{retention: &five, stored: int64(5)},
+	} {
+		mock.ExpectExec(`UPDATE users\s+SET version_retention = \$1`).
+			WithArgs(tt.stored, sqlmock.AnyArg(), "user").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.SetVersionRetention(context.Background(), "user", tt.retention); err != nil {
+			t.Fatalf("SetVersionRetention(%v): %v", tt.stored, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package encryption implements envelope encryption for chunks at rest: each
+// file gets its own AES-256 data key, chunks are sealed with AES-GCM under
+// that key, and the data key is stored wrapped by a master key held in a KMS.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// DataKeySize is the size of a per-file data key (AES-256).
+const DataKeySize = 32
+
+// Overhead is the number of bytes EncryptChunk adds to a chunk: the nonce
+// followed by the GCM tag.
+const Overhead = 12 + 16
+
+// ErrDecryptionFailed means a ciphertext did not authenticate: it was
+// corrupted, tampered with, or sealed under another key or context.
+var ErrDecryptionFailed = errors.New("decryption failed: ciphertext not authentic")
+
+// GenerateDataKey returns a fresh random data key.
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// EncryptChunk seals plaintext with key. The additional data, typically the
+// chunk ID, is authenticated but not stored, so a sealed chunk can't be
+// passed off as another one.
+func EncryptChunk(key, additionalData, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// DecryptChunk opens a chunk sealed by EncryptChunk. It returns an error
+// wrapping ErrDecryptionFailed if the chunk does not authenticate.
+func DecryptChunk(key, additionalData, ciphertext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrDecryptionFailed, len(ciphertext))
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != DataKeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d", len(key), DataKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
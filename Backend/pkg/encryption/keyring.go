@@ -0,0 +1,160 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LocalKeyring is a KMS backed by a JSON file of master keys. It is meant for
+// development, tests and single-node setups; the file must be protected like
+// any other secret.
+type LocalKeyring struct {
+	path string
+
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+var _ KMS = (*LocalKeyring)(nil)
+var _ Rotator = (*LocalKeyring)(nil)
+
+// NewLocalKeyring loads the keyring at path, creating it with a first master
+// key if it does not exist.
+func NewLocalKeyring(path string) (*LocalKeyring, error) {
+	k := &LocalKeyring{path: path, keys: make(map[string][]byte)}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := k.Rotate(context.Background()); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring %s: %w", path, err)
+	}
+	if _, exists := file.Keys[file.Current]; !exists {
+		return nil, fmt.Errorf("keyring %s has no current key", path)
+	}
+	for id, key := range file.Keys {
+		if len(key) != DataKeySize {
+			return nil, fmt.Errorf("master key %s has invalid size %d", id, len(key))
+		}
+	}
+
+	k.current = file.Current
+	k.keys = file.Keys
+	return k, nil
+}
+
+func (k *LocalKeyring) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+func (k *LocalKeyring) WrapKey(ctx context.Context, dataKey []byte) (WrappedKey, error) {
+	k.mu.RLock()
+	keyID, masterKey := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	ciphertext, err := EncryptChunk(masterKey, []byte(keyID), dataKey)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{KeyID: keyID, Ciphertext: ciphertext}, nil
+}
+
+func (k *LocalKeyring) UnwrapKey(ctx context.Context, wrapped WrappedKey) ([]byte, error) {
+	k.mu.RLock()
+	masterKey, exists := k.keys[wrapped.KeyID]
+	k.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown master key %q", wrapped.KeyID)
+	}
+
+	dataKey, err := DecryptChunk(masterKey, []byte(wrapped.KeyID), wrapped.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// Rotate adds a new master key, makes it current and saves the keyring.
+func (k *LocalKeyring) Rotate(ctx context.Context) (string, error) {
+	masterKey, err := GenerateDataKey()
+	if err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	keyID := fmt.Sprintf("local-%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make(map[string][]byte, len(k.keys)+1)
+	for id, key := range k.keys {
+		keys[id] = key
+	}
+	keys[keyID] = masterKey
+
+	if err := saveKeyring(k.path, keyringFile{Current: keyID, Keys: keys}); err != nil {
+		return "", err
+	}
+	k.current = keyID
+	k.keys = keys
+	return keyID, nil
+}
+
+// saveKeyring writes the keyring next to its final path and renames it into
+// place so a crash never leaves a truncated keyring behind.
+func saveKeyring(path string, file keyringFile) error {
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,62 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+)
+
+// WrappedKey is a data key encrypted under the master key KeyID.
+type WrappedKey struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KMS holds the master keys. Data keys never leave the master in plaintext
+// form except in memory; only their wrapped form is persisted.
+type KMS interface {
+	// CurrentKeyID is the master key new data keys are wrapped with.
+	CurrentKeyID() string
+	WrapKey(ctx context.Context, dataKey []byte) (WrappedKey, error)
+	// UnwrapKey must keep working for keys wrapped under master keys
+	// that have since been rotated out.
+	UnwrapKey(ctx context.Context, wrapped WrappedKey) ([]byte, error)
+}
+
+// Rotator is implemented by KMSs that can switch to a new master key.
+type Rotator interface {
+	// Rotate creates a new master key, makes it current and returns its
+	// ID. Older master keys stay available for unwrapping.
+	Rotate(ctx context.Context) (string, error)
+}
+
+// NewDataKey generates a data key and wraps it with the current master key.
+func NewDataKey(ctx context.Context, kms KMS) ([]byte, WrappedKey, error) {
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		return nil, WrappedKey{}, err
+	}
+	wrapped, err := kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, WrappedKey{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return dataKey, wrapped, nil
+}
+
+// Rewrap re-encrypts a wrapped data key under the current master key. The
+// data key itself, and so every chunk encrypted with it, is unchanged. It
+// reports false if the key was already wrapped with the current master key.
+func Rewrap(ctx context.Context, kms KMS, wrapped WrappedKey) (WrappedKey, bool, error) {
+	if wrapped.KeyID == kms.CurrentKeyID() {
+		return wrapped, false, nil
+	}
+
+	dataKey, err := kms.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return wrapped, false, err
+	}
+	rewrapped, err := kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return wrapped, false, err
+	}
+	return rewrapped, true, nil
+}
@@ -0,0 +1,203 @@
+package fileops
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// Chunking modes that can be selected per upload or by policy.
+const (
+	ChunkingFixed = "fixed"
+	ChunkingCDC   = "cdc"
+)
+
+// StreamChunker is a FileChunker that can also cut a stream as it arrives.
+type StreamChunker interface {
+	FileChunker
+	ChunkStream(r io.Reader, fn func(chunk ChunkMeta, data []byte) error) (int, error)
+}
+
+// minCDCChunkSize keeps the rolling hash window (64 bytes) inside a chunk.
+const minCDCChunkSize = 64
+
+// gearTable maps every byte to a random 64-bit value for the gear hash. It
+// is generated from a fixed seed so chunk boundaries are identical across
+// builds and machines, which dedup depends on.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x45636866734344) // "EchfsCD"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// CDCChunker cuts data at content-defined boundaries using FastCDC with
+// normalized chunking. Boundaries depend only on the bytes around them, so
+// an insertion near the start of a file only changes the chunks it touches
+// instead of shifting every chunk after it.
+type CDCChunker struct {
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // stricter mask used before the average size
+	maskL   uint64 // looser mask used after the average size
+}
+
+// NewCDCChunker creates a content-defined chunker. Chunks are never smaller
+// than minSize (except the last one) or larger than maxSize, and average
+// about avgSize.
+func NewCDCChunker(minSize, avgSize, maxSize int) (*CDCChunker, error) {
+	if minSize < minCDCChunkSize {
+		return nil, fmt.Errorf("minimum chunk size must be at least %d bytes", minCDCChunkSize)
+	}
+	if avgSize < minSize || maxSize < avgSize {
+		return nil, fmt.Errorf("chunk sizes must satisfy min <= avg <= max, got %d/%d/%d", minSize, avgSize, maxSize)
+	}
+
+	avgBits := bits.Len(uint(avgSize)) - 1
+	if avgBits < 3 {
+		avgBits = 3
+	}
+	return &CDCChunker{
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   highMask(avgBits + 2),
+		maskL:   highMask(avgBits - 2),
+	}, nil
+}
+
+// highMask sets the n most significant bits. The gear hash shifts left, so
+// the high bits depend on the last 64 bytes while the low bits only see the
+// last few.
+func highMask(n int) uint64 {
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// Cut returns the length of the first chunk of data. data is expected to be
+// the rest of the stream or at least maxSize bytes of it.
+func (c *CDCChunker) Cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	normal := c.avgSize
+	if normal > n {
+		normal = n
+	}
+
+	var fp uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// ChunkStream cuts r at content-defined boundaries as the data arrives and
+// hands each chunk to fn together with its metadata. The data slice is
+// reused between calls, so fn must copy it if it needs to keep it.
+func (c *CDCChunker) ChunkStream(r io.Reader, fn func(chunk ChunkMeta, data []byte) error) (int, error) {
+	buffer := make([]byte, c.maxSize)
+	filled := 0
+	index := 0
+	eof := false
+
+	for {
+		if !eof {
+			n, err := io.ReadFull(r, buffer[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return index, err
+			}
+		}
+		if filled == 0 {
+			return index, nil
+		}
+
+		cut := c.Cut(buffer[:filled])
+		hash := md5.Sum(buffer[:cut])
+		chunk := ChunkMeta{MD5Hash: hex.EncodeToString(hash[:]), Index: index}
+		if err := fn(chunk, buffer[:cut]); err != nil {
+			return index, err
+		}
+		index++
+
+		filled = copy(buffer, buffer[cut:filled])
+	}
+}
+
+// ChunkFile splits the file into content-defined chunks written next to it
+// as <path>.chunk.<index>.
+func (c *CDCChunker) ChunkFile(filePath string) ([]ChunkMeta, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var chunks []ChunkMeta
+	_, err = c.ChunkStream(file, func(chunk ChunkMeta, data []byte) error {
+		chunk.FileName = fmt.Sprintf("%s.chunk.%d", filePath, chunk.Index)
+		if err := os.WriteFile(chunk.FileName, data, 0644); err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// ChunkLargeFile is the same as ChunkFile. Content-defined boundaries depend
+// on the preceding bytes, so unlike fixed-size chunks they cannot be cut in
+// parallel from precomputed offsets.
+func (c *CDCChunker) ChunkLargeFile(filePath string) ([]ChunkMeta, error) {
+	return c.ChunkFile(filePath)
+}
+
+// NewStreamChunker returns the chunker for a chunking mode. Fixed-size
+// chunking uses chunkSize; content-defined chunking uses the min/avg/max
+// sizes. An empty mode selects fixed-size chunking.
+func NewStreamChunker(mode string, chunkSize, minSize, avgSize, maxSize int) (StreamChunker, error) {
+	switch mode {
+	case "", ChunkingFixed:
+		if chunkSize <= 0 {
+			return nil, fmt.Errorf("chunk size must be positive")
+		}
+		return NewDefaultFileChunker(chunkSize), nil
+	case ChunkingCDC:
+		return NewCDCChunker(minSize, avgSize, maxSize)
+	default:
+		return nil, fmt.Errorf("unknown chunking mode %q", mode)
+	}
+}
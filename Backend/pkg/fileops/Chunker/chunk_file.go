@@ -136,4 +136,29 @@ func (c *DefaultFileChunker) ChunkLargeFile(filePath string) ([]ChunkMeta, error
 		}
 	}
 	return chunks, nil
-}
\ No newline at end of file
+}
+
+// ChunkStream cuts r into chunkSize pieces as the data arrives and hands each
+// one to fn together with its metadata. The data slice is reused between
+// calls, so fn must copy it if it needs to keep it.
+func (c *DefaultFileChunker) ChunkStream(r io.Reader, fn func(chunk ChunkMeta, data []byte) error) (int, error) {
+	buffer := make([]byte, c.chunkSize)
+	index := 0
+	for {
+		bytesRead, err := io.ReadFull(r, buffer)
+		if bytesRead > 0 {
+			hash := md5.Sum(buffer[:bytesRead])
+			chunk := ChunkMeta{MD5Hash: hex.EncodeToString(hash[:]), Index: index}
+			if err := fn(chunk, buffer[:bytesRead]); err != nil {
+				return index, err
+			}
+			index++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, err
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec names as recorded in the chunk map.
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecLZ4  = "lz4"
+	CodecZstd = "zstd"
+)
+
+// SampleSize is how much of the input SelectCodec looks at.
+const SampleSize = 64 * 1024
+
+// minSavings is the fraction a sample has to shrink by for compression to be
+// worth the CPU on upload and download.
+const minSavings = 0.05
+
+// Codec compresses and decompresses streams in one format.
+type Codec interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(noneCodec{})
+	RegisterCodec(gzipCodec{})
+	RegisterCodec(lz4Codec{})
+	RegisterCodec(zstdCodec{})
+}
+
+// RegisterCodec makes a codec available by name, replacing any codec of the
+// same name.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// GetCodec returns the codec registered under name. An empty name selects
+// gzip, which is what files were compressed with before codecs existed.
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecGzip
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	if codec, exists := codecs[name]; exists {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %q", name)
+}
+
+// Codecs lists the names of the registered codecs.
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// precompressedExtensions are formats that are already compressed, so a
+// general-purpose codec can't shrink them further.
+var precompressedExtensions = map[string]bool{
+	".7z": true, ".avi": true, ".br": true, ".bz2": true, ".docx": true,
+	".flac": true, ".gif": true, ".gz": true, ".heic": true, ".jar": true,
+	".jpeg": true, ".jpg": true, ".lz4": true, ".mkv": true, ".mov": true,
+	".mp3": true, ".mp4": true, ".ogg": true, ".pdf": true, ".png": true,
+	".pptx": true, ".rar": true, ".webm": true, ".webp": true, ".xlsx": true,
+	".xz": true, ".zip": true, ".zst": true,
+}
+
+// SelectCodec returns codec unless the data is not worth compressing, in
+// which case it returns the none codec. Known compressed formats are skipped
+// by file name; everything else is decided by compressing the sample, which
+// should be the first SampleSize bytes of the data.
+func SelectCodec(codec Codec, sample []byte, fileName string) Codec {
+	if codec.Name() == CodecNone || len(sample) == 0 {
+		return codec
+	}
+	if precompressedExtensions[strings.ToLower(filepath.Ext(fileName))] {
+		return noneCodec{}
+	}
+
+	encoded, err := Encode(codec, sample)
+	if err != nil || !Shrinks(len(sample), len(encoded)) {
+		return noneCodec{}
+	}
+	return codec
+}
+
+// Shrinks reports whether compressing original bytes down to compressed
+// bytes saves enough to be worth decoding later.
+func Shrinks(original, compressed int) bool {
+	return float64(compressed) <= float64(original)*(1-minSavings)
+}
+
+// Encode compresses data in one call.
+func Encode(codec Codec, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := codec.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decompresses data in one call.
+func Decode(codec Codec, data []byte) ([]byte, error) {
+	r, err := codec.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string { return CodecNone }
+
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return CodecGzip }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
@@ -29,4 +29,4 @@ func Compress(filePath string) (*os.File, error) {
 	gzipWriter.Close()
 	outputFile.Seek(0, 0)
 	return outputFile, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,25 @@
+package compressor
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdCodec writes standard zstd frames. Chunks are compressed one at a time
+// on many goroutines already, so the encoder and decoder stay single-threaded.
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return CodecZstd }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
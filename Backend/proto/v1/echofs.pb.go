@@ -395,6 +395,519 @@ func (x *DeleteChunkResponse) GetWorkerId() string {
 	return ""
 }
 
+type StoredChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FileId        string                 `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	ChunkId       string                 `protobuf:"bytes,2,opt,name=chunk_id,json=chunkId,proto3" json:"chunk_id,omitempty"`
+	ChunkIndex    int32                  `protobuf:"varint,3,opt,name=chunk_index,json=chunkIndex,proto3" json:"chunk_index,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	ModifiedAt    int64                  `protobuf:"varint,5,opt,name=modified_at,json=modifiedAt,proto3" json:"modified_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoredChunk) Reset() {
+	*x = StoredChunk{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoredChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoredChunk) ProtoMessage() {}
+
+func (x *StoredChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*StoredChunk) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StoredChunk) GetFileId() string {
+	if x != nil {
+		return x.FileId
+	}
+	return ""
+}
+
+func (x *StoredChunk) GetChunkId() string {
+	if x != nil {
+		return x.ChunkId
+	}
+	return ""
+}
+
+func (x *StoredChunk) GetChunkIndex() int32 {
+	if x != nil {
+		return x.ChunkIndex
+	}
+	return 0
+}
+
+func (x *StoredChunk) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *StoredChunk) GetModifiedAt() int64 {
+	if x != nil {
+		return x.ModifiedAt
+	}
+	return 0
+}
+
+type ListChunksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	WorkerId      string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	PageToken     string                 `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	PageSize      int32                  `protobuf:"varint,3,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListChunksRequest) Reset() {
+	*x = ListChunksRequest{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListChunksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChunksRequest) ProtoMessage() {}
+
+func (x *ListChunksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*ListChunksRequest) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListChunksRequest) GetWorkerId() string {
+	if x != nil {
+		return x.WorkerId
+	}
+	return ""
+}
+
+func (x *ListChunksRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ListChunksRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+type ListChunksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Chunks        []*StoredChunk         `protobuf:"bytes,3,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	NextPageToken string                 `protobuf:"bytes,4,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	SharedStorage bool                   `protobuf:"varint,5,opt,name=shared_storage,json=sharedStorage,proto3" json:"shared_storage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListChunksResponse) Reset() {
+	*x = ListChunksResponse{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListChunksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChunksResponse) ProtoMessage() {}
+
+func (x *ListChunksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*ListChunksResponse) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListChunksResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ListChunksResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ListChunksResponse) GetChunks() []*StoredChunk {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+func (x *ListChunksResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+func (x *ListChunksResponse) GetSharedStorage() bool {
+	if x != nil {
+		return x.SharedStorage
+	}
+	return false
+}
+
+type ChunkHeader struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FileId        string                 `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	ChunkId       string                 `protobuf:"bytes,2,opt,name=chunk_id,json=chunkId,proto3" json:"chunk_id,omitempty"`
+	ChunkIndex    int32                  `protobuf:"varint,3,opt,name=chunk_index,json=chunkIndex,proto3" json:"chunk_index,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkHeader) Reset() {
+	*x = ChunkHeader{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkHeader) ProtoMessage() {}
+
+func (x *ChunkHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*ChunkHeader) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ChunkHeader) GetFileId() string {
+	if x != nil {
+		return x.FileId
+	}
+	return ""
+}
+
+func (x *ChunkHeader) GetChunkId() string {
+	if x != nil {
+		return x.ChunkId
+	}
+	return ""
+}
+
+func (x *ChunkHeader) GetChunkIndex() int32 {
+	if x != nil {
+		return x.ChunkIndex
+	}
+	return 0
+}
+
+func (x *ChunkHeader) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type ChunkTrailer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sha256        string                 `protobuf:"bytes,1,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkTrailer) Reset() {
+	*x = ChunkTrailer{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkTrailer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkTrailer) ProtoMessage() {}
+
+func (x *ChunkTrailer) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*ChunkTrailer) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ChunkTrailer) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type StoreChunkStreamRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+
+
+
+
+
+	Frame         isStoreChunkStreamRequest_Frame `protobuf_oneof:"frame"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoreChunkStreamRequest) Reset() {
+	*x = StoreChunkStreamRequest{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoreChunkStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreChunkStreamRequest) ProtoMessage() {}
+
+func (x *StoreChunkStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*StoreChunkStreamRequest) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StoreChunkStreamRequest) GetFrame() isStoreChunkStreamRequest_Frame {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *StoreChunkStreamRequest) GetHeader() *ChunkHeader {
+	if x != nil {
+		if x, ok := x.Frame.(*StoreChunkStreamRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *StoreChunkStreamRequest) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Frame.(*StoreChunkStreamRequest_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+func (x *StoreChunkStreamRequest) GetTrailer() *ChunkTrailer {
+	if x != nil {
+		if x, ok := x.Frame.(*StoreChunkStreamRequest_Trailer); ok {
+			return x.Trailer
+		}
+	}
+	return nil
+}
+
+type isStoreChunkStreamRequest_Frame interface {
+	isStoreChunkStreamRequest_Frame()
+}
+
+type StoreChunkStreamRequest_Header struct {
+	Header *ChunkHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type StoreChunkStreamRequest_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+type StoreChunkStreamRequest_Trailer struct {
+	Trailer *ChunkTrailer `protobuf:"bytes,3,opt,name=trailer,proto3,oneof"`
+}
+
+func (*StoreChunkStreamRequest_Header) isStoreChunkStreamRequest_Frame() {}
+
+func (*StoreChunkStreamRequest_Data) isStoreChunkStreamRequest_Frame() {}
+
+func (*StoreChunkStreamRequest_Trailer) isStoreChunkStreamRequest_Frame() {}
+
+type RetrieveChunkStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+
+
+
+
+
+	Frame         isRetrieveChunkStreamResponse_Frame `protobuf_oneof:"frame"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RetrieveChunkStreamResponse) Reset() {
+	*x = RetrieveChunkStreamResponse{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetrieveChunkStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetrieveChunkStreamResponse) ProtoMessage() {}
+
+func (x *RetrieveChunkStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*RetrieveChunkStreamResponse) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RetrieveChunkStreamResponse) GetFrame() isRetrieveChunkStreamResponse_Frame {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *RetrieveChunkStreamResponse) GetHeader() *ChunkHeader {
+	if x != nil {
+		if x, ok := x.Frame.(*RetrieveChunkStreamResponse_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *RetrieveChunkStreamResponse) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Frame.(*RetrieveChunkStreamResponse_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+func (x *RetrieveChunkStreamResponse) GetTrailer() *ChunkTrailer {
+	if x != nil {
+		if x, ok := x.Frame.(*RetrieveChunkStreamResponse_Trailer); ok {
+			return x.Trailer
+		}
+	}
+	return nil
+}
+
+type isRetrieveChunkStreamResponse_Frame interface {
+	isRetrieveChunkStreamResponse_Frame()
+}
+
+type RetrieveChunkStreamResponse_Header struct {
+	Header *ChunkHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type RetrieveChunkStreamResponse_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+type RetrieveChunkStreamResponse_Trailer struct {
+	Trailer *ChunkTrailer `protobuf:"bytes,3,opt,name=trailer,proto3,oneof"`
+}
+
+func (*RetrieveChunkStreamResponse_Header) isRetrieveChunkStreamResponse_Frame() {}
+
+func (*RetrieveChunkStreamResponse_Data) isRetrieveChunkStreamResponse_Frame() {}
+
+func (*RetrieveChunkStreamResponse_Trailer) isRetrieveChunkStreamResponse_Frame() {}
+
 type HealthCheckRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	WorkerId      string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
@@ -404,7 +917,7 @@ type HealthCheckRequest struct {
 
 func (x *HealthCheckRequest) Reset() {
 	*x = HealthCheckRequest{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[6]
+	mi := &file_proto_v1_echofs_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -416,7 +929,7 @@ func (x *HealthCheckRequest) String() string {
 func (*HealthCheckRequest) ProtoMessage() {}
 
 func (x *HealthCheckRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[6]
+	mi := &file_proto_v1_echofs_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -428,7 +941,7 @@ func (x *HealthCheckRequest) ProtoReflect() protoreflect.Message {
 }
 
 func (*HealthCheckRequest) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{6}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *HealthCheckRequest) GetWorkerId() string {
@@ -449,7 +962,7 @@ type HealthCheckResponse struct {
 
 func (x *HealthCheckResponse) Reset() {
 	*x = HealthCheckResponse{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[7]
+	mi := &file_proto_v1_echofs_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -461,7 +974,7 @@ func (x *HealthCheckResponse) String() string {
 func (*HealthCheckResponse) ProtoMessage() {}
 
 func (x *HealthCheckResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[7]
+	mi := &file_proto_v1_echofs_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -473,7 +986,7 @@ func (x *HealthCheckResponse) ProtoReflect() protoreflect.Message {
 }
 
 func (*HealthCheckResponse) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{7}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *HealthCheckResponse) GetHealthy() bool {
@@ -506,7 +1019,7 @@ type WorkerStatusRequest struct {
 
 func (x *WorkerStatusRequest) Reset() {
 	*x = WorkerStatusRequest{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[8]
+	mi := &file_proto_v1_echofs_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -518,7 +1031,7 @@ func (x *WorkerStatusRequest) String() string {
 func (*WorkerStatusRequest) ProtoMessage() {}
 
 func (x *WorkerStatusRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[8]
+	mi := &file_proto_v1_echofs_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -530,7 +1043,7 @@ func (x *WorkerStatusRequest) ProtoReflect() protoreflect.Message {
 }
 
 func (*WorkerStatusRequest) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{8}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *WorkerStatusRequest) GetWorkerId() string {
@@ -541,21 +1054,30 @@ func (x *WorkerStatusRequest) GetWorkerId() string {
 }
 
 type WorkerStatusResponse struct {
-	state          protoimpl.MessageState `protogen:"open.v1"`
-	WorkerId       string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
-	Address        string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
-	Port           int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
-	AvailableSpace int64                  `protobuf:"varint,4,opt,name=available_space,json=availableSpace,proto3" json:"available_space,omitempty"`
-	CurrentLoad    int32                  `protobuf:"varint,5,opt,name=current_load,json=currentLoad,proto3" json:"current_load,omitempty"`
-	Status         string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
-	LastHeartbeat  int64                  `protobuf:"varint,7,opt,name=last_heartbeat,json=lastHeartbeat,proto3" json:"last_heartbeat,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	WorkerId            string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	Address             string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Port                int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	AvailableSpace      int64                  `protobuf:"varint,4,opt,name=available_space,json=availableSpace,proto3" json:"available_space,omitempty"`
+	CurrentLoad         int32                  `protobuf:"varint,5,opt,name=current_load,json=currentLoad,proto3" json:"current_load,omitempty"`
+	Status              string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	LastHeartbeat       int64                  `protobuf:"varint,7,opt,name=last_heartbeat,json=lastHeartbeat,proto3" json:"last_heartbeat,omitempty"`
+	UsedSpace           int64                  `protobuf:"varint,8,opt,name=used_space,json=usedSpace,proto3" json:"used_space,omitempty"`
+	TotalSpace          int64                  `protobuf:"varint,9,opt,name=total_space,json=totalSpace,proto3" json:"total_space,omitempty"`
+	ChunksStored        int64                  `protobuf:"varint,10,opt,name=chunks_stored,json=chunksStored,proto3" json:"chunks_stored,omitempty"`
+	InFlightRpcs        int32                  `protobuf:"varint,11,opt,name=in_flight_rpcs,json=inFlightRpcs,proto3" json:"in_flight_rpcs,omitempty"`
+	WriteBytesPerSecond float64                `protobuf:"fixed64,12,opt,name=write_bytes_per_second,json=writeBytesPerSecond,proto3" json:"write_bytes_per_second,omitempty"`
+	ReadBytesPerSecond  float64                `protobuf:"fixed64,13,opt,name=read_bytes_per_second,json=readBytesPerSecond,proto3" json:"read_bytes_per_second,omitempty"`
+	RequestsPerSecond   float64                `protobuf:"fixed64,14,opt,name=requests_per_second,json=requestsPerSecond,proto3" json:"requests_per_second,omitempty"`
+	ErrorRate           float64                `protobuf:"fixed64,15,opt,name=error_rate,json=errorRate,proto3" json:"error_rate,omitempty"`
+	SharedStorage       bool                   `protobuf:"varint,16,opt,name=shared_storage,json=sharedStorage,proto3" json:"shared_storage,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *WorkerStatusResponse) Reset() {
 	*x = WorkerStatusResponse{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[9]
+	mi := &file_proto_v1_echofs_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -567,7 +1089,7 @@ func (x *WorkerStatusResponse) String() string {
 func (*WorkerStatusResponse) ProtoMessage() {}
 
 func (x *WorkerStatusResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[9]
+	mi := &file_proto_v1_echofs_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -579,7 +1101,7 @@ func (x *WorkerStatusResponse) ProtoReflect() protoreflect.Message {
 }
 
 func (*WorkerStatusResponse) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{9}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *WorkerStatusResponse) GetWorkerId() string {
@@ -631,19 +1153,84 @@ func (x *WorkerStatusResponse) GetLastHeartbeat() int64 {
 	return 0
 }
 
+func (x *WorkerStatusResponse) GetUsedSpace() int64 {
+	if x != nil {
+		return x.UsedSpace
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetTotalSpace() int64 {
+	if x != nil {
+		return x.TotalSpace
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetChunksStored() int64 {
+	if x != nil {
+		return x.ChunksStored
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetInFlightRpcs() int32 {
+	if x != nil {
+		return x.InFlightRpcs
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetWriteBytesPerSecond() float64 {
+	if x != nil {
+		return x.WriteBytesPerSecond
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetReadBytesPerSecond() float64 {
+	if x != nil {
+		return x.ReadBytesPerSecond
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetRequestsPerSecond() float64 {
+	if x != nil {
+		return x.RequestsPerSecond
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetErrorRate() float64 {
+	if x != nil {
+		return x.ErrorRate
+	}
+	return 0
+}
+
+func (x *WorkerStatusResponse) GetSharedStorage() bool {
+	if x != nil {
+		return x.SharedStorage
+	}
+	return false
+}
+
 type RegisterWorkerRequest struct {
 	state          protoimpl.MessageState `protogen:"open.v1"`
 	WorkerId       string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
 	Address        string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
 	GrpcPort       int32                  `protobuf:"varint,3,opt,name=grpc_port,json=grpcPort,proto3" json:"grpc_port,omitempty"`
 	AvailableSpace int64                  `protobuf:"varint,4,opt,name=available_space,json=availableSpace,proto3" json:"available_space,omitempty"`
+	TotalSpace     int64                  `protobuf:"varint,5,opt,name=total_space,json=totalSpace,proto3" json:"total_space,omitempty"`
+	Labels         map[string]string      `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields  protoimpl.UnknownFields
 	sizeCache      protoimpl.SizeCache
 }
 
 func (x *RegisterWorkerRequest) Reset() {
 	*x = RegisterWorkerRequest{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[10]
+	mi := &file_proto_v1_echofs_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -655,7 +1242,7 @@ func (x *RegisterWorkerRequest) String() string {
 func (*RegisterWorkerRequest) ProtoMessage() {}
 
 func (x *RegisterWorkerRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[10]
+	mi := &file_proto_v1_echofs_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -667,7 +1254,7 @@ func (x *RegisterWorkerRequest) ProtoReflect() protoreflect.Message {
 }
 
 func (*RegisterWorkerRequest) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{10}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *RegisterWorkerRequest) GetWorkerId() string {
@@ -698,18 +1285,33 @@ func (x *RegisterWorkerRequest) GetAvailableSpace() int64 {
 	return 0
 }
 
+func (x *RegisterWorkerRequest) GetTotalSpace() int64 {
+	if x != nil {
+		return x.TotalSpace
+	}
+	return 0
+}
+
+func (x *RegisterWorkerRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
 type RegisterWorkerResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
-	AssignedId    string                 `protobuf:"bytes,3,opt,name=assigned_id,json=assignedId,proto3" json:"assigned_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Success                  bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message                  string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	AssignedId               string                 `protobuf:"bytes,3,opt,name=assigned_id,json=assignedId,proto3" json:"assigned_id,omitempty"`
+	HeartbeatIntervalSeconds int32                  `protobuf:"varint,4,opt,name=heartbeat_interval_seconds,json=heartbeatIntervalSeconds,proto3" json:"heartbeat_interval_seconds,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
 }
 
 func (x *RegisterWorkerResponse) Reset() {
 	*x = RegisterWorkerResponse{}
-	mi := &file_proto_v1_echofs_proto_msgTypes[11]
+	mi := &file_proto_v1_echofs_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -721,7 +1323,7 @@ func (x *RegisterWorkerResponse) String() string {
 func (*RegisterWorkerResponse) ProtoMessage() {}
 
 func (x *RegisterWorkerResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_v1_echofs_proto_msgTypes[11]
+	mi := &file_proto_v1_echofs_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -733,7 +1335,7 @@ func (x *RegisterWorkerResponse) ProtoReflect() protoreflect.Message {
 }
 
 func (*RegisterWorkerResponse) Descriptor() ([]byte, []int) {
-	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{11}
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{18}
 }
 
 func (x *RegisterWorkerResponse) GetSuccess() bool {
@@ -757,6 +1359,139 @@ func (x *RegisterWorkerResponse) GetAssignedId() string {
 	return ""
 }
 
+func (x *RegisterWorkerResponse) GetHeartbeatIntervalSeconds() int32 {
+	if x != nil {
+		return x.HeartbeatIntervalSeconds
+	}
+	return 0
+}
+
+type HeartbeatRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	WorkerId       string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	AvailableSpace int64                  `protobuf:"varint,2,opt,name=available_space,json=availableSpace,proto3" json:"available_space,omitempty"`
+	UsedSpace      int64                  `protobuf:"varint,3,opt,name=used_space,json=usedSpace,proto3" json:"used_space,omitempty"`
+	CurrentLoad    int32                  `protobuf:"varint,4,opt,name=current_load,json=currentLoad,proto3" json:"current_load,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *HeartbeatRequest) GetWorkerId() string {
+	if x != nil {
+		return x.WorkerId
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest) GetAvailableSpace() int64 {
+	if x != nil {
+		return x.AvailableSpace
+	}
+	return 0
+}
+
+func (x *HeartbeatRequest) GetUsedSpace() int64 {
+	if x != nil {
+		return x.UsedSpace
+	}
+	return 0
+}
+
+func (x *HeartbeatRequest) GetCurrentLoad() int32 {
+	if x != nil {
+		return x.CurrentLoad
+	}
+	return 0
+}
+
+type HeartbeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Reregister    bool                   `protobuf:"varint,3,opt,name=reregister,proto3" json:"reregister,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_proto_v1_echofs_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_v1_echofs_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_v1_echofs_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *HeartbeatResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *HeartbeatResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *HeartbeatResponse) GetReregister() bool {
+	if x != nil {
+		return x.Reregister
+	}
+	return false
+}
+
 var File_proto_v1_echofs_proto protoreflect.FileDescriptor
 
 const file_proto_v1_echofs_proto_rawDesc = "" +
@@ -793,7 +1528,44 @@ const file_proto_v1_echofs_proto_rawDesc = "" +
 	"\x13DeleteChunkResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1b\n" +
-	"\tworker_id\x18\x03 \x01(\tR\bworkerId\"1\n" +
+	"\tworker_id\x18\x03 \x01(\tR\bworkerId\"\x97\x01\n" +
+	"\vStoredChunk\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x12\x19\n" +
+	"\bchunk_id\x18\x02 \x01(\tR\achunkId\x12\x1f\n" +
+	"\vchunk_index\x18\x03 \x01(\x05R\n" +
+	"chunkIndex\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x1f\n" +
+	"\vmodified_at\x18\x05 \x01(\x03R\n" +
+	"modifiedAt\"l\n" +
+	"\x11ListChunksRequest\x12\x1b\n" +
+	"\tworker_id\x18\x01 \x01(\tR\bworkerId\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12\x1b\n" +
+	"\tpage_size\x18\x03 \x01(\x05R\bpageSize\"\xc0\x01\n" +
+	"\x12ListChunksResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12'\n" +
+	"\x06chunks\x18\x03 \x03(\v2\x0f.v1.StoredChunkR\x06chunks\x12&\n" +
+	"\x0fnext_page_token\x18\x04 \x01(\tR\rnextPageToken\x12%\n" +
+	"\x0eshared_storage\x18\x05 \x01(\bR\rsharedStorage\"v\n" +
+	"\vChunkHeader\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x12\x19\n" +
+	"\bchunk_id\x18\x02 \x01(\tR\achunkId\x12\x1f\n" +
+	"\vchunk_index\x18\x03 \x01(\x05R\n" +
+	"chunkIndex\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\"&\n" +
+	"\fChunkTrailer\x12\x16\n" +
+	"\x06sha256\x18\x01 \x01(\tR\x06sha256\"\x91\x01\n" +
+	"\x17StoreChunkStreamRequest\x12)\n" +
+	"\x06header\x18\x01 \x01(\v2\x0f.v1.ChunkHeaderH\x00R\x06header\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04data\x12,\n" +
+	"\atrailer\x18\x03 \x01(\v2\x10.v1.ChunkTrailerH\x00R\atrailerB\a\n" +
+	"\x05frame\"\x95\x01\n" +
+	"\x1bRetrieveChunkStreamResponse\x12)\n" +
+	"\x06header\x18\x01 \x01(\v2\x0f.v1.ChunkHeaderH\x00R\x06header\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04data\x12,\n" +
+	"\atrailer\x18\x03 \x01(\v2\x10.v1.ChunkTrailerH\x00R\atrailerB\a\n" +
+	"\x05frame\"1\n" +
 	"\x12HealthCheckRequest\x12\x1b\n" +
 	"\tworker_id\x18\x01 \x01(\tR\bworkerId\"e\n" +
 	"\x13HealthCheckResponse\x12\x18\n" +
@@ -801,7 +1573,7 @@ const file_proto_v1_echofs_proto_rawDesc = "" +
 	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1c\n" +
 	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\"2\n" +
 	"\x13WorkerStatusRequest\x12\x1b\n" +
-	"\tworker_id\x18\x01 \x01(\tR\bworkerId\"\xec\x01\n" +
+	"\tworker_id\x18\x01 \x01(\tR\bworkerId\"\xd5\x04\n" +
 	"\x14WorkerStatusResponse\x12\x1b\n" +
 	"\tworker_id\x18\x01 \x01(\tR\bworkerId\x12\x18\n" +
 	"\aaddress\x18\x02 \x01(\tR\aaddress\x12\x12\n" +
@@ -809,26 +1581,63 @@ const file_proto_v1_echofs_proto_rawDesc = "" +
 	"\x0favailable_space\x18\x04 \x01(\x03R\x0eavailableSpace\x12!\n" +
 	"\fcurrent_load\x18\x05 \x01(\x05R\vcurrentLoad\x12\x16\n" +
 	"\x06status\x18\x06 \x01(\tR\x06status\x12%\n" +
-	"\x0elast_heartbeat\x18\a \x01(\x03R\rlastHeartbeat\"\x94\x01\n" +
+	"\x0elast_heartbeat\x18\a \x01(\x03R\rlastHeartbeat\x12\x1d\n" +
+	"\n" +
+	"used_space\x18\b \x01(\x03R\tusedSpace\x12\x1f\n" +
+	"\vtotal_space\x18\t \x01(\x03R\n" +
+	"totalSpace\x12#\n" +
+	"\rchunks_stored\x18\n" +
+	" \x01(\x03R\fchunksStored\x12$\n" +
+	"\x0ein_flight_rpcs\x18\v \x01(\x05R\finFlightRpcs\x123\n" +
+	"\x16write_bytes_per_second\x18\f \x01(\x01R\x13writeBytesPerSecond\x121\n" +
+	"\x15read_bytes_per_second\x18\r \x01(\x01R\x12readBytesPerSecond\x12.\n" +
+	"\x13requests_per_second\x18\x0e \x01(\x01R\x11requestsPerSecond\x12\x1d\n" +
+	"\n" +
+	"error_rate\x18\x0f \x01(\x01R\terrorRate\x12%\n" +
+	"\x0eshared_storage\x18\x10 \x01(\bR\rsharedStorage\"\xaf\x02\n" +
 	"\x15RegisterWorkerRequest\x12\x1b\n" +
 	"\tworker_id\x18\x01 \x01(\tR\bworkerId\x12\x18\n" +
 	"\aaddress\x18\x02 \x01(\tR\aaddress\x12\x1b\n" +
 	"\tgrpc_port\x18\x03 \x01(\x05R\bgrpcPort\x12'\n" +
-	"\x0favailable_space\x18\x04 \x01(\x03R\x0eavailableSpace\"m\n" +
+	"\x0favailable_space\x18\x04 \x01(\x03R\x0eavailableSpace\x12\x1f\n" +
+	"\vtotal_space\x18\x05 \x01(\x03R\n" +
+	"totalSpace\x12=\n" +
+	"\x06labels\x18\x06 \x03(\v2%.v1.RegisterWorkerRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xab\x01\n" +
 	"\x16RegisterWorkerResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1f\n" +
 	"\vassigned_id\x18\x03 \x01(\tR\n" +
-	"assignedId2\xd2\x02\n" +
+	"assignedId\x12<\n" +
+	"\x1aheartbeat_interval_seconds\x18\x04 \x01(\x05R\x18heartbeatIntervalSeconds\"\x9a\x01\n" +
+	"\x10HeartbeatRequest\x12\x1b\n" +
+	"\tworker_id\x18\x01 \x01(\tR\bworkerId\x12'\n" +
+	"\x0favailable_space\x18\x02 \x01(\x03R\x0eavailableSpace\x12\x1d\n" +
+	"\n" +
+	"used_space\x18\x03 \x01(\x03R\tusedSpace\x12!\n" +
+	"\fcurrent_load\x18\x04 \x01(\x05R\vcurrentLoad\"g\n" +
+	"\x11HeartbeatResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1e\n" +
+	"\n" +
+	"reregister\x18\x03 \x01(\bR\n" +
+	"reregister2\xae\x04\n" +
 	"\rWorkerService\x12;\n" +
 	"\n" +
 	"StoreChunk\x12\x15.v1.StoreChunkRequest\x1a\x16.v1.StoreChunkResponse\x12D\n" +
 	"\rRetrieveChunk\x12\x18.v1.RetrieveChunkRequest\x1a\x19.v1.RetrieveChunkResponse\x12>\n" +
 	"\vDeleteChunk\x12\x16.v1.DeleteChunkRequest\x1a\x17.v1.DeleteChunkResponse\x12>\n" +
 	"\vHealthCheck\x12\x16.v1.HealthCheckRequest\x1a\x17.v1.HealthCheckResponse\x12>\n" +
-	"\tGetStatus\x12\x17.v1.WorkerStatusRequest\x1a\x18.v1.WorkerStatusResponse2X\n" +
+	"\tGetStatus\x12\x17.v1.WorkerStatusRequest\x1a\x18.v1.WorkerStatusResponse\x12;\n" +
+	"\n" +
+	"ListChunks\x12\x15.v1.ListChunksRequest\x1a\x16.v1.ListChunksResponse\x12I\n" +
+	"\x10StoreChunkStream\x12\x1b.v1.StoreChunkStreamRequest\x1a\x16.v1.StoreChunkResponse(\x01\x12R\n" +
+	"\x13RetrieveChunkStream\x12\x18.v1.RetrieveChunkRequest\x1a\x1f.v1.RetrieveChunkStreamResponse0\x012\x92\x01\n" +
 	"\rMasterService\x12G\n" +
-	"\x0eRegisterWorker\x12\x19.v1.RegisterWorkerRequest\x1a\x1a.v1.RegisterWorkerResponseB\x11Z\x0fechofs/proto/v1b\x06proto3"
+	"\x0eRegisterWorker\x12\x19.v1.RegisterWorkerRequest\x1a\x1a.v1.RegisterWorkerResponse\x128\n" +
+	"\tHeartbeat\x12\x14.v1.HeartbeatRequest\x1a\x15.v1.HeartbeatResponseB\x11Z\x0fechofs/proto/v1b\x06proto3"
 
 var (
 	file_proto_v1_echofs_proto_rawDescOnce sync.Once
@@ -842,7 +1651,7 @@ func file_proto_v1_echofs_proto_rawDescGZIP() []byte {
 	return file_proto_v1_echofs_proto_rawDescData
 }
 
-var file_proto_v1_echofs_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_proto_v1_echofs_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
 var file_proto_v1_echofs_proto_goTypes = []any{
 	(*StoreChunkRequest)(nil),
 	(*StoreChunkResponse)(nil),
@@ -850,30 +1659,54 @@ var file_proto_v1_echofs_proto_goTypes = []any{
 	(*RetrieveChunkResponse)(nil),
 	(*DeleteChunkRequest)(nil),
 	(*DeleteChunkResponse)(nil),
+	(*StoredChunk)(nil),
+	(*ListChunksRequest)(nil),
+	(*ListChunksResponse)(nil),
+	(*ChunkHeader)(nil),
+	(*ChunkTrailer)(nil),
+	(*StoreChunkStreamRequest)(nil),
+	(*RetrieveChunkStreamResponse)(nil),
 	(*HealthCheckRequest)(nil),
 	(*HealthCheckResponse)(nil),
 	(*WorkerStatusRequest)(nil),
 	(*WorkerStatusResponse)(nil),
 	(*RegisterWorkerRequest)(nil),
 	(*RegisterWorkerResponse)(nil),
+	(*HeartbeatRequest)(nil),
+	(*HeartbeatResponse)(nil),
+	nil,
 }
 var file_proto_v1_echofs_proto_depIdxs = []int32{
+	6,
+	9,
+	10,
+	9,
+	10,
+	21,
 	0,
 	2,
 	4,
-	6,
-	8,
-	10,
+	13,
+	15,
+	7,
+	11,
+	2,
+	17,
+	19,
 	1,
 	3,
 	5,
-	7,
-	9,
-	11,
+	14,
+	16,
+	8,
+	1,
+	12,
+	18,
+	20,
+	16,
+	6,
+	6,
 	6,
-	0,
-	0,
-	0,
 	0,
 }
 
@@ -882,13 +1715,23 @@ func file_proto_v1_echofs_proto_init() {
 	if File_proto_v1_echofs_proto != nil {
 		return
 	}
+	file_proto_v1_echofs_proto_msgTypes[11].OneofWrappers = []any{
+		(*StoreChunkStreamRequest_Header)(nil),
+		(*StoreChunkStreamRequest_Data)(nil),
+		(*StoreChunkStreamRequest_Trailer)(nil),
+	}
+	file_proto_v1_echofs_proto_msgTypes[12].OneofWrappers = []any{
+		(*RetrieveChunkStreamResponse_Header)(nil),
+		(*RetrieveChunkStreamResponse_Data)(nil),
+		(*RetrieveChunkStreamResponse_Trailer)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_v1_echofs_proto_rawDesc), len(file_proto_v1_echofs_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   12,
+			NumMessages:   22,
 			NumExtensions: 0,
 			NumServices:   2,
 		},
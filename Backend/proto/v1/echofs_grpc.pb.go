@@ -11,11 +11,14 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	WorkerService_StoreChunk_FullMethodName    = "/v1.WorkerService/StoreChunk"
-	WorkerService_RetrieveChunk_FullMethodName = "/v1.WorkerService/RetrieveChunk"
-	WorkerService_DeleteChunk_FullMethodName   = "/v1.WorkerService/DeleteChunk"
-	WorkerService_HealthCheck_FullMethodName   = "/v1.WorkerService/HealthCheck"
-	WorkerService_GetStatus_FullMethodName     = "/v1.WorkerService/GetStatus"
+	WorkerService_StoreChunk_FullMethodName          = "/v1.WorkerService/StoreChunk"
+	WorkerService_RetrieveChunk_FullMethodName       = "/v1.WorkerService/RetrieveChunk"
+	WorkerService_DeleteChunk_FullMethodName         = "/v1.WorkerService/DeleteChunk"
+	WorkerService_HealthCheck_FullMethodName         = "/v1.WorkerService/HealthCheck"
+	WorkerService_GetStatus_FullMethodName           = "/v1.WorkerService/GetStatus"
+	WorkerService_ListChunks_FullMethodName          = "/v1.WorkerService/ListChunks"
+	WorkerService_StoreChunkStream_FullMethodName    = "/v1.WorkerService/StoreChunkStream"
+	WorkerService_RetrieveChunkStream_FullMethodName = "/v1.WorkerService/RetrieveChunkStream"
 )
 
 type WorkerServiceClient interface {
@@ -24,6 +27,9 @@ type WorkerServiceClient interface {
 	DeleteChunk(ctx context.Context, in *DeleteChunkRequest, opts ...grpc.CallOption) (*DeleteChunkResponse, error)
 	HealthCheck(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
 	GetStatus(ctx context.Context, in *WorkerStatusRequest, opts ...grpc.CallOption) (*WorkerStatusResponse, error)
+	ListChunks(ctx context.Context, in *ListChunksRequest, opts ...grpc.CallOption) (*ListChunksResponse, error)
+	StoreChunkStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StoreChunkStreamRequest, StoreChunkResponse], error)
+	RetrieveChunkStream(ctx context.Context, in *RetrieveChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RetrieveChunkStreamResponse], error)
 }
 
 type workerServiceClient struct {
@@ -84,12 +90,55 @@ func (c *workerServiceClient) GetStatus(ctx context.Context, in *WorkerStatusReq
 	return out, nil
 }
 
+func (c *workerServiceClient) ListChunks(ctx context.Context, in *ListChunksRequest, opts ...grpc.CallOption) (*ListChunksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListChunksResponse)
+	err := c.cc.Invoke(ctx, WorkerService_ListChunks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) StoreChunkStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StoreChunkStreamRequest, StoreChunkResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WorkerService_ServiceDesc.Streams[0], WorkerService_StoreChunkStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StoreChunkStreamRequest, StoreChunkResponse]{ClientStream: stream}
+	return x, nil
+}
+
+type WorkerService_StoreChunkStreamClient = grpc.ClientStreamingClient[StoreChunkStreamRequest, StoreChunkResponse]
+
+func (c *workerServiceClient) RetrieveChunkStream(ctx context.Context, in *RetrieveChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RetrieveChunkStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WorkerService_ServiceDesc.Streams[1], WorkerService_RetrieveChunkStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RetrieveChunkRequest, RetrieveChunkStreamResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type WorkerService_RetrieveChunkStreamClient = grpc.ServerStreamingClient[RetrieveChunkStreamResponse]
+
 type WorkerServiceServer interface {
 	StoreChunk(context.Context, *StoreChunkRequest) (*StoreChunkResponse, error)
 	RetrieveChunk(context.Context, *RetrieveChunkRequest) (*RetrieveChunkResponse, error)
 	DeleteChunk(context.Context, *DeleteChunkRequest) (*DeleteChunkResponse, error)
 	HealthCheck(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
 	GetStatus(context.Context, *WorkerStatusRequest) (*WorkerStatusResponse, error)
+	ListChunks(context.Context, *ListChunksRequest) (*ListChunksResponse, error)
+	StoreChunkStream(grpc.ClientStreamingServer[StoreChunkStreamRequest, StoreChunkResponse]) error
+	RetrieveChunkStream(*RetrieveChunkRequest, grpc.ServerStreamingServer[RetrieveChunkStreamResponse]) error
 	mustEmbedUnimplementedWorkerServiceServer()
 }
 
@@ -110,6 +159,15 @@ func (UnimplementedWorkerServiceServer) HealthCheck(context.Context, *HealthChec
 func (UnimplementedWorkerServiceServer) GetStatus(context.Context, *WorkerStatusRequest) (*WorkerStatusResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
 }
+func (UnimplementedWorkerServiceServer) ListChunks(context.Context, *ListChunksRequest) (*ListChunksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChunks not implemented")
+}
+func (UnimplementedWorkerServiceServer) StoreChunkStream(grpc.ClientStreamingServer[StoreChunkStreamRequest, StoreChunkResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StoreChunkStream not implemented")
+}
+func (UnimplementedWorkerServiceServer) RetrieveChunkStream(*RetrieveChunkRequest, grpc.ServerStreamingServer[RetrieveChunkStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method RetrieveChunkStream not implemented")
+}
 func (UnimplementedWorkerServiceServer) mustEmbedUnimplementedWorkerServiceServer() {}
 func (UnimplementedWorkerServiceServer) testEmbeddedByValue()                       {}
 
@@ -215,6 +273,40 @@ func _WorkerService_GetStatus_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WorkerService_ListChunks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChunksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).ListChunks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WorkerService_ListChunks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).ListChunks(ctx, req.(*ListChunksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_StoreChunkStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WorkerServiceServer).StoreChunkStream(&grpc.GenericServerStream[StoreChunkStreamRequest, StoreChunkResponse]{ServerStream: stream})
+}
+
+type WorkerService_StoreChunkStreamServer = grpc.ClientStreamingServer[StoreChunkStreamRequest, StoreChunkResponse]
+
+func _WorkerService_RetrieveChunkStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RetrieveChunkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WorkerServiceServer).RetrieveChunkStream(m, &grpc.GenericServerStream[RetrieveChunkRequest, RetrieveChunkStreamResponse]{ServerStream: stream})
+}
+
+type WorkerService_RetrieveChunkStreamServer = grpc.ServerStreamingServer[RetrieveChunkStreamResponse]
+
 var WorkerService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "v1.WorkerService",
 	HandlerType: (*WorkerServiceServer)(nil),
@@ -239,17 +331,34 @@ var WorkerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetStatus",
 			Handler:    _WorkerService_GetStatus_Handler,
 		},
+		{
+			MethodName: "ListChunks",
+			Handler:    _WorkerService_ListChunks_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StoreChunkStream",
+			Handler:       _WorkerService_StoreChunkStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "RetrieveChunkStream",
+			Handler:       _WorkerService_RetrieveChunkStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/v1/echofs.proto",
 }
 
 const (
 	MasterService_RegisterWorker_FullMethodName = "/v1.MasterService/RegisterWorker"
+	MasterService_Heartbeat_FullMethodName      = "/v1.MasterService/Heartbeat"
 )
 
 type MasterServiceClient interface {
 	RegisterWorker(ctx context.Context, in *RegisterWorkerRequest, opts ...grpc.CallOption) (*RegisterWorkerResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 }
 
 type masterServiceClient struct {
@@ -270,8 +379,19 @@ func (c *masterServiceClient) RegisterWorker(ctx context.Context, in *RegisterWo
 	return out, nil
 }
 
+func (c *masterServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, MasterService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 type MasterServiceServer interface {
 	RegisterWorker(context.Context, *RegisterWorkerRequest) (*RegisterWorkerResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	mustEmbedUnimplementedMasterServiceServer()
 }
 
@@ -280,6 +400,9 @@ type UnimplementedMasterServiceServer struct{}
 func (UnimplementedMasterServiceServer) RegisterWorker(context.Context, *RegisterWorkerRequest) (*RegisterWorkerResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RegisterWorker not implemented")
 }
+func (UnimplementedMasterServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
 func (UnimplementedMasterServiceServer) mustEmbedUnimplementedMasterServiceServer() {}
 func (UnimplementedMasterServiceServer) testEmbeddedByValue()                       {}
 
@@ -313,6 +436,24 @@ func _MasterService_RegisterWorker_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MasterService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MasterService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var MasterService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "v1.MasterService",
 	HandlerType: (*MasterServiceServer)(nil),
@@ -321,6 +462,10 @@ var MasterService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RegisterWorker",
 			Handler:    _MasterService_RegisterWorker_Handler,
 		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _MasterService_Heartbeat_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/v1/echofs.proto",
@@ -0,0 +1,87 @@
+package integration
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	fileops "echofs/pkg/fileops/Chunker"
+)
+
+func cdcChunks(t *testing.T, chunker *fileops.CDCChunker, data []byte) ([]string, [][]byte) {
+	var hashes []string
+	var chunks [][]byte
+	_, err := chunker.ChunkStream(bytes.NewReader(data), func(chunk fileops.ChunkMeta, chunkData []byte) error {
+		hashes = append(hashes, chunk.MD5Hash)
+		chunks = append(chunks, append([]byte(nil), chunkData...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChunkStream failed: %v", err)
+	}
+	return hashes, chunks
+}
+
+func TestContentDefinedChunking(t *testing.T) {
+	const minSize, avgSize, maxSize = 2 * 1024, 8 * 1024, 32 * 1024
+
+	chunker, err := fileops.NewCDCChunker(minSize, avgSize, maxSize)
+	if err != nil {
+		t.Fatalf("NewCDCChunker failed: %v", err)
+	}
+
+	data := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(42)).Read(data)
+
+	t.Run("Chunks reassemble within size bounds", func(t *testing.T) {
+		_, chunks := cdcChunks(t, chunker, data)
+
+		if !bytes.Equal(bytes.Join(chunks, nil), data) {
+			t.Fatal("Chunks do not reassemble to the original data")
+		}
+		for i, chunk := range chunks {
+			if len(chunk) > maxSize || (len(chunk) < minSize && i != len(chunks)-1) {
+				t.Fatalf("Chunk %d has size %d outside [%d, %d]", i, len(chunk), minSize, maxSize)
+			}
+		}
+
+		average := len(data) / len(chunks)
+		if average < avgSize/2 || average > avgSize*2 {
+			t.Errorf("Average chunk size %d too far from %d", average, avgSize)
+		}
+		t.Logf("%d chunks, average %d bytes", len(chunks), average)
+	})
+
+	t.Run("Insertion only changes nearby chunks", func(t *testing.T) {
+		before, _ := cdcChunks(t, chunker, data)
+
+		edited := append([]byte{}, data[:1000]...)
+		edited = append(edited, 'x')
+		edited = append(edited, data[1000:]...)
+		after, _ := cdcChunks(t, chunker, edited)
+
+		known := make(map[string]bool, len(before))
+		for _, hash := range before {
+			known[hash] = true
+		}
+		changed := 0
+		for _, hash := range after {
+			if !known[hash] {
+				changed++
+			}
+		}
+
+		if changed > 2 {
+			t.Errorf("Expected at most 2 new chunks after a 1-byte insert, got %d of %d", changed, len(after))
+		}
+	})
+
+	t.Run("Invalid sizes", func(t *testing.T) {
+		if _, err := fileops.NewCDCChunker(8*1024, 4*1024, 16*1024); err == nil {
+			t.Error("Expected an error when min > avg")
+		}
+		if _, err := fileops.NewStreamChunker("rabin", 1024, minSize, avgSize, maxSize); err == nil {
+			t.Error("Expected an error for an unknown chunking mode")
+		}
+	})
+}
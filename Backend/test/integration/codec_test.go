@@ -0,0 +1,130 @@
+package integration
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"echofs/pkg/fileops/Compressor"
+)
+
+func TestCompressionCodecs(t *testing.T) {
+	random := make([]byte, 300*1024)
+	rand.New(rand.NewSource(7)).Read(random)
+	text := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 8000))
+
+	inputs := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("hello"),
+		"text":   text,
+		"random": random,
+		"mixed":  append(append([]byte{}, text[:70000]...), random[:70000]...),
+	}
+
+	for _, name := range []string{compressor.CodecNone, compressor.CodecGzip, compressor.CodecLZ4, compressor.CodecZstd} {
+		codec, err := compressor.GetCodec(name)
+		if err != nil {
+			t.Fatalf("GetCodec(%q) failed: %v", name, err)
+		}
+
+		for inputName, data := range inputs {
+			t.Run(name+"/"+inputName, func(t *testing.T) {
+				encoded, err := compressor.Encode(codec, data)
+				if err != nil {
+					t.Fatalf("Encode failed: %v", err)
+				}
+				decoded, err := compressor.Decode(codec, encoded)
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				if !bytes.Equal(decoded, data) {
+					t.Fatalf("Roundtrip mismatch: got %d bytes, want %d", len(decoded), len(data))
+				}
+				if inputName == "text" && name != compressor.CodecNone && len(encoded) > len(data)/4 {
+					t.Errorf("Text compressed to %d of %d bytes", len(encoded), len(data))
+				}
+			})
+		}
+	}
+
+	t.Run("LZ4 frame header", func(t *testing.T) {
+		codec, _ := compressor.GetCodec(compressor.CodecLZ4)
+		encoded, err := compressor.Encode(codec, nil)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		// Magic, FLG, BD and header checksum as written by the lz4 tool,
+		// followed by the end mark.
+		want := []byte{0x04, 0x22, 0x4D, 0x18, 0x60, 0x40, 0x82, 0, 0, 0, 0}
+		if !bytes.Equal(encoded, want) {
+			t.Errorf("Empty frame = % x, want % x", encoded, want)
+		}
+	})
+
+	t.Run("Corrupt LZ4 input", func(t *testing.T) {
+		codec, _ := compressor.GetCodec(compressor.CodecLZ4)
+		encoded, _ := compressor.Encode(codec, text)
+		corrupt := append([]byte{}, encoded...)
+		corrupt[len(corrupt)/2] ^= 0xFF
+		corrupt = corrupt[:len(corrupt)-4]
+		if _, err := compressor.Decode(codec, corrupt); err == nil {
+			t.Error("Expected an error decoding a corrupt frame")
+		}
+	})
+
+	t.Run("Per-chunk encoding", func(t *testing.T) {
+		// The upload path compresses every chunk on its own and keeps the
+		// raw bytes when a chunk doesn't shrink, so a file is read back by
+		// decoding each stored chunk independently.
+		codec, _ := compressor.GetCodec(compressor.CodecZstd)
+		data := append(append([]byte{}, text[:100000]...), random[:100000]...)
+		const chunkSize = 50000
+
+		var out []byte
+		for offset := 0; offset < len(data); offset += chunkSize {
+			chunk := data[offset : offset+chunkSize]
+			encoded, err := compressor.Encode(codec, chunk)
+			if err != nil {
+				t.Fatalf("Encode of chunk at %d failed: %v", offset, err)
+			}
+
+			shrinks := compressor.Shrinks(len(chunk), len(encoded))
+			if isText := offset < 100000; shrinks != isText {
+				t.Errorf("Chunk at %d: shrinks = %v, want %v", offset, shrinks, isText)
+			}
+			if !shrinks {
+				out = append(out, chunk...)
+				continue
+			}
+
+			decoded, err := compressor.Decode(codec, encoded)
+			if err != nil {
+				t.Fatalf("Decode of chunk at %d failed: %v", offset, err)
+			}
+			out = append(out, decoded...)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("Per-chunk roundtrip mismatch")
+		}
+	})
+
+	t.Run("Incompressible detection", func(t *testing.T) {
+		codec, _ := compressor.GetCodec(compressor.CodecGzip)
+		if got := compressor.SelectCodec(codec, text[:compressor.SampleSize], "notes.txt"); got.Name() != compressor.CodecGzip {
+			t.Errorf("Text: got codec %s, want gzip", got.Name())
+		}
+		if got := compressor.SelectCodec(codec, random[:compressor.SampleSize], "data.bin"); got.Name() != compressor.CodecNone {
+			t.Errorf("Random data: got codec %s, want none", got.Name())
+		}
+		if got := compressor.SelectCodec(codec, text[:compressor.SampleSize], "report.PDF"); got.Name() != compressor.CodecNone {
+			t.Errorf("PDF: got codec %s, want none", got.Name())
+		}
+	})
+
+	t.Run("Unknown codecs", func(t *testing.T) {
+		if _, err := compressor.GetCodec("brotli"); err == nil {
+			t.Error("Expected an error for an unknown codec")
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"echofs/pkg/encryption"
+)
+
+func TestChunkEncryption(t *testing.T) {
+	ctx := context.Background()
+	chunk := bytes.Repeat([]byte("echofs chunk "), 1000)
+
+	dataKey, err := encryption.GenerateDataKey()
+	if err != nil {
+		t.Fatalf("GenerateDataKey failed: %v", err)
+	}
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		sealed, err := encryption.EncryptChunk(dataKey, []byte("chunk-1"), chunk)
+		if err != nil {
+			t.Fatalf("EncryptChunk failed: %v", err)
+		}
+		if len(sealed) != len(chunk)+encryption.Overhead {
+			t.Errorf("Sealed chunk is %d bytes, expected %d", len(sealed), len(chunk)+encryption.Overhead)
+		}
+		if bytes.Contains(sealed, []byte("echofs chunk")) {
+			t.Error("Sealed chunk contains plaintext")
+		}
+
+		opened, err := encryption.DecryptChunk(dataKey, []byte("chunk-1"), sealed)
+		if err != nil {
+			t.Fatalf("DecryptChunk failed: %v", err)
+		}
+		if !bytes.Equal(opened, chunk) {
+			t.Fatal("Decrypted chunk does not match")
+		}
+	})
+
+	t.Run("Tampering is detected", func(t *testing.T) {
+		sealed, _ := encryption.EncryptChunk(dataKey, []byte("chunk-1"), chunk)
+
+		flipped := append([]byte{}, sealed...)
+		flipped[len(flipped)/2] ^= 0x01
+		if _, err := encryption.DecryptChunk(dataKey, []byte("chunk-1"), flipped); !errors.Is(err, encryption.ErrDecryptionFailed) {
+			t.Errorf("Flipped bit: expected ErrDecryptionFailed, got %v", err)
+		}
+		if _, err := encryption.DecryptChunk(dataKey, []byte("chunk-2"), sealed); !errors.Is(err, encryption.ErrDecryptionFailed) {
+			t.Errorf("Swapped chunk: expected ErrDecryptionFailed, got %v", err)
+		}
+		if _, err := encryption.DecryptChunk(dataKey, []byte("chunk-1"), sealed[:10]); !errors.Is(err, encryption.ErrDecryptionFailed) {
+			t.Errorf("Truncated chunk: expected ErrDecryptionFailed, got %v", err)
+		}
+
+		otherKey, _ := encryption.GenerateDataKey()
+		if _, err := encryption.DecryptChunk(otherKey, []byte("chunk-1"), sealed); !errors.Is(err, encryption.ErrDecryptionFailed) {
+			t.Errorf("Wrong key: expected ErrDecryptionFailed, got %v", err)
+		}
+	})
+
+	t.Run("Key rotation re-wraps without changing data keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		keyring, err := encryption.NewLocalKeyring(path)
+		if err != nil {
+			t.Fatalf("NewLocalKeyring failed: %v", err)
+		}
+
+		fileKey, wrapped, err := encryption.NewDataKey(ctx, keyring)
+		if err != nil {
+			t.Fatalf("NewDataKey failed: %v", err)
+		}
+		sealed, _ := encryption.EncryptChunk(fileKey, []byte("chunk-1"), chunk)
+		oldKeyID := wrapped.KeyID
+
+		newKeyID, err := keyring.Rotate(ctx)
+		if err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+		if newKeyID == oldKeyID || keyring.CurrentKeyID() != newKeyID {
+			t.Fatalf("Rotate did not switch keys: old %s, new %s, current %s", oldKeyID, newKeyID, keyring.CurrentKeyID())
+		}
+
+		rewrapped, changed, err := encryption.Rewrap(ctx, keyring, wrapped)
+		if err != nil || !changed {
+			t.Fatalf("Rewrap failed: changed=%v, err=%v", changed, err)
+		}
+		if rewrapped.KeyID != newKeyID {
+			t.Errorf("Rewrapped key uses %s, expected %s", rewrapped.KeyID, newKeyID)
+		}
+		if _, changed, _ := encryption.Rewrap(ctx, keyring, rewrapped); changed {
+			t.Error("Rewrapping a current key should be a no-op")
+		}
+
+		// A reloaded keyring can still unwrap keys wrapped before and after
+		// the rotation, and the old chunk still decrypts.
+		reloaded, err := encryption.NewLocalKeyring(path)
+		if err != nil {
+			t.Fatalf("Reloading keyring failed: %v", err)
+		}
+		for _, w := range []encryption.WrappedKey{wrapped, rewrapped} {
+			unwrapped, err := reloaded.UnwrapKey(ctx, w)
+			if err != nil {
+				t.Fatalf("UnwrapKey(%s) failed: %v", w.KeyID, err)
+			}
+			if _, err := encryption.DecryptChunk(unwrapped, []byte("chunk-1"), sealed); err != nil {
+				t.Fatalf("Chunk no longer decrypts with key unwrapped from %s: %v", w.KeyID, err)
+			}
+		}
+
+		if _, err := reloaded.UnwrapKey(ctx, encryption.WrappedKey{KeyID: "missing", Ciphertext: rewrapped.Ciphertext}); err == nil {
+			t.Error("Expected an error unwrapping with an unknown master key")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"echofs/internal/replication"
+)
+
+func TestReedSolomon(t *testing.T) {
+	const dataShards, parityShards = 6, 3
+
+	rs, err := replication.NewReedSolomon(dataShards, parityShards)
+	if err != nil {
+		t.Fatalf("NewReedSolomon failed: %v", err)
+	}
+
+	data := make([]byte, 100*1024+7)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	t.Run("Data shards hold the data unchanged", func(t *testing.T) {
+		shards, err := rs.Split(data)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		if len(shards) != dataShards+parityShards {
+			t.Fatalf("Got %d shards, expected %d", len(shards), dataShards+parityShards)
+		}
+		joined, err := rs.Join(shards, len(data))
+		if err != nil {
+			t.Fatalf("Join failed: %v", err)
+		}
+		if !bytes.Equal(joined, data) {
+			t.Fatal("Joined shards do not match the data")
+		}
+	})
+
+	t.Run("Any parity-count shards can be lost", func(t *testing.T) {
+		original, err := rs.Split(data)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		total := dataShards + parityShards
+
+		for a := 0; a < total; a++ {
+			for b := a + 1; b < total; b++ {
+				for c := b + 1; c < total; c++ {
+					shards := make([][]byte, total)
+					for i := range original {
+						if i != a && i != b && i != c {
+							shards[i] = append([]byte(nil), original[i]...)
+						}
+					}
+
+					if err := rs.Reconstruct(shards); err != nil {
+						t.Fatalf("Reconstruct without %d,%d,%d failed: %v", a, b, c, err)
+					}
+					for i := range shards {
+						if !bytes.Equal(shards[i], original[i]) {
+							t.Fatalf("Shard %d differs after losing %d,%d,%d", i, a, b, c)
+						}
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("Too many lost shards", func(t *testing.T) {
+		shards, err := rs.Split(data)
+		if err != nil {
+			t.Fatalf("Split failed: %v", err)
+		}
+		for i := 0; i <= parityShards; i++ {
+			shards[i*2] = nil
+		}
+		if err := rs.Reconstruct(shards); !errors.Is(err, replication.ErrTooFewShards) {
+			t.Errorf("Expected ErrTooFewShards, got %v", err)
+		}
+	})
+
+	t.Run("Storage mode selection", func(t *testing.T) {
+		cfg := replication.ErasureConfig{DataShards: dataShards, ParityShards: parityShards, Threshold: 1 << 30}
+
+		cases := []struct {
+			requested string
+			size      int64
+			want      string
+		}{
+			{"", 1 << 20, replication.StorageModeReplication},
+			{"", 2 << 30, replication.StorageModeErasure},
+			{"", -1, replication.StorageModeReplication},
+			{replication.StorageModeErasure, 10, replication.StorageModeErasure},
+			{replication.StorageModeReplication, 2 << 30, replication.StorageModeReplication},
+		}
+		for _, tc := range cases {
+			got, err := cfg.SelectStorageMode(tc.requested, tc.size)
+			if err != nil || got != tc.want {
+				t.Errorf("SelectStorageMode(%q, %d) = %q, %v; want %q", tc.requested, tc.size, got, err, tc.want)
+			}
+		}
+		if _, err := cfg.SelectStorageMode("mirror", 0); err == nil {
+			t.Error("Expected an error for an unknown storage mode")
+		}
+	})
+}
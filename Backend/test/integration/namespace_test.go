@@ -0,0 +1,66 @@
+package integration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"echofs/internal/metadata"
+)
+
+func TestNamespacePaths(t *testing.T) {
+	t.Run("Split and join", func(t *testing.T) {
+		cases := []struct {
+			path string
+			want []string
+		}{
+			{"", nil},
+			{"/", nil},
+			{"/projects", []string{"projects"}},
+			{"projects/alpha/", []string{"projects", "alpha"}},
+			{"/projects/alpha beta/report.pdf", []string{"projects", "alpha beta", "report.pdf"}},
+		}
+		for _, tc := range cases {
+			got, err := metadata.SplitPath(tc.path)
+			if err != nil {
+				t.Fatalf("SplitPath(%q) failed: %v", tc.path, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SplitPath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+			if len(got) > 0 && metadata.JoinPath(got...) != "/"+strings.Trim(tc.path, "/") {
+				t.Errorf("JoinPath(%q) = %q", got, metadata.JoinPath(got...))
+			}
+		}
+	})
+
+	t.Run("Invalid paths", func(t *testing.T) {
+		for _, path := range []string{
+			"/projects//alpha",
+			"/projects/../secrets",
+			"./projects",
+			"/projects/a\x00b",
+			"/" + strings.Repeat("x", metadata.MaxNameLength+1),
+		} {
+			if _, err := metadata.SplitPath(path); err != metadata.ErrInvalidPath {
+				t.Errorf("SplitPath(%q) = %v, want ErrInvalidPath", path, err)
+			}
+		}
+	})
+
+	t.Run("Split directory", func(t *testing.T) {
+		dir, name, err := metadata.SplitDir("/projects/alpha/report.pdf")
+		if err != nil || !reflect.DeepEqual(dir, []string{"projects", "alpha"}) || name != "report.pdf" {
+			t.Errorf("SplitDir = %q, %q, %v", dir, name, err)
+		}
+
+		dir, name, err = metadata.SplitDir("report.pdf")
+		if err != nil || len(dir) != 0 || name != "report.pdf" {
+			t.Errorf("SplitDir at the root = %q, %q, %v", dir, name, err)
+		}
+
+		if _, _, err := metadata.SplitDir("/"); err != metadata.ErrInvalidPath {
+			t.Errorf("SplitDir of the root = %v, want ErrInvalidPath", err)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"echofs/cmd/master/core"
+	"echofs/internal/metadata"
+)
+
+func newTestRing(replicas int, workerIDs ...string) *metadata.HashRing {
+	ring := metadata.NewHashRing(100, replicas)
+	for _, workerID := range workerIDs {
+		ring.AddWorker(&core.WorkerNode{ID: workerID}, 1)
+	}
+	return ring
+}
+
+func TestHashRingPlacement(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Empty ring", func(t *testing.T) {
+		ring := metadata.NewHashRing(100, 3)
+		if _, err := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", 0)); err != metadata.ErrNoWorkers {
+			t.Errorf("Expected ErrNoWorkers, got %v", err)
+		}
+	})
+
+	t.Run("Distinct and stable replicas", func(t *testing.T) {
+		ring := newTestRing(3, "worker1", "worker2", "worker3", "worker4")
+
+		for i := 0; i < 100; i++ {
+			placement, err := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+			if err != nil {
+				t.Fatalf("RebalanceChunk failed: %v", err)
+			}
+			if len(placement) != 3 {
+				t.Fatalf("Expected 3 workers, got %v", placement)
+			}
+
+			seen := make(map[string]bool)
+			for _, workerID := range placement {
+				if seen[workerID] {
+					t.Fatalf("Chunk %d placed twice on %s: %v", i, workerID, placement)
+				}
+				seen[workerID] = true
+			}
+
+			again, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+			if fmt.Sprint(again) != fmt.Sprint(placement) {
+				t.Fatalf("Placement of chunk %d not stable: %v vs %v", i, placement, again)
+			}
+		}
+	})
+
+	t.Run("Replicas capped by worker count", func(t *testing.T) {
+		ring := newTestRing(3, "worker1", "worker2")
+		placement, err := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", 0))
+		if err != nil {
+			t.Fatalf("RebalanceChunk failed: %v", err)
+		}
+		if len(placement) != 2 {
+			t.Errorf("Expected 2 workers, got %v", placement)
+		}
+	})
+}
+
+func TestHashRingMinimalMovement(t *testing.T) {
+	ctx := context.Background()
+	const chunks = 10000
+
+	ring := newTestRing(1, "worker1", "worker2", "worker3", "worker4")
+	before := make([]string, chunks)
+	for i := range before {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		before[i] = placement[0]
+	}
+
+	ring.AddWorker(&core.WorkerNode{ID: "worker5"}, 1)
+
+	moved := 0
+	for i := range before {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		if placement[0] == before[i] {
+			continue
+		}
+		if placement[0] != "worker5" {
+			t.Fatalf("Chunk %d moved from %s to %s instead of the new worker", i, before[i], placement[0])
+		}
+		moved++
+	}
+
+	// Ideally 1/5 of the chunks move to the new worker.
+	if moved < chunks/10 || moved > chunks*3/10 {
+		t.Errorf("Expected about %d chunks to move, %d did", chunks/5, moved)
+	}
+
+	ring.RemoveWorker("worker5")
+	for i := range before {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		if placement[0] != before[i] {
+			t.Fatalf("Chunk %d did not return to %s after removal", i, before[i])
+		}
+	}
+
+	t.Logf("Moved %d of %d chunks after adding a worker", moved, chunks)
+}
+
+func TestHashRingWeights(t *testing.T) {
+	ctx := context.Background()
+	const chunks = 20000
+
+	ring := metadata.NewHashRing(100, 1)
+	ring.AddWorker(&core.WorkerNode{ID: "small"}, 1)
+	ring.AddWorker(&core.WorkerNode{ID: "large"}, 3)
+
+	counts := make(map[string]int)
+	for i := 0; i < chunks; i++ {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		counts[placement[0]]++
+	}
+
+	ratio := float64(counts["large"]) / float64(counts["small"])
+	if ratio < 2 || ratio > 4 {
+		t.Errorf("Expected the large worker to hold about 3x the chunks, got %v", counts)
+	}
+
+	// Re-weighting the large worker down to the small one's capacity only
+	// moves chunks off it.
+	before := make([]string, chunks)
+	for i := range before {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		before[i] = placement[0]
+	}
+	ring.AddWorker(&core.WorkerNode{ID: "large"}, metadata.CapacityWeight(1<<30, 1<<30))
+	for i := range before {
+		placement, _ := ring.RebalanceChunk(ctx, metadata.ChunkKey("file", i))
+		if placement[0] != before[i] && before[i] != "large" {
+			t.Fatalf("Chunk %d moved from %s to %s after re-weighting large", i, before[i], placement[0])
+		}
+	}
+}
+
+func TestCapacityWeight(t *testing.T) {
+	if w := metadata.CapacityWeight(2<<30, 1<<30); w != 2 {
+		t.Errorf("Expected weight 2 for twice the baseline, got %v", w)
+	}
+	if w := metadata.CapacityWeight(0, 1<<30); w != 1 {
+		t.Errorf("Expected weight 1 for unknown capacity, got %v", w)
+	}
+	if w := metadata.CapacityWeight(1<<30, 0); w != 1 {
+		t.Errorf("Expected weight 1 without a baseline, got %v", w)
+	}
+}
+
+func TestHashRingChunkPlacer(t *testing.T) {
+	ctx := context.Background()
+	var placer core.ChunkPlacer = metadata.NewHashRing(100, 2)
+	ring := placer.(*metadata.HashRing)
+
+	ring.AddWorker(&core.WorkerNode{ID: "full", Status: core.WorkerStatusOnline, AvailableStorage: 1}, 1)
+	ring.AddWorker(&core.WorkerNode{ID: "roomy", Status: core.WorkerStatusOnline, AvailableStorage: 100}, 1)
+	ring.AddWorker(&core.WorkerNode{ID: "gone", Status: core.WorkerStatusOffline, AvailableStorage: 1000}, 1)
+
+	placement, err := placer.PlaceChunk(ctx, "file", 3)
+	if err != nil {
+		t.Fatalf("PlaceChunk failed: %v", err)
+	}
+	expected, _ := placer.RebalanceChunk(ctx, metadata.ChunkKey("file", 3))
+	if fmt.Sprint(placement) != fmt.Sprint(expected) || len(placement) != 2 {
+		t.Errorf("PlaceChunk = %v, want %v", placement, expected)
+	}
+
+	workers, err := placer.GetOptimalWorkers(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetOptimalWorkers failed: %v", err)
+	}
+	if len(workers) != 2 || workers[0].ID != "roomy" || workers[1].ID != "full" {
+		t.Errorf("GetOptimalWorkers returned %v, want roomy then full", workers)
+	}
+
+	// Re-adding a worker updates what the ring knows about it.
+	ring.AddWorker(&core.WorkerNode{ID: "roomy", Status: core.WorkerStatusDraining}, 1)
+	workers, _ = placer.GetOptimalWorkers(ctx, 5)
+	if len(workers) != 1 || workers[0].ID != "full" {
+		t.Errorf("GetOptimalWorkers after draining returned %v, want full", workers)
+	}
+}
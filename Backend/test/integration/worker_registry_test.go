@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"echofs/cmd/master/core"
+)
+
+func TestLiveWorkerRegistry(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	t.Run("Register and heartbeat", func(t *testing.T) {
+		registry := core.NewLiveWorkerRegistry(time.Minute, logger)
+		for _, id := range []string{"worker2", "worker1"} {
+			err := registry.RegisterWorker(ctx, &core.WorkerNode{
+				ID:           id,
+				Address:      "10.0.0.1:9081",
+				TotalStorage: 1000,
+				Labels:       map[string]string{"zone": "a"},
+			})
+			if err != nil {
+				t.Fatalf("RegisterWorker failed: %v", err)
+			}
+		}
+
+		workers := registry.Workers()
+		if len(workers) != 2 || workers[0].ID != "worker1" || workers[1].ID != "worker2" {
+			t.Fatalf("Expected worker1 and worker2, got %v", workers)
+		}
+		if workers[0].Status != core.WorkerStatusOnline || workers[0].Labels["zone"] != "a" {
+			t.Errorf("Expected an online worker in zone a, got %+v", workers[0])
+		}
+
+		if _, err := registry.Heartbeat(ctx, "worker1", 600, 400); err != nil {
+			t.Fatalf("Heartbeat failed: %v", err)
+		}
+		load, err := registry.GetWorkerLoad(ctx, "worker1")
+		if err != nil || load != 0.4 {
+			t.Errorf("Expected load 0.4, got %v (%v)", load, err)
+		}
+
+		if _, err := registry.Heartbeat(ctx, "worker3", 0, 0); err != core.ErrWorkerNotFound {
+			t.Errorf("Expected ErrWorkerNotFound for an unknown worker, got %v", err)
+		}
+	})
+
+	t.Run("Missed heartbeats mark workers offline", func(t *testing.T) {
+		registry := core.NewLiveWorkerRegistry(100*time.Millisecond, logger)
+		offline := make(chan string, 1)
+		registry.OnOffline(func(worker *core.WorkerNode) { offline <- worker.ID })
+
+		if err := registry.RegisterWorker(ctx, &core.WorkerNode{ID: "worker1"}); err != nil {
+			t.Fatalf("RegisterWorker failed: %v", err)
+		}
+		if err := registry.StartHealthChecking(ctx); err != nil {
+			t.Fatalf("StartHealthChecking failed: %v", err)
+		}
+		defer registry.StopHealthChecking(ctx)
+
+		select {
+		case id := <-offline:
+			if id != "worker1" {
+				t.Fatalf("Expected worker1 offline, got %s", id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Worker was not marked offline")
+		}
+
+		healthy, _ := registry.GetHealthyWorkers(ctx)
+		if len(healthy) != 0 {
+			t.Errorf("Expected no healthy workers, got %v", healthy)
+		}
+		if err := registry.CheckWorkerHealth(ctx, "worker1"); err == nil {
+			t.Error("Expected an offline worker to fail its health check")
+		}
+
+		previous, err := registry.Heartbeat(ctx, "worker1", 0, 0)
+		if err != nil {
+			t.Fatalf("Heartbeat failed: %v", err)
+		}
+		if previous.Status != core.WorkerStatusOffline {
+			t.Errorf("Expected the worker to have been offline, got %v", previous.Status)
+		}
+		if err := registry.CheckWorkerHealth(ctx, "worker1"); err != nil {
+			t.Errorf("Expected the worker back online, got %v", err)
+		}
+	})
+}